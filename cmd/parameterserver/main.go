@@ -0,0 +1,52 @@
+// Command parameterserver serves the weights of a TrainInKube run to its workers,
+// and updates them with the gradients the workers push. It is deployed by the
+// operator for the runs that set spec.parameterServer.
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/gotway/gotway/pkg/log"
+
+	"github.com/ChinmayaSharma-hue/TrainInKubes/pkg/paramserver"
+)
+
+func main() {
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	addr := fs.String("addr", ":8080", "Address the parameter server is served on")
+	learningRate := fs.Float64("learning-rate", paramserver.DefaultLearningRate, "Learning rate of the gradient descent applied to the weights")
+	checkpoint := fs.String("checkpoint", "", "File the weights are saved to and restored from, or none to keep them in memory")
+	run := fs.String("run", "", "Identifier of the run, the weights saved for another run are not restored")
+	logLevel := fs.String("log-level", "info", "One of trace, debug, info, warning, error")
+	logFormat := fs.String("log-format", "text", "Either text or json")
+	// ExitOnError exits on errors
+	_ = fs.Parse(os.Args[1:])
+
+	env := "local"
+	if *logFormat == "json" {
+		env = "production"
+	}
+	logger := log.NewLogger(
+		log.Fields{
+			"service": "Parameter-Server",
+		}, env,
+		*logLevel,
+		os.Stdout,
+	)
+
+	if *learningRate <= 0 {
+		logger.Fatalf("The learning rate must be greater than 0, got %v", *learningRate)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	server := paramserver.New(*addr, *learningRate, *checkpoint, *run, logger)
+	if err := server.Run(ctx); err != nil {
+		logger.Fatalf("Error while running the parameter server: %v", err)
+	}
+}
@@ -1,15 +1,38 @@
 import tensorflow as tf
+import numpy as np
+import json
 import os
 import pickle
+import sys
+import urllib.request
 
 model_location = os.environ['MODEL_LOCATION']
+
+# With a parameter server, the gradients are averaged by the parameter server,
+# and this job only saves its weights into the model at the end of the run
+if os.environ.get('PARAMETER_SERVER_URL'):
+    with urllib.request.urlopen(os.environ['PARAMETER_SERVER_URL'] + '/v1/weights', timeout=300) as response:
+        weights = json.load(response)
+    model = tf.keras.models.load_model(model_location)
+    for variable, tensor in zip(model.trainable_variables, weights['tensors']):
+        variable.assign(np.array(tensor['values'], dtype=np.float32).reshape(tensor['shape']))
+    model.save(model_location)
+    sys.exit(0)
+
 gradient_location = os.environ['GRADIENT_LOCATION']
 numberOfGrads = os.environ['NUMBER_OF_GRADS']
 
+# The indices of the gradients written by the workers that finished, which can
+# skip some workers when the run has a straggler policy
+if os.environ.get('GRADIENT_INDICES'):
+    gradient_indices = [int(i) for i in os.environ['GRADIENT_INDICES'].split(',')]
+else:
+    gradient_indices = range(int(numberOfGrads))
+
 grads_list = []
 
 # Picle load all the grad files from the gradient location and add them to a list
-for i in range(int(numberOfGrads)):
+for i in gradient_indices:
     with open(gradient_location + '/grads_' + str(i) + '.pickle', 'rb') as f:
         grads_list.append(pickle.load(f))
 
@@ -1,7 +1,11 @@
 import tensorflow as tf
 import numpy as np
 import os
+import json
 import pickle
+import sys
+import urllib.error
+import urllib.request
 
 # Loading the model from a persistent volume
 # Take the location of the model from the environment variable, have to fix this later
@@ -9,17 +13,74 @@ import pickle
 
 model_location = os.environ['MODEL_LOCATION']
 gradient_location = os.environ['GRADIENT_LOCATION']
-features_location = os.environ['FEATURES_LOCATION']
-labels_location = os.environ['LABELS_LOCATION']
+split_location = os.environ['SPLIT_LOCATION']
 starting_index = int(os.environ['STARTING_INDEX'])
 ending_index = int(os.environ['ENDING_INDEX'])
-job_index = int(os.environ['JOB_INDEX'])
+# The index of the pod in the Indexed Job selects the shard of the worker, and
+# backup copies write their gradients under another index
+job_index = int(os.environ['JOB_COMPLETION_INDEX'])
+gradient_index = int(os.environ.get('GRADIENT_INDEX', job_index))
+# With a parameter server, the weights are pulled from it and the gradients are
+# pushed to it instead of the storage volume
+parameter_server_url = os.environ.get('PARAMETER_SERVER_URL')
+
+
+def completed_indexes(value):
+    # Written like the completed indexes of the job, such as "1,3-5"
+    indexes = set()
+    for part in filter(None, value.split(',')):
+        first, _, last = part.partition('-')
+        indexes.update(range(int(first), int(last or first) + 1))
+    return indexes
+
+
+# The shard already has its gradients from an earlier run of the job
+if job_index in completed_indexes(os.environ.get('COMPLETED_INDEXES', '')):
+    print(f"Shard {job_index} is already trained for this minibatch")
+    sys.exit(0)
 
 model = tf.keras.models.load_model(model_location)
 
+
+def to_tensors(values):
+    return [{'shape': list(v.shape), 'values': np.ravel(v).tolist()} for v in values]
+
+
+def request(path, data=None, method=None):
+    # The parameter server answers with 200 and a body, or with 204, and with
+    # an HTTPError for the errors
+    body = json.dumps(data).encode() if data is not None else None
+    req = urllib.request.Request(parameter_server_url + path, data=body, method=method,
+                                 headers={'Content-Type': 'application/json'})
+    with urllib.request.urlopen(req, timeout=300) as response:
+        if response.status == 200:
+            return json.load(response)
+        if response.status == 204:
+            return None
+        raise RuntimeError(f"Unexpected status {response.status} from the parameter server for {path}")
+
+
+if parameter_server_url:
+    step = int(os.environ['PARAMETER_SERVER_STEP'])
+    try:
+        weights = request(f"/v1/weights?version={step}")
+    except urllib.error.HTTPError as e:
+        # The weights are set from the model built for the run before the
+        # first step, by whichever worker gets there first
+        if e.code != 404 or step != 0:
+            raise
+        try:
+            request("/v1/weights", {'tensors': to_tensors(model.trainable_variables)}, 'PUT')
+        except urllib.error.HTTPError as e:
+            if e.code != 409:
+                raise
+        weights = request(f"/v1/weights?version={step}")
+    for variable, tensor in zip(model.trainable_variables, weights['tensors']):
+        variable.assign(np.array(tensor['values'], dtype=np.float32).reshape(tensor['shape']))
+
 # Loading the training data from a persistent volume
-x_train = np.load(features_location)
-y_train = np.load(labels_location)
+x_train = np.load(os.path.join(split_location, f"x_train_{job_index}.npy"))
+y_train = np.load(os.path.join(split_location, f"y_train_{job_index}.npy"))
 
 # Get the training data for the current job
 if ending_index > len(x_train):
@@ -29,8 +90,8 @@ x_batch = x_train[starting_index:ending_index]
 y_batch = y_train[starting_index:ending_index]
 
 # Convert x_batch and y_batch to int_64t
-x_batch = tf.convert_to_tensor(x_train, dtype=tf.float32)
-y_batch = tf.convert_to_tensor(y_train, dtype=tf.int64)
+x_batch = tf.convert_to_tensor(x_batch, dtype=tf.float32)
+y_batch = tf.convert_to_tensor(y_batch, dtype=tf.int64)
 
 # Print the shape of the training data
 print(x_batch.shape)
@@ -42,6 +103,16 @@ with tf.GradientTape() as tape:
     logits = model(x_batch, training=True)
     loss_value = loss_fn(y_batch, logits)
     grads = tape.gradient(loss_value, model.trainable_variables)
-    with open(os.path.join(gradient_location, f"grads_{job_index}.pickle"), "wb") as file:
-        pickle.dump(grads, file)
+    if parameter_server_url:
+        try:
+            request(f"/v1/steps/{step}/gradients/{gradient_index}", {'tensors': to_tensors(grads)}, 'PUT')
+        except urllib.error.HTTPError as e:
+            # The weights already moved past the step, which was applied with
+            # the gradients of another copy of the shard or without them
+            if e.code != 409:
+                raise
+            print(f"Step {step} was already applied, dropping the gradients")
+    else:
+        with open(os.path.join(gradient_location, f"grads_{gradient_index}.pickle"), "wb") as file:
+            pickle.dump(grads, file)
 
@@ -0,0 +1,99 @@
+import tensorflow as tf
+import numpy as np
+import json
+import os
+import pickle
+import time
+import urllib.error
+import urllib.request
+
+# A persistent worker runs for the whole run. It asks the operator for its next
+# step, runs it, and acknowledges it, until it is told to stop.
+
+model_location = os.environ['MODEL_LOCATION']
+gradient_location = os.environ['GRADIENT_LOCATION']
+split_location = os.environ['SPLIT_LOCATION']
+coordinator_url = os.environ['COORDINATOR_URL']
+coordinator_token = os.environ['COORDINATOR_TOKEN']
+namespace = os.environ['TRAININKUBE_NAMESPACE']
+name = os.environ['TRAININKUBE_NAME']
+# The index of the pod in the Indexed Job selects the shard of the worker
+job_index = int(os.environ['JOB_COMPLETION_INDEX'])
+
+worker_url = f"{coordinator_url}/v1/namespaces/{namespace}/traininkubes/{name}/workers/{job_index}"
+
+# The shard is loaded once for the whole run
+x_train = np.load(os.path.join(split_location, f"x_train_{job_index}.npy"))
+y_train = np.load(os.path.join(split_location, f"y_train_{job_index}.npy"))
+
+loss_fn = tf.keras.losses.CategoricalCrossentropy()
+optimizer = tf.keras.optimizers.SGD(learning_rate=0.01)
+
+
+def request(url, data=None):
+    # The operator may be restarting or handing over to another replica, so
+    # the requests are retried until they go through
+    while True:
+        try:
+            req = urllib.request.Request(url, data=data, headers={"Authorization": f"Bearer {coordinator_token}"})
+            with urllib.request.urlopen(req, timeout=60) as response:
+                return response.status, response.read()
+        except urllib.error.HTTPError as e:
+            if e.code == 409:
+                return e.code, b''
+            print(f"Error from the coordinator, retrying: {e}")
+        except (urllib.error.URLError, OSError) as e:
+            print(f"Could not reach the coordinator, retrying: {e}")
+        time.sleep(5)
+
+
+def train(step):
+    model = tf.keras.models.load_model(model_location)
+    ending_index = min(step['endingIndex'], len(x_train))
+    x_batch = tf.convert_to_tensor(x_train[step['startingIndex']:ending_index], dtype=tf.float32)
+    y_batch = tf.convert_to_tensor(y_train[step['startingIndex']:ending_index], dtype=tf.int64)
+
+    with tf.GradientTape() as tape:
+        logits = model(x_batch, training=True)
+        loss_value = loss_fn(y_batch, logits)
+    grads = tape.gradient(loss_value, model.trainable_variables)
+    with open(os.path.join(gradient_location, f"grads_{job_index}.pickle"), "wb") as file:
+        pickle.dump(grads, file)
+
+
+def aggregate(step):
+    grads_list = []
+    for i in step['gradients']:
+        with open(os.path.join(gradient_location, f"grads_{i}.pickle"), "rb") as file:
+            grads_list.append(pickle.load(file))
+    avg_grads = [tf.reduce_mean([g[i] for g in grads_list], axis=0) for i in range(len(grads_list[0]))]
+
+    model = tf.keras.models.load_model(model_location)
+    optimizer.apply_gradients(zip(avg_grads, model.trainable_variables))
+    model.save(model_location)
+
+
+# Steps are assigned again with the same ID after the operator restarts, and the
+# ones already done are only acknowledged
+done = set()
+
+while True:
+    status, body = request(worker_url + "/step?timeout=30s")
+    if status != 200:
+        continue
+    step = json.loads(body)
+
+    error = ""
+    if step['id'] not in done:
+        try:
+            if step['action'] == 'train':
+                train(step)
+            elif step['action'] == 'aggregate':
+                aggregate(step)
+            done.add(step['id'])
+        except Exception as e:
+            error = str(e)
+
+    request(worker_url + "/steps/" + step['id'], json.dumps({"error": error}).encode())
+    if step['action'] == 'stop':
+        break
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/gotway/gotway/pkg/log"
+
+	"github.com/ChinmayaSharma-hue/TrainInKubes/pkg/coordinator"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const (
+	leaseDuration = 15 * time.Second
+	renewDeadline = 10 * time.Second
+	retryPeriod   = 2 * time.Second
+)
+
+// States of the leader election, as the operator is shutting down.
+const (
+	electionWaiting int32 = iota
+	electionLeading
+	electionStopping
+)
+
+// runWithLeaderElection runs the function while this replica holds the Lease.
+// The context given to the function is cancelled as soon as the Lease is lost,
+// after which the process exits, so that it starts over as a standby replica.
+// On shutdown, the Lease is only released, and runWithLeaderElection only
+// returns, once the function returned.
+func runWithLeaderElection(
+	ctx context.Context,
+	kubeClientSet kubernetes.Interface,
+	namespace string,
+	name string,
+	logger log.Logger,
+	run func(ctx context.Context),
+) {
+	identity := os.Getenv("POD_NAME")
+	if identity == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			logger.Fatalf("Error while getting the hostname for the leader election: %v", err)
+		}
+		identity = hostname
+	}
+
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Client: kubeClientSet.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: identity,
+		},
+	}
+
+	// A replica restarted after losing the leadership keeps the labels of its
+	// pod, so they are cleared until it leads again
+	labelLeader(ctx, kubeClientSet, false, logger)
+
+	// The elector runs OnStartedLeading in a goroutine, and releases the Lease
+	// as soon as its context is cancelled. Its context is therefore only
+	// cancelled once the function returned, so that another replica does not
+	// take over the runs while the orchestrators of this one are stopping.
+	electionCtx, cancelElection := context.WithCancel(context.Background())
+	defer cancelElection()
+	var state atomic.Int32
+	go func() {
+		<-ctx.Done()
+		// Otherwise the function is stopping, and cancels the election when it
+		// returned
+		if state.CompareAndSwap(electionWaiting, electionStopping) {
+			cancelElection()
+		}
+	}()
+
+	logger.Infof("Waiting to become the leader as %s...", identity)
+	leaderelection.RunOrDie(electionCtx, leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   leaseDuration,
+		RenewDeadline:   renewDeadline,
+		RetryPeriod:     retryPeriod,
+		ReleaseOnCancel: true,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(leaderCtx context.Context) {
+				if !state.CompareAndSwap(electionWaiting, electionLeading) {
+					return
+				}
+				defer cancelElection()
+
+				runCtx, cancel := context.WithCancel(leaderCtx)
+				defer cancel()
+				go func() {
+					select {
+					case <-ctx.Done():
+					case <-runCtx.Done():
+					}
+					cancel()
+				}()
+
+				logger.Infof("Became the leader")
+				run(runCtx)
+			},
+			OnStoppedLeading: func() {
+				if ctx.Err() != nil {
+					logger.Infof("Released the leadership")
+					return
+				}
+				logger.Fatalf("Lost the leadership")
+			},
+			OnNewLeader: func(current string) {
+				if current != identity {
+					logger.Infof("The current leader is %s", current)
+				}
+			},
+		},
+	})
+}
+
+// labelLeader sets or removes the coordinator.LeaderLabel on the pod of the
+// operator, given by POD_NAME and POD_NAMESPACE, so that the persistent workers
+// only reach the leader through the Service of the coordinator. Nothing is done
+// out of a pod.
+func labelLeader(ctx context.Context, kubeClientSet kubernetes.Interface, leading bool, logger log.Logger) {
+	name, namespace := os.Getenv("POD_NAME"), os.Getenv("POD_NAMESPACE")
+	if name == "" || namespace == "" {
+		return
+	}
+
+	value := "null"
+	if leading {
+		value = `"true"`
+	}
+	patch := fmt.Sprintf(`{"metadata":{"labels":{%q:%s}}}`, coordinator.LeaderLabel, value)
+	_, err := kubeClientSet.CoreV1().Pods(namespace).Patch(ctx, name, types.MergePatchType, []byte(patch), metav1.PatchOptions{})
+	if err != nil {
+		logger.Errorf("Error while labelling the pod of the operator: %v", err)
+	}
+}
@@ -2,53 +2,118 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"os"
 	"os/signal"
+	"reflect"
+	"sync/atomic"
 	"syscall"
+	"time"
 
 	"github.com/gotway/gotway/pkg/log"
 
 	traininkubev1alpha1clientset "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/client/clientset/versioned"
+	"github.com/ChinmayaSharma-hue/TrainInKubes/pkg/config"
 	"github.com/ChinmayaSharma-hue/TrainInKubes/pkg/controller"
+	"github.com/ChinmayaSharma-hue/TrainInKubes/pkg/coordinator"
+	"github.com/ChinmayaSharma-hue/TrainInKubes/pkg/health"
+	"github.com/ChinmayaSharma-hue/TrainInKubes/pkg/metrics"
+	"github.com/ChinmayaSharma-hue/TrainInKubes/pkg/train"
+	"github.com/ChinmayaSharma-hue/TrainInKubes/pkg/webhook"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextensionsclientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	webhookAddr     = ":8443"
+	webhookCertFile = "/etc/tikoperator/webhook/tls.crt"
+	webhookKeyFile  = "/etc/tikoperator/webhook/tls.key"
+
+	crdName = "traininkubes.trainink8s.com"
+
+	// configReloadPeriod is how often the config file is checked for changes.
+	configReloadPeriod = 10 * time.Second
 )
 
 func main() {
-	var restConfig *rest.Config
-	var errKubeConfig error
+	cfg, configPath, err := config.Parse(os.Args[0], os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		// The logger depends on the config, so it cannot be used yet
+		os.Stderr.WriteString("Error while reading the config: " + err.Error() + "\n")
+		os.Exit(2)
+	}
 
 	// Create a logger
+	env := "local"
+	if cfg.Log.Format == "json" {
+		env = "production"
+	}
 	logger := log.NewLogger(
 		log.Fields{
 			"service": "Train-Operator",
-		}, "local",
-		"debug",
+		}, env,
+		cfg.Log.Level,
 		os.Stdout,
 	)
 
 	logger.Debugf("Starting the controller...")
 
-	restConfig, errKubeConfig = rest.InClusterConfig()
-	if errKubeConfig != nil {
-		logger.Errorf("Error while building the kubeconfig: %v", errKubeConfig)
+	train.SetDefaultImages(cfg.Images)
+
+	restConfig, err := buildRestConfig(cfg)
+	if err != nil {
+		logger.Fatalf("Error while building the kubeconfig: %v", err)
 	}
+	restConfig.QPS = cfg.QPS
+	restConfig.Burst = cfg.Burst
 
 	kubeClientSet, err := kubernetes.NewForConfig(restConfig)
 	if err != nil {
-		logger.Errorf("Error while creating the kubernetes clientset: %v", err)
+		logger.Fatalf("Error while creating the kubernetes clientset: %v", err)
 	}
 
 	traininkubev1alpha1ClientSet, err := traininkubev1alpha1clientset.NewForConfig(restConfig)
 	if err != nil {
-		logger.Errorf("Error while creating the TrainInKube clientset: %v", err)
+		logger.Fatalf("Error while creating the TrainInKube clientset: %v", err)
+	}
+
+	// The persistent workers are coordinated by the leader, through a Service
+	// selecting the pod labelled as the leader
+	var coordinatorServer *coordinator.Server
+	coordinatorURL := cfg.CoordinatorURL
+	if cfg.CoordinatorAddr != "" {
+		coordinatorServer = coordinator.New(cfg.CoordinatorAddr, logger.WithField("type", "coordinator"))
+		if coordinatorURL == "" {
+			namespace := os.Getenv("POD_NAMESPACE")
+			if namespace == "" {
+				namespace = "default"
+			}
+			coordinatorURL = "http://tikoperator-coordinator." + namespace + ".svc:8082"
+		}
 	}
 
 	// Creating a new controller
 	ctrl := controller.New(
 		kubeClientSet,
 		traininkubev1alpha1ClientSet,
-		"default",
+		controller.Options{
+			Namespaces: controller.Namespaces{
+				Names:    cfg.Namespaces,
+				Selector: cfg.Selector(),
+			},
+			Workers:        cfg.Workers,
+			ResyncPeriod:   cfg.ResyncPeriod.Duration,
+			Coordinator:    coordinatorServer,
+			CoordinatorURL: coordinatorURL,
+		},
 		logger.WithField("type", "controller"),
 	)
 
@@ -60,8 +125,163 @@ func main() {
 	}...)
 	defer cancel()
 
-	err = ctrl.Run(ctx)
+	// The webhooks are only served when a serving certificate is mounted
+	var webhookServer *webhook.Server
+	if _, err := os.Stat(webhookCertFile); err == nil {
+		webhookServer = webhook.New(
+			webhookAddr,
+			webhookCertFile,
+			webhookKeyFile,
+			webhook.NewDefaults(),
+			logger.WithField("type", "webhook"),
+		)
+		go func() {
+			err := webhookServer.Run(ctx)
+			if err != nil {
+				logger.Errorf("Error running the webhook server: %v", err)
+			}
+		}()
+	} else {
+		// The informers never sync when the CRD converts the TrainInKubes
+		// through a webhook nobody serves. Out of a pod, it is served by the
+		// operator deployed in the cluster.
+		required, err := conversionRequired(ctx, restConfig)
+		if err != nil {
+			logger.Fatalf("Error while getting the TrainInKube CRD: %v", err)
+		}
+		if required && os.Getenv("POD_NAME") != "" {
+			logger.Fatalf("No webhook certificate found at %s, while the TrainInKube CRD converts through the webhook", webhookCertFile)
+		}
+		logger.Infof("No webhook certificate found at %s, not serving the webhooks", webhookCertFile)
+	}
+
+	if cfg.MetricsAddr != "" {
+		metricsServer := metrics.NewServer(cfg.MetricsAddr, logger.WithField("type", "metrics"))
+		go func() {
+			err := metricsServer.Run(ctx)
+			if err != nil {
+				logger.Errorf("Error running the metrics server: %v", err)
+			}
+		}()
+	}
+
+	if coordinatorServer != nil {
+		go func() {
+			err := coordinatorServer.Run(ctx)
+			if err != nil {
+				logger.Errorf("Error running the coordinator server: %v", err)
+			}
+		}()
+	}
+
+	// A standby replica has nothing to sync until it becomes the leader, so it
+	// is ready as long as it is waiting, which lets rollouts move on
+	var leading atomic.Bool
+	if cfg.HealthAddr != "" {
+		healthServer := health.New(cfg.HealthAddr, logger.WithField("type", "health"))
+		healthServer.AddLivenessCheck("workers", ctrl.Alive)
+		healthServer.AddReadinessCheck("informers", func() error {
+			if !leading.Load() {
+				return nil
+			}
+			return ctrl.Ready()
+		})
+		go func() {
+			err := healthServer.Run(ctx)
+			if err != nil {
+				logger.Errorf("Error running the health server: %v", err)
+			}
+		}()
+	}
+
+	// Only the stage images are reloaded, as the other settings are used to
+	// set up the clients and the informers
+	if configPath != "" {
+		go config.Watch(ctx, os.Args[0], os.Args[1:], configPath, configReloadPeriod,
+			func(reloaded config.Config) {
+				logger.Infof("Reloading the config file %s", configPath)
+
+				train.SetDefaultImages(reloaded.Images)
+				if webhookServer != nil {
+					webhookServer.UpdateDefaults(webhook.NewDefaults())
+				}
+
+				reloaded.Images = cfg.Images
+				if !reflect.DeepEqual(reloaded, cfg) {
+					logger.Warnf("Only the stage images were reloaded, restart the operator to apply the other changes")
+				}
+			},
+			func(err error) {
+				logger.Errorf("Error while reloading the config file: %v", err)
+			},
+		)
+	}
+
+	runController := func(ctx context.Context) {
+		leading.Store(true)
+		if coordinatorServer != nil {
+			labelLeader(ctx, kubeClientSet, true, logger)
+		}
+		err := ctrl.Run(ctx)
+		if err != nil {
+			logger.Fatal("Error running controller ", err)
+		}
+	}
+
+	if !cfg.LeaderElection.Enabled {
+		runController(ctx)
+		return
+	}
+
+	leaderElectionNamespace := cfg.LeaderElection.Namespace
+	if leaderElectionNamespace == "" {
+		leaderElectionNamespace = os.Getenv("POD_NAMESPACE")
+	}
+	if leaderElectionNamespace == "" {
+		leaderElectionNamespace = "default"
+	}
+	runWithLeaderElection(
+		ctx,
+		kubeClientSet,
+		leaderElectionNamespace,
+		cfg.LeaderElection.ID,
+		logger.WithField("type", "leaderelection"),
+		runController,
+	)
+}
+
+// conversionRequired reports whether the TrainInKube CRD converts between its
+// versions through the webhook of the operator.
+func conversionRequired(ctx context.Context, restConfig *rest.Config) (bool, error) {
+	apiextensionsClientSet, err := apiextensionsclientset.NewForConfig(restConfig)
+	if err != nil {
+		return false, err
+	}
+	crd, err := apiextensionsClientSet.ApiextensionsV1().CustomResourceDefinitions().Get(ctx, crdName, metav1.GetOptions{})
 	if err != nil {
-		logger.Fatal("Error running controller ", err)
+		return false, err
+	}
+	return crd.Spec.Conversion != nil && crd.Spec.Conversion.Strategy == apiextensionsv1.WebhookConverter, nil
+}
+
+// buildRestConfig uses the kubeconfig given in the config, or the in-cluster
+// config when the operator runs in a pod. Otherwise the kubeconfig is looked up
+// like kubectl does, from $KUBECONFIG or ~/.kube/config.
+func buildRestConfig(cfg config.Config) (*rest.Config, error) {
+	if cfg.Kubeconfig == "" && cfg.Context == "" {
+		restConfig, err := rest.InClusterConfig()
+		if err == nil {
+			return restConfig, nil
+		}
+		if !errors.Is(err, rest.ErrNotInCluster) {
+			return nil, err
+		}
+	}
+
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = cfg.Kubeconfig
+	overrides := &clientcmd.ConfigOverrides{
+		CurrentContext: cfg.Context,
 	}
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides).ClientConfig()
 }
@@ -0,0 +1,173 @@
+package v1alpha1
+
+import (
+	"github.com/ChinmayaSharma-hue/TrainInKubes/pkg/apis/trainink8s/v1beta1"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ConvertTo converts the TrainInKube to the v1beta1 storage version.
+func (src *TrainInKube) ConvertTo(dst *v1beta1.TrainInKube) {
+	in := src.DeepCopy()
+
+	dst.TypeMeta = in.TypeMeta
+	dst.APIVersion = v1beta1.SchemeGroupVersion.String()
+	dst.ObjectMeta = in.ObjectMeta
+
+	dst.Spec = v1beta1.TrainInKubeSpec{
+		Epochs:          int32(in.Spec.Epochs),
+		BatchSize:       int32(in.Spec.BatchSize),
+		NumberOfSamples: int32(in.Spec.NumberOfSamples),
+		Workers:         int32(in.Spec.Workers),
+		Model: v1beta1.ModelSpec{
+			Image:           in.Spec.ModelImage,
+			ImagePullPolicy: corev1.PullPolicy(in.Spec.ModelImagePullPolicy),
+		},
+		Data: v1beta1.DataSpec{
+			Storage:                     v1beta1.StorageSpec(in.Spec.Storage),
+			PreprocessedDatasetLocation: in.Spec.PreprocessedDataLocation,
+			SplitDatasetLocation:        in.Spec.SplitDatasetLocation,
+			ModelsLocation:              in.Spec.ModelsLocation,
+		},
+		Stages: v1beta1.StagesSpec{
+			Build:     convertStageToV1beta1(in.Spec.Stages.Build),
+			Split:     convertStageToV1beta1(in.Spec.Stages.Split),
+			Train:     convertStageToV1beta1(in.Spec.Stages.Train),
+			Aggregate: convertStageToV1beta1(in.Spec.Stages.Aggregate),
+		},
+		StragglerPolicy: convertStragglerPolicyToV1beta1(in.Spec.StragglerPolicy),
+		WorkerMode:      in.Spec.WorkerMode,
+		ParameterServer: convertParameterServerToV1beta1(in.Spec.ParameterServer),
+	}
+
+	dst.Status = v1beta1.TrainInKubeStatus{
+		Phase:              v1beta1.TrainInKubePhase(in.Status.Phase),
+		Conditions:         in.Status.Conditions,
+		Workers:            int32(in.Status.Workers),
+		Epoch:              int32(in.Status.Epoch),
+		MiniBatch:          int32(in.Status.MiniBatch),
+		StartTime:          in.Status.StartTime,
+		CompletionTime:     in.Status.CompletionTime,
+		ObservedGeneration: in.Status.ObservedGeneration,
+		Images:             (*v1beta1.StageImages)(in.Status.Images),
+	}
+}
+
+// ConvertFrom converts the TrainInKube from the v1beta1 storage version.
+func (dst *TrainInKube) ConvertFrom(src *v1beta1.TrainInKube) {
+	in := src.DeepCopy()
+
+	dst.TypeMeta = in.TypeMeta
+	dst.APIVersion = SchemeGroupVersion.String()
+	dst.ObjectMeta = in.ObjectMeta
+
+	dst.Spec = TrainInKubeSpec{
+		ModelImage:               in.Spec.Model.Image,
+		ModelImagePullPolicy:     string(in.Spec.Model.ImagePullPolicy),
+		Epochs:                   int(in.Spec.Epochs),
+		BatchSize:                int(in.Spec.BatchSize),
+		NumberOfSamples:          int(in.Spec.NumberOfSamples),
+		PreprocessedDataLocation: in.Spec.Data.PreprocessedDatasetLocation,
+		SplitDatasetLocation:     in.Spec.Data.SplitDatasetLocation,
+		ModelsLocation:           in.Spec.Data.ModelsLocation,
+		Workers:                  int(in.Spec.Workers),
+		Stages: StagesSpec{
+			Build:     convertStageFromV1beta1(in.Spec.Stages.Build),
+			Split:     convertStageFromV1beta1(in.Spec.Stages.Split),
+			Train:     convertStageFromV1beta1(in.Spec.Stages.Train),
+			Aggregate: convertStageFromV1beta1(in.Spec.Stages.Aggregate),
+		},
+		Storage:         StorageSpec(in.Spec.Data.Storage),
+		StragglerPolicy: convertStragglerPolicyFromV1beta1(in.Spec.StragglerPolicy),
+		WorkerMode:      in.Spec.WorkerMode,
+		ParameterServer: convertParameterServerFromV1beta1(in.Spec.ParameterServer),
+	}
+
+	dst.Status = TrainInKubeStatus{
+		Phase:              TrainInKubePhase(in.Status.Phase),
+		Conditions:         in.Status.Conditions,
+		Workers:            int(in.Status.Workers),
+		Epoch:              int(in.Status.Epoch),
+		MiniBatch:          int(in.Status.MiniBatch),
+		StartTime:          in.Status.StartTime,
+		CompletionTime:     in.Status.CompletionTime,
+		ObservedGeneration: in.Status.ObservedGeneration,
+		Images:             (*StageImages)(in.Status.Images),
+	}
+}
+
+func convertStageToV1beta1(in StageSpec) v1beta1.StageSpec {
+	return v1beta1.StageSpec{
+		Image:             in.Image,
+		ImagePullPolicy:   corev1.PullPolicy(in.ImagePullPolicy),
+		Command:           in.Command,
+		Args:              in.Args,
+		Env:               in.Env,
+		Resources:         in.Resources,
+		NodeSelector:      in.NodeSelector,
+		Tolerations:       in.Tolerations,
+		Affinity:          in.Affinity,
+		PriorityClassName: in.PriorityClassName,
+		RetryPolicy:       v1beta1.RetryPolicy(in.RetryPolicy),
+	}
+}
+
+func convertStageFromV1beta1(in v1beta1.StageSpec) StageSpec {
+	return StageSpec{
+		Image:             in.Image,
+		ImagePullPolicy:   string(in.ImagePullPolicy),
+		Command:           in.Command,
+		Args:              in.Args,
+		Env:               in.Env,
+		Resources:         in.Resources,
+		NodeSelector:      in.NodeSelector,
+		Tolerations:       in.Tolerations,
+		Affinity:          in.Affinity,
+		PriorityClassName: in.PriorityClassName,
+		RetryPolicy:       RetryPolicy(in.RetryPolicy),
+	}
+}
+
+func convertStragglerPolicyToV1beta1(in *StragglerPolicy) *v1beta1.StragglerPolicy {
+	if in == nil {
+		return nil
+	}
+	return &v1beta1.StragglerPolicy{
+		MinWorkers: in.MinWorkers,
+		Backup:     (*v1beta1.BackupWorkersPolicy)(in.Backup),
+	}
+}
+
+func convertStragglerPolicyFromV1beta1(in *v1beta1.StragglerPolicy) *StragglerPolicy {
+	if in == nil {
+		return nil
+	}
+	return &StragglerPolicy{
+		MinWorkers: in.MinWorkers,
+		Backup:     (*BackupWorkersPolicy)(in.Backup),
+	}
+}
+
+func convertParameterServerToV1beta1(in *ParameterServerSpec) *v1beta1.ParameterServerSpec {
+	if in == nil {
+		return nil
+	}
+	return &v1beta1.ParameterServerSpec{
+		Image:           in.Image,
+		ImagePullPolicy: corev1.PullPolicy(in.ImagePullPolicy),
+		LearningRate:    in.LearningRate,
+		Resources:       in.Resources,
+	}
+}
+
+func convertParameterServerFromV1beta1(in *v1beta1.ParameterServerSpec) *ParameterServerSpec {
+	if in == nil {
+		return nil
+	}
+	return &ParameterServerSpec{
+		Image:           in.Image,
+		ImagePullPolicy: string(in.ImagePullPolicy),
+		LearningRate:    in.LearningRate,
+		Resources:       in.Resources,
+	}
+}
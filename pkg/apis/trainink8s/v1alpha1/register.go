@@ -21,6 +21,10 @@ func init() {
 	localSchemeBuilder.Register(addKnownTypes)
 }
 
+func Kind(kind string) schema.GroupKind {
+	return SchemeGroupVersion.WithKind(kind).GroupKind()
+}
+
 func Resource(resource string) schema.GroupResource {
 	return SchemeGroupVersion.WithResource(resource).GroupResource()
 }
@@ -1,6 +1,9 @@
 package v1alpha1
 
-import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
 
 // +genclient
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -15,22 +18,134 @@ type TrainInKube struct {
 	Status TrainInKubeStatus `json:"status,omitempty"`
 }
 
+// TrainInKubeSpec is the flat form of the v1beta1 spec, which documents the
+// fields.
 type TrainInKubeSpec struct {
-	ModelImage               string `json:"modelImage, omitempty"`
-	ModelImagePullPolicy     string `json:"modelImagepullpolicy, omitempty`
-	Epochs                   int    `json:"epochs, omitempty"`
-	BatchSize                int    `json:"batchSize, omitempty"`
-	NumberOfSamples          int    `json:"numberOfSamples, omitempty"`
-	PreprocessedDataLocation string `json:"preprocessedDataLocation, omitempty"`
-	SplitDatasetLocation     string `json:"splitDatasetLocation, omitempty"`
-	ModelsLocation           string `json:"modelsLocation, omitempty"`
+	ModelImage               string `json:"modelImage,omitempty"`
+	ModelImagePullPolicy     string `json:"modelImagePullPolicy,omitempty"`
+	Epochs                   int    `json:"epochs,omitempty"`
+	BatchSize                int    `json:"batchSize,omitempty"`
+	NumberOfSamples          int    `json:"numberOfSamples,omitempty"`
+	PreprocessedDataLocation string `json:"preprocessedDatasetLocation,omitempty"`
+	SplitDatasetLocation     string `json:"splitDatasetLocation,omitempty"`
+	ModelsLocation           string `json:"modelsLocation,omitempty"`
+	Workers                  int    `json:"workers,omitempty"`
+
+	Stages          StagesSpec           `json:"stages,omitempty"`
+	Storage         StorageSpec          `json:"storage,omitempty"`
+	StragglerPolicy *StragglerPolicy     `json:"stragglerPolicy,omitempty"`
+	WorkerMode      string               `json:"workerMode,omitempty"`
+	ParameterServer *ParameterServerSpec `json:"parameterServer,omitempty"`
+}
+
+// Worker modes of a run.
+const (
+	WorkerModeJobs       = "Jobs"
+	WorkerModePersistent = "Persistent"
+)
+
+// ParameterServerSpec mirrors the v1beta1 ParameterServerSpec.
+type ParameterServerSpec struct {
+	Image           string                      `json:"image,omitempty"`
+	ImagePullPolicy string                      `json:"imagePullPolicy,omitempty"`
+	LearningRate    string                      `json:"learningRate,omitempty"`
+	Resources       corev1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// StragglerPolicy mirrors the v1beta1 StragglerPolicy.
+type StragglerPolicy struct {
+	MinWorkers *int32               `json:"minWorkers,omitempty"`
+	Backup     *BackupWorkersPolicy `json:"backup,omitempty"`
+}
+
+// BackupWorkersPolicy mirrors the v1beta1 BackupWorkersPolicy.
+type BackupWorkersPolicy struct {
+	Percentile int32 `json:"percentile,omitempty"`
+}
+
+// StorageSpec mirrors the v1beta1 StorageSpec.
+type StorageSpec struct {
+	HostPath              *corev1.HostPathVolumeSource              `json:"hostPath,omitempty"`
+	PersistentVolumeClaim *corev1.PersistentVolumeClaimVolumeSource `json:"persistentVolumeClaim,omitempty"`
+	NFS                   *corev1.NFSVolumeSource                   `json:"nfs,omitempty"`
+	CSI                   *corev1.CSIVolumeSource                   `json:"csi,omitempty"`
+}
+
+// StagesSpec mirrors the v1beta1 StagesSpec.
+type StagesSpec struct {
+	Build     StageSpec `json:"build,omitempty"`
+	Split     StageSpec `json:"split,omitempty"`
+	Train     StageSpec `json:"train,omitempty"`
+	Aggregate StageSpec `json:"aggregate,omitempty"`
 }
 
+// StageSpec mirrors the v1beta1 StageSpec.
+type StageSpec struct {
+	Image           string          `json:"image,omitempty"`
+	ImagePullPolicy string          `json:"imagePullPolicy,omitempty"`
+	Command         []string        `json:"command,omitempty"`
+	Args            []string        `json:"args,omitempty"`
+	Env             []corev1.EnvVar `json:"env,omitempty"`
+
+	Resources         corev1.ResourceRequirements `json:"resources,omitempty"`
+	NodeSelector      map[string]string           `json:"nodeSelector,omitempty"`
+	Tolerations       []corev1.Toleration         `json:"tolerations,omitempty"`
+	Affinity          *corev1.Affinity            `json:"affinity,omitempty"`
+	PriorityClassName string                      `json:"priorityClassName,omitempty"`
+
+	RetryPolicy RetryPolicy `json:"retryPolicy,omitempty"`
+}
+
+// RetryPolicy mirrors the v1beta1 RetryPolicy.
+type RetryPolicy struct {
+	Retries               *int32           `json:"retries,omitempty"`
+	Backoff               *metav1.Duration `json:"backoff,omitempty"`
+	BackoffLimit          *int32           `json:"backoffLimit,omitempty"`
+	ActiveDeadlineSeconds *int64           `json:"activeDeadlineSeconds,omitempty"`
+	RetriableExitCodes    []int32          `json:"retriableExitCodes,omitempty"`
+	FatalExitCodes        []int32          `json:"fatalExitCodes,omitempty"`
+}
+
+// TrainInKubePhase mirrors the v1beta1 TrainInKubePhase.
+type TrainInKubePhase string
+
+const (
+	PhasePending       TrainInKubePhase = "Pending"
+	PhaseBuildingModel TrainInKubePhase = "BuildingModel"
+	PhaseSplittingData TrainInKubePhase = "SplittingData"
+	PhaseTraining      TrainInKubePhase = "Training"
+	PhaseSucceeded     TrainInKubePhase = "Succeeded"
+	PhaseFailed        TrainInKubePhase = "Failed"
+)
+
+// Condition types, as in v1beta1.
+const (
+	ConditionModelBuilt = "ModelBuilt"
+	ConditionDataSplit  = "DataSplit"
+	ConditionComplete   = "Complete"
+	ConditionFailed     = "Failed"
+)
+
+// TrainInKubeStatus mirrors the v1beta1 TrainInKubeStatus.
 type TrainInKubeStatus struct {
-	NumberOfJobs   int
-	Phase          string
-	Succeeded      int
-	CompletionTime string
+	Phase              TrainInKubePhase   `json:"phase,omitempty"`
+	Conditions         []metav1.Condition `json:"conditions,omitempty"`
+	Workers            int                `json:"workers,omitempty"`
+	Epoch              int                `json:"epoch,omitempty"`
+	MiniBatch          int                `json:"miniBatch,omitempty"`
+	StartTime          *metav1.Time       `json:"startTime,omitempty"`
+	CompletionTime     *metav1.Time       `json:"completionTime,omitempty"`
+	ObservedGeneration int64              `json:"observedGeneration,omitempty"`
+	Images             *StageImages       `json:"images,omitempty"`
+}
+
+// StageImages mirrors the v1beta1 StageImages.
+type StageImages struct {
+	Build           string `json:"build,omitempty"`
+	Split           string `json:"split,omitempty"`
+	Train           string `json:"train,omitempty"`
+	Aggregate       string `json:"aggregate,omitempty"`
+	ParameterServer string `json:"parameterServer,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
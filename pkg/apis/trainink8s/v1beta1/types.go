@@ -0,0 +1,229 @@
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+type TrainInKube struct {
+	metav1.TypeMeta `json:",inline"`
+
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec TrainInKubeSpec `json:"spec"`
+
+	Status TrainInKubeStatus `json:"status,omitempty"`
+}
+
+type TrainInKubeSpec struct {
+	Epochs          int32 `json:"epochs"`
+	BatchSize       int32 `json:"batchSize"`
+	NumberOfSamples int32 `json:"numberOfSamples"`
+	// Workers is the number of data parallel workers each minibatch is split
+	// across. It defaults to 6 when left unset.
+	Workers int32 `json:"workers,omitempty"`
+
+	Model ModelSpec `json:"model,omitempty"`
+	Data  DataSpec  `json:"data,omitempty"`
+	// Stages overrides the container run by each of the jobs the operator
+	// creates.
+	Stages StagesSpec `json:"stages,omitempty"`
+	// StragglerPolicy keeps slow workers from stalling the minibatches. Every
+	// minibatch waits for all its workers when it is not set.
+	StragglerPolicy *StragglerPolicy `json:"stragglerPolicy,omitempty"`
+	// WorkerMode is either Jobs, where every minibatch runs its own jobs, or
+	// Persistent, where the workers run once for the whole run and are driven
+	// by the operator from one minibatch to the next. It defaults to Jobs.
+	WorkerMode string `json:"workerMode,omitempty"`
+	// ParameterServer deploys a parameter server for the run, which the
+	// workers push their gradients to and pull the weights from, in place of
+	// exchanging them through files on the storage volume.
+	ParameterServer *ParameterServerSpec `json:"parameterServer,omitempty"`
+}
+
+// Worker modes of a run.
+const (
+	WorkerModeJobs       = "Jobs"
+	WorkerModePersistent = "Persistent"
+)
+
+// ParameterServerSpec is the parameter server of a run. It averages the gradients
+// of every minibatch into the weights itself, so the aggregate stage only runs
+// once, to save the trained weights into the model at the end of the run.
+type ParameterServerSpec struct {
+	// Image of the parameter server, built from cmd/parameterserver. It
+	// defaults to the image the operator is configured with.
+	Image           string            `json:"image,omitempty"`
+	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
+	// LearningRate of the gradient descent applied to the weights, as a
+	// decimal number. It defaults to 0.01.
+	LearningRate string                      `json:"learningRate,omitempty"`
+	Resources    corev1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// StragglerPolicy keeps slow workers from stalling every minibatch. Exactly one
+// of its fields has to be set.
+type StragglerPolicy struct {
+	// MinWorkers moves the minibatch on to the aggregation as soon as that
+	// many workers finished. The other workers are stopped, and only the
+	// gradients of the workers that finished are averaged.
+	MinWorkers *int32 `json:"minWorkers,omitempty"`
+	// Backup starts a backup copy of the workers that are slower than the
+	// others, and keeps the gradients of whichever copy finishes first.
+	Backup *BackupWorkersPolicy `json:"backup,omitempty"`
+}
+
+// BackupWorkersPolicy sets when a worker is slow enough to get a backup copy.
+type BackupWorkersPolicy struct {
+	// Percentile of the workers of the minibatch that have to finish before
+	// backups are started. A worker still running for longer than it took
+	// that percentile of the workers to finish gets a backup copy. It is
+	// between 1 and 99, and defaults to 75.
+	Percentile int32 `json:"percentile,omitempty"`
+}
+
+// ModelSpec is the image the model is built from.
+type ModelSpec struct {
+	Image           string            `json:"image,omitempty"`
+	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
+}
+
+// DataSpec is where the jobs of a run find the dataset and keep the model. The
+// locations are relative to the root of the storage volume.
+type DataSpec struct {
+	// Storage is the volume shared by all the jobs of the run. It defaults to
+	// a HostPath volume at /data.
+	Storage                     StorageSpec `json:"storage,omitempty"`
+	PreprocessedDatasetLocation string      `json:"preprocessedDatasetLocation,omitempty"`
+	SplitDatasetLocation        string      `json:"splitDatasetLocation,omitempty"`
+	ModelsLocation              string      `json:"modelsLocation,omitempty"`
+}
+
+// StorageSpec is the volume the jobs of a run exchange the dataset, the model
+// and the gradients through. At most one source can be set.
+type StorageSpec struct {
+	HostPath              *corev1.HostPathVolumeSource              `json:"hostPath,omitempty"`
+	PersistentVolumeClaim *corev1.PersistentVolumeClaimVolumeSource `json:"persistentVolumeClaim,omitempty"`
+	NFS                   *corev1.NFSVolumeSource                   `json:"nfs,omitempty"`
+	CSI                   *corev1.CSIVolumeSource                   `json:"csi,omitempty"`
+}
+
+// StagesSpec holds the container settings for each stage of a training run.
+type StagesSpec struct {
+	Build     StageSpec `json:"build,omitempty"`
+	Split     StageSpec `json:"split,omitempty"`
+	Train     StageSpec `json:"train,omitempty"`
+	Aggregate StageSpec `json:"aggregate,omitempty"`
+}
+
+// StageSpec describes the container run by the jobs of a single stage. Fields
+// left empty fall back to the operator defaults.
+type StageSpec struct {
+	Image           string            `json:"image,omitempty"`
+	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
+	Command         []string          `json:"command,omitempty"`
+	Args            []string          `json:"args,omitempty"`
+	// Env is added to the environment the operator sets for the stage, and
+	// takes precedence over it on conflicting names.
+	Env []corev1.EnvVar `json:"env,omitempty"`
+	// Resources, including extended resources such as nvidia.com/gpu, and the
+	// scheduling constraints of the pods of the stage.
+	Resources         corev1.ResourceRequirements `json:"resources,omitempty"`
+	NodeSelector      map[string]string           `json:"nodeSelector,omitempty"`
+	Tolerations       []corev1.Toleration         `json:"tolerations,omitempty"`
+	Affinity          *corev1.Affinity            `json:"affinity,omitempty"`
+	PriorityClassName string                      `json:"priorityClassName,omitempty"`
+
+	// RetryPolicy controls how the failed jobs of the stage are retried.
+	RetryPolicy RetryPolicy `json:"retryPolicy,omitempty"`
+}
+
+// RetryPolicy controls how the failures of the jobs of a stage are handled.
+// Failed pods are first retried by the job itself, up to BackoffLimit times.
+// Once a job failed, the operator runs it again up to Retries times, waiting
+// Backoff before the first retry and twice as long before each following one.
+// Only the jobs that failed are run again, so the workers of a minibatch that
+// succeeded keep their gradients.
+type RetryPolicy struct {
+	// Retries is the number of times the operator runs the failed jobs of the
+	// stage again for the same step before failing the run. It defaults to 3
+	// for the train stage, so that a lost worker only recomputes its shard,
+	// and to 0 for the other stages.
+	Retries *int32 `json:"retries,omitempty"`
+	// Backoff is the delay before the first retry by the operator. It
+	// defaults to 10s and is doubled on each following retry, up to 5m.
+	Backoff *metav1.Duration `json:"backoff,omitempty"`
+	// BackoffLimit is the number of times a failed pod is retried by its job
+	// before the job fails. It defaults to the Kubernetes default of 6.
+	BackoffLimit *int32 `json:"backoffLimit,omitempty"`
+	// ActiveDeadlineSeconds is the time a job of the stage can run for, pod
+	// retries included, before it fails.
+	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"`
+	// RetriableExitCodes are the exit codes of the container that are worth
+	// retrying. When set, every other non-zero exit code is fatal.
+	RetriableExitCodes []int32 `json:"retriableExitCodes,omitempty"`
+	// FatalExitCodes are the exit codes of the container that fail the job
+	// right away, without any retry by the job or by the operator.
+	FatalExitCodes []int32 `json:"fatalExitCodes,omitempty"`
+}
+
+// TrainInKubePhase is the stage a training run is in.
+type TrainInKubePhase string
+
+const (
+	PhasePending       TrainInKubePhase = "Pending"
+	PhaseBuildingModel TrainInKubePhase = "BuildingModel"
+	PhaseSplittingData TrainInKubePhase = "SplittingData"
+	PhaseTraining      TrainInKubePhase = "Training"
+	PhaseSucceeded     TrainInKubePhase = "Succeeded"
+	PhaseFailed        TrainInKubePhase = "Failed"
+)
+
+// Condition types reported in the status of a TrainInKube.
+const (
+	ConditionModelBuilt = "ModelBuilt"
+	ConditionDataSplit  = "DataSplit"
+	ConditionComplete   = "Complete"
+	ConditionFailed     = "Failed"
+)
+
+type TrainInKubeStatus struct {
+	Phase      TrainInKubePhase   `json:"phase,omitempty"`
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	Workers    int32              `json:"workers,omitempty"`
+	// Epoch and MiniBatch are the 1-based position of the step being trained.
+	Epoch          int32        `json:"epoch,omitempty"`
+	MiniBatch      int32        `json:"miniBatch,omitempty"`
+	StartTime      *metav1.Time `json:"startTime,omitempty"`
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// ObservedGeneration is the latest generation of the spec the run caught
+	// up with, by starting over, by applying the change in place, or by
+	// failing for it.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Images are the images of the stages left to the operator, resolved when
+	// the run starts. A reload of the config of the operator only changes the
+	// images of the runs started afterwards.
+	Images *StageImages `json:"images,omitempty"`
+}
+
+// StageImages are the images the operator uses for the stages of a run.
+type StageImages struct {
+	Build           string `json:"build,omitempty"`
+	Split           string `json:"split,omitempty"`
+	Train           string `json:"train,omitempty"`
+	Aggregate       string `json:"aggregate,omitempty"`
+	ParameterServer string `json:"parameterServer,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+type TrainInKubeList struct {
+	metav1.TypeMeta `json:",inline"`
+
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []TrainInKube `json:"items"`
+}
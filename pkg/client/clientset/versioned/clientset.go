@@ -23,6 +23,7 @@ import (
 	"net/http"
 
 	foov1alpha1 "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/client/clientset/versioned/typed/trainink8s/v1alpha1"
+	foov1beta1 "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/client/clientset/versioned/typed/trainink8s/v1beta1"
 	discovery "k8s.io/client-go/discovery"
 	rest "k8s.io/client-go/rest"
 	flowcontrol "k8s.io/client-go/util/flowcontrol"
@@ -31,12 +32,14 @@ import (
 type Interface interface {
 	Discovery() discovery.DiscoveryInterface
 	FooV1alpha1() foov1alpha1.FooV1alpha1Interface
+	FooV1beta1() foov1beta1.FooV1beta1Interface
 }
 
 // Clientset contains the clients for groups.
 type Clientset struct {
 	*discovery.DiscoveryClient
 	fooV1alpha1 *foov1alpha1.FooV1alpha1Client
+	fooV1beta1  *foov1beta1.FooV1beta1Client
 }
 
 // FooV1alpha1 retrieves the FooV1alpha1Client
@@ -44,6 +47,11 @@ func (c *Clientset) FooV1alpha1() foov1alpha1.FooV1alpha1Interface {
 	return c.fooV1alpha1
 }
 
+// FooV1beta1 retrieves the FooV1beta1Client
+func (c *Clientset) FooV1beta1() foov1beta1.FooV1beta1Interface {
+	return c.fooV1beta1
+}
+
 // Discovery retrieves the DiscoveryClient
 func (c *Clientset) Discovery() discovery.DiscoveryInterface {
 	if c == nil {
@@ -92,6 +100,10 @@ func NewForConfigAndClient(c *rest.Config, httpClient *http.Client) (*Clientset,
 	if err != nil {
 		return nil, err
 	}
+	cs.fooV1beta1, err = foov1beta1.NewForConfigAndClient(&configShallowCopy, httpClient)
+	if err != nil {
+		return nil, err
+	}
 
 	cs.DiscoveryClient, err = discovery.NewDiscoveryClientForConfigAndClient(&configShallowCopy, httpClient)
 	if err != nil {
@@ -114,6 +126,7 @@ func NewForConfigOrDie(c *rest.Config) *Clientset {
 func New(c rest.Interface) *Clientset {
 	var cs Clientset
 	cs.fooV1alpha1 = foov1alpha1.New(c)
+	cs.fooV1beta1 = foov1beta1.New(c)
 
 	cs.DiscoveryClient = discovery.NewDiscoveryClient(c)
 	return &cs
@@ -22,6 +22,8 @@ import (
 	clientset "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/client/clientset/versioned"
 	foov1alpha1 "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/client/clientset/versioned/typed/trainink8s/v1alpha1"
 	fakefoov1alpha1 "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/client/clientset/versioned/typed/trainink8s/v1alpha1/fake"
+	foov1beta1 "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/client/clientset/versioned/typed/trainink8s/v1beta1"
+	fakefoov1beta1 "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/client/clientset/versioned/typed/trainink8s/v1beta1/fake"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/discovery"
@@ -83,3 +85,8 @@ var (
 func (c *Clientset) FooV1alpha1() foov1alpha1.FooV1alpha1Interface {
 	return &fakefoov1alpha1.FakeFooV1alpha1{Fake: &c.Fake}
 }
+
+// FooV1beta1 retrieves the FooV1beta1Client
+func (c *Clientset) FooV1beta1() foov1beta1.FooV1beta1Interface {
+	return &fakefoov1beta1.FakeFooV1beta1{Fake: &c.Fake}
+}
@@ -0,0 +1,141 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Code generated by client-gen. DO NOT EDIT.
+
+package fake
+
+import (
+	"context"
+
+	v1beta1 "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/apis/trainink8s/v1beta1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	labels "k8s.io/apimachinery/pkg/labels"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	testing "k8s.io/client-go/testing"
+)
+
+// FakeTrainInKubes implements TrainInKubeInterface
+type FakeTrainInKubes struct {
+	Fake *FakeFooV1beta1
+	ns   string
+}
+
+var traininkubesResource = v1beta1.SchemeGroupVersion.WithResource("traininkubes")
+
+var traininkubesKind = v1beta1.SchemeGroupVersion.WithKind("TrainInKube")
+
+// Get takes name of the trainInKube, and returns the corresponding trainInKube object, and an error if there is any.
+func (c *FakeTrainInKubes) Get(ctx context.Context, name string, options v1.GetOptions) (result *v1beta1.TrainInKube, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewGetAction(traininkubesResource, c.ns, name), &v1beta1.TrainInKube{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1beta1.TrainInKube), err
+}
+
+// List takes label and field selectors, and returns the list of TrainInKubes that match those selectors.
+func (c *FakeTrainInKubes) List(ctx context.Context, opts v1.ListOptions) (result *v1beta1.TrainInKubeList, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewListAction(traininkubesResource, traininkubesKind, c.ns, opts), &v1beta1.TrainInKubeList{})
+
+	if obj == nil {
+		return nil, err
+	}
+
+	label, _, _ := testing.ExtractFromListOptions(opts)
+	if label == nil {
+		label = labels.Everything()
+	}
+	list := &v1beta1.TrainInKubeList{ListMeta: obj.(*v1beta1.TrainInKubeList).ListMeta}
+	for _, item := range obj.(*v1beta1.TrainInKubeList).Items {
+		if label.Matches(labels.Set(item.Labels)) {
+			list.Items = append(list.Items, item)
+		}
+	}
+	return list, err
+}
+
+// Watch returns a watch.Interface that watches the requested trainInKubes.
+func (c *FakeTrainInKubes) Watch(ctx context.Context, opts v1.ListOptions) (watch.Interface, error) {
+	return c.Fake.
+		InvokesWatch(testing.NewWatchAction(traininkubesResource, c.ns, opts))
+
+}
+
+// Create takes the representation of a trainInKube and creates it.  Returns the server's representation of the trainInKube, and an error, if there is any.
+func (c *FakeTrainInKubes) Create(ctx context.Context, trainInKube *v1beta1.TrainInKube, opts v1.CreateOptions) (result *v1beta1.TrainInKube, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewCreateAction(traininkubesResource, c.ns, trainInKube), &v1beta1.TrainInKube{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1beta1.TrainInKube), err
+}
+
+// Update takes the representation of a trainInKube and updates it. Returns the server's representation of the trainInKube, and an error, if there is any.
+func (c *FakeTrainInKubes) Update(ctx context.Context, trainInKube *v1beta1.TrainInKube, opts v1.UpdateOptions) (result *v1beta1.TrainInKube, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateAction(traininkubesResource, c.ns, trainInKube), &v1beta1.TrainInKube{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1beta1.TrainInKube), err
+}
+
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+func (c *FakeTrainInKubes) UpdateStatus(ctx context.Context, trainInKube *v1beta1.TrainInKube, opts v1.UpdateOptions) (*v1beta1.TrainInKube, error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateSubresourceAction(traininkubesResource, "status", c.ns, trainInKube), &v1beta1.TrainInKube{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1beta1.TrainInKube), err
+}
+
+// Delete takes name of the trainInKube and deletes it. Returns an error if one occurs.
+func (c *FakeTrainInKubes) Delete(ctx context.Context, name string, opts v1.DeleteOptions) error {
+	_, err := c.Fake.
+		Invokes(testing.NewDeleteActionWithOptions(traininkubesResource, c.ns, name, opts), &v1beta1.TrainInKube{})
+
+	return err
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *FakeTrainInKubes) DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error {
+	action := testing.NewDeleteCollectionAction(traininkubesResource, c.ns, listOpts)
+
+	_, err := c.Fake.Invokes(action, &v1beta1.TrainInKubeList{})
+	return err
+}
+
+// Patch applies the patch and returns the patched trainInKube.
+func (c *FakeTrainInKubes) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts v1.PatchOptions, subresources ...string) (result *v1beta1.TrainInKube, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewPatchSubresourceAction(traininkubesResource, c.ns, name, pt, data, subresources...), &v1beta1.TrainInKube{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1beta1.TrainInKube), err
+}
@@ -0,0 +1,195 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Code generated by client-gen. DO NOT EDIT.
+
+package v1beta1
+
+import (
+	"context"
+	"time"
+
+	v1beta1 "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/apis/trainink8s/v1beta1"
+	scheme "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/client/clientset/versioned/scheme"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	rest "k8s.io/client-go/rest"
+)
+
+// TrainInKubesGetter has a method to return a TrainInKubeInterface.
+// A group's client should implement this interface.
+type TrainInKubesGetter interface {
+	TrainInKubes(namespace string) TrainInKubeInterface
+}
+
+// TrainInKubeInterface has methods to work with TrainInKube resources.
+type TrainInKubeInterface interface {
+	Create(ctx context.Context, trainInKube *v1beta1.TrainInKube, opts v1.CreateOptions) (*v1beta1.TrainInKube, error)
+	Update(ctx context.Context, trainInKube *v1beta1.TrainInKube, opts v1.UpdateOptions) (*v1beta1.TrainInKube, error)
+	UpdateStatus(ctx context.Context, trainInKube *v1beta1.TrainInKube, opts v1.UpdateOptions) (*v1beta1.TrainInKube, error)
+	Delete(ctx context.Context, name string, opts v1.DeleteOptions) error
+	DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error
+	Get(ctx context.Context, name string, opts v1.GetOptions) (*v1beta1.TrainInKube, error)
+	List(ctx context.Context, opts v1.ListOptions) (*v1beta1.TrainInKubeList, error)
+	Watch(ctx context.Context, opts v1.ListOptions) (watch.Interface, error)
+	Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts v1.PatchOptions, subresources ...string) (result *v1beta1.TrainInKube, err error)
+	TrainInKubeExpansion
+}
+
+// trainInKubes implements TrainInKubeInterface
+type trainInKubes struct {
+	client rest.Interface
+	ns     string
+}
+
+// newTrainInKubes returns a TrainInKubes
+func newTrainInKubes(c *FooV1beta1Client, namespace string) *trainInKubes {
+	return &trainInKubes{
+		client: c.RESTClient(),
+		ns:     namespace,
+	}
+}
+
+// Get takes name of the trainInKube, and returns the corresponding trainInKube object, and an error if there is any.
+func (c *trainInKubes) Get(ctx context.Context, name string, options v1.GetOptions) (result *v1beta1.TrainInKube, err error) {
+	result = &v1beta1.TrainInKube{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("traininkubes").
+		Name(name).
+		VersionedParams(&options, scheme.ParameterCodec).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// List takes label and field selectors, and returns the list of TrainInKubes that match those selectors.
+func (c *trainInKubes) List(ctx context.Context, opts v1.ListOptions) (result *v1beta1.TrainInKubeList, err error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	result = &v1beta1.TrainInKubeList{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("traininkubes").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Watch returns a watch.Interface that watches the requested trainInKubes.
+func (c *trainInKubes) Watch(ctx context.Context, opts v1.ListOptions) (watch.Interface, error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	opts.Watch = true
+	return c.client.Get().
+		Namespace(c.ns).
+		Resource("traininkubes").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Watch(ctx)
+}
+
+// Create takes the representation of a trainInKube and creates it.  Returns the server's representation of the trainInKube, and an error, if there is any.
+func (c *trainInKubes) Create(ctx context.Context, trainInKube *v1beta1.TrainInKube, opts v1.CreateOptions) (result *v1beta1.TrainInKube, err error) {
+	result = &v1beta1.TrainInKube{}
+	err = c.client.Post().
+		Namespace(c.ns).
+		Resource("traininkubes").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(trainInKube).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Update takes the representation of a trainInKube and updates it. Returns the server's representation of the trainInKube, and an error, if there is any.
+func (c *trainInKubes) Update(ctx context.Context, trainInKube *v1beta1.TrainInKube, opts v1.UpdateOptions) (result *v1beta1.TrainInKube, err error) {
+	result = &v1beta1.TrainInKube{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("traininkubes").
+		Name(trainInKube.Name).
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(trainInKube).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+func (c *trainInKubes) UpdateStatus(ctx context.Context, trainInKube *v1beta1.TrainInKube, opts v1.UpdateOptions) (result *v1beta1.TrainInKube, err error) {
+	result = &v1beta1.TrainInKube{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("traininkubes").
+		Name(trainInKube.Name).
+		SubResource("status").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(trainInKube).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Delete takes name of the trainInKube and deletes it. Returns an error if one occurs.
+func (c *trainInKubes) Delete(ctx context.Context, name string, opts v1.DeleteOptions) error {
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("traininkubes").
+		Name(name).
+		Body(&opts).
+		Do(ctx).
+		Error()
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *trainInKubes) DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error {
+	var timeout time.Duration
+	if listOpts.TimeoutSeconds != nil {
+		timeout = time.Duration(*listOpts.TimeoutSeconds) * time.Second
+	}
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("traininkubes").
+		VersionedParams(&listOpts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Body(&opts).
+		Do(ctx).
+		Error()
+}
+
+// Patch applies the patch and returns the patched trainInKube.
+func (c *trainInKubes) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts v1.PatchOptions, subresources ...string) (result *v1beta1.TrainInKube, err error) {
+	result = &v1beta1.TrainInKube{}
+	err = c.client.Patch(pt).
+		Namespace(c.ns).
+		Resource("traininkubes").
+		Name(name).
+		SubResource(subresources...).
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(data).
+		Do(ctx).
+		Into(result)
+	return
+}
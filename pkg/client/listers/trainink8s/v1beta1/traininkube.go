@@ -0,0 +1,99 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Code generated by lister-gen. DO NOT EDIT.
+
+package v1beta1
+
+import (
+	v1beta1 "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/apis/trainink8s/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+// TrainInKubeLister helps list TrainInKubes.
+// All objects returned here must be treated as read-only.
+type TrainInKubeLister interface {
+	// List lists all TrainInKubes in the indexer.
+	// Objects returned here must be treated as read-only.
+	List(selector labels.Selector) (ret []*v1beta1.TrainInKube, err error)
+	// TrainInKubes returns an object that can list and get TrainInKubes.
+	TrainInKubes(namespace string) TrainInKubeNamespaceLister
+	TrainInKubeListerExpansion
+}
+
+// trainInKubeLister implements the TrainInKubeLister interface.
+type trainInKubeLister struct {
+	indexer cache.Indexer
+}
+
+// NewTrainInKubeLister returns a new TrainInKubeLister.
+func NewTrainInKubeLister(indexer cache.Indexer) TrainInKubeLister {
+	return &trainInKubeLister{indexer: indexer}
+}
+
+// List lists all TrainInKubes in the indexer.
+func (s *trainInKubeLister) List(selector labels.Selector) (ret []*v1beta1.TrainInKube, err error) {
+	err = cache.ListAll(s.indexer, selector, func(m interface{}) {
+		ret = append(ret, m.(*v1beta1.TrainInKube))
+	})
+	return ret, err
+}
+
+// TrainInKubes returns an object that can list and get TrainInKubes.
+func (s *trainInKubeLister) TrainInKubes(namespace string) TrainInKubeNamespaceLister {
+	return trainInKubeNamespaceLister{indexer: s.indexer, namespace: namespace}
+}
+
+// TrainInKubeNamespaceLister helps list and get TrainInKubes.
+// All objects returned here must be treated as read-only.
+type TrainInKubeNamespaceLister interface {
+	// List lists all TrainInKubes in the indexer for a given namespace.
+	// Objects returned here must be treated as read-only.
+	List(selector labels.Selector) (ret []*v1beta1.TrainInKube, err error)
+	// Get retrieves the TrainInKube from the indexer for a given namespace and name.
+	// Objects returned here must be treated as read-only.
+	Get(name string) (*v1beta1.TrainInKube, error)
+	TrainInKubeNamespaceListerExpansion
+}
+
+// trainInKubeNamespaceLister implements the TrainInKubeNamespaceLister
+// interface.
+type trainInKubeNamespaceLister struct {
+	indexer   cache.Indexer
+	namespace string
+}
+
+// List lists all TrainInKubes in the indexer for a given namespace.
+func (s trainInKubeNamespaceLister) List(selector labels.Selector) (ret []*v1beta1.TrainInKube, err error) {
+	err = cache.ListAllByNamespace(s.indexer, s.namespace, selector, func(m interface{}) {
+		ret = append(ret, m.(*v1beta1.TrainInKube))
+	})
+	return ret, err
+}
+
+// Get retrieves the TrainInKube from the indexer for a given namespace and name.
+func (s trainInKubeNamespaceLister) Get(name string) (*v1beta1.TrainInKube, error) {
+	obj, exists, err := s.indexer.GetByKey(s.namespace + "/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.NewNotFound(v1beta1.Resource("traininkube"), name)
+	}
+	return obj.(*v1beta1.TrainInKube), nil
+}
@@ -0,0 +1,228 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ChinmayaSharma-hue/TrainInKubes/pkg/train"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+// Config holds the settings of the operator. It is read from an optional YAML
+// file, and every field can be overridden by its command-line flag.
+type Config struct {
+	// Kubeconfig is the path of the kubeconfig used out of the cluster. The
+	// in-cluster configuration is used when it is empty and the operator runs
+	// in a pod.
+	Kubeconfig string `json:"kubeconfig,omitempty"`
+	// Context is the kubeconfig context to use, the current one when empty.
+	Context string `json:"context,omitempty"`
+	// QPS and Burst limit the requests of the operator to the API server.
+	QPS   float32 `json:"qps,omitempty"`
+	Burst int     `json:"burst,omitempty"`
+
+	// Namespaces lists the namespaces to handle TrainInKubes in, all of them
+	// when empty.
+	Namespaces []string `json:"namespaces,omitempty"`
+	// NamespaceSelector is a label selector restricting the namespaces.
+	NamespaceSelector string `json:"namespaceSelector,omitempty"`
+
+	// Workers is the number of TrainInKubes reconciled at the same time.
+	Workers int `json:"workers,omitempty"`
+	// ResyncPeriod is how often every TrainInKube is reconciled again.
+	ResyncPeriod metav1.Duration `json:"resyncPeriod,omitempty"`
+
+	// MetricsAddr is the address the metrics are served on, they are not
+	// served when it is empty.
+	MetricsAddr string `json:"metricsAddr,omitempty"`
+	// HealthAddr is the address the liveness and readiness probes are served
+	// on, they are not served when it is empty.
+	HealthAddr string `json:"healthAddr,omitempty"`
+	// CoordinatorAddr is the address the persistent workers are coordinated
+	// on, runs with persistent workers fail when it is empty.
+	CoordinatorAddr string `json:"coordinatorAddr,omitempty"`
+	// CoordinatorURL is the URL the persistent workers reach the coordinator
+	// at. It defaults to the tikoperator-coordinator Service in the namespace
+	// of the operator.
+	CoordinatorURL string `json:"coordinatorURL,omitempty"`
+
+	// Images are used by the stages that do not set an image.
+	Images train.Images `json:"images,omitempty"`
+
+	Log            LogConfig            `json:"log,omitempty"`
+	LeaderElection LeaderElectionConfig `json:"leaderElection,omitempty"`
+}
+
+type LogConfig struct {
+	// Level is one of trace, debug, info, warning, error.
+	Level string `json:"level,omitempty"`
+	// Format is either text or json.
+	Format string `json:"format,omitempty"`
+}
+
+type LeaderElectionConfig struct {
+	Enabled bool `json:"enabled"`
+	// Namespace of the Lease, the namespace of the operator when empty.
+	Namespace string `json:"namespace,omitempty"`
+	// ID is the name of the Lease.
+	ID string `json:"id,omitempty"`
+}
+
+// Default returns the settings used for everything the file and the flags do
+// not set.
+func Default() Config {
+	return Config{
+		QPS:             20,
+		Burst:           30,
+		Workers:         4,
+		ResyncPeriod:    metav1.Duration{Duration: 10 * time.Second},
+		MetricsAddr:     ":8080",
+		HealthAddr:      ":8081",
+		CoordinatorAddr: ":8082",
+		Images:          train.BuiltinImages(),
+		Log: LogConfig{
+			Level:  "debug",
+			Format: "text",
+		},
+		LeaderElection: LeaderElectionConfig{
+			Enabled: true,
+			ID:      "tikoperator",
+		},
+	}
+}
+
+// Parse reads the config file given by the --config flag, if any, and applies
+// the other flags on top of it. It also returns the path of the config file.
+func Parse(name string, args []string) (Config, string, error) {
+	// The flags are parsed a first time only to find the config file
+	discard := Default()
+	fs := newFlagSet(name, &discard)
+	fs.SetOutput(io.Discard)
+	path := fs.String("config", "", "")
+	err := fs.Parse(args)
+	if err != nil && !errors.Is(err, flag.ErrHelp) {
+		return Config{}, "", err
+	}
+
+	config := Default()
+	if *path != "" {
+		config, err = Load(*path)
+		if err != nil {
+			return Config{}, "", err
+		}
+	}
+
+	fs = newFlagSet(name, &config)
+	fs.String("config", "", "Path of the YAML config file of the operator")
+	err = fs.Parse(args)
+	if err != nil {
+		return Config{}, "", err
+	}
+
+	return config, *path, config.Validate()
+}
+
+// Load reads the config file, using the defaults for the fields it leaves out.
+func Load(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("Error while reading the config file: %v", err)
+	}
+
+	config := Default()
+	err = yaml.UnmarshalStrict(data, &config)
+	if err != nil {
+		return Config{}, fmt.Errorf("Error while parsing the config file %s: %v", path, err)
+	}
+	return config, nil
+}
+
+// Validate checks the values that would otherwise only fail once in use.
+func (c Config) Validate() error {
+	if c.Workers < 1 {
+		return fmt.Errorf("workers must be at least 1, got %d", c.Workers)
+	}
+	if c.ResyncPeriod.Duration < 0 {
+		return fmt.Errorf("resyncPeriod cannot be negative, got %s", c.ResyncPeriod.Duration)
+	}
+	if c.QPS <= 0 || c.Burst <= 0 {
+		return fmt.Errorf("qps and burst must be greater than 0")
+	}
+	switch c.Log.Level {
+	case "trace", "debug", "info", "warn", "warning", "error":
+	default:
+		return fmt.Errorf("log level must be trace, debug, info, warning or error, got %q", c.Log.Level)
+	}
+	if c.Log.Format != "text" && c.Log.Format != "json" {
+		return fmt.Errorf("log format must be text or json, got %q", c.Log.Format)
+	}
+	if _, err := labels.Parse(c.NamespaceSelector); err != nil {
+		return fmt.Errorf("invalid namespace selector: %v", err)
+	}
+	return nil
+}
+
+// Selector returns the parsed namespace selector.
+func (c Config) Selector() labels.Selector {
+	selector, err := labels.Parse(c.NamespaceSelector)
+	if err != nil {
+		return labels.Everything()
+	}
+	return selector
+}
+
+func newFlagSet(name string, c *Config) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+
+	fs.StringVar(&c.Kubeconfig, "kubeconfig", c.Kubeconfig, "Path of the kubeconfig used when running out of the cluster")
+	fs.StringVar(&c.Context, "context", c.Context, "Context of the kubeconfig to use, the current context by default")
+	fs.Func("qps", fmt.Sprintf("Requests per second to the API server (default %v)", c.QPS), func(value string) error {
+		var qps float32
+		_, err := fmt.Sscan(value, &qps)
+		c.QPS = qps
+		return err
+	})
+	fs.IntVar(&c.Burst, "burst", c.Burst, "Burst of requests to the API server")
+
+	fs.Func("namespaces", "Comma separated list of the namespaces to handle TrainInKubes in, all namespaces when empty", func(value string) error {
+		c.Namespaces = nil
+		for _, namespace := range strings.Split(value, ",") {
+			if namespace = strings.TrimSpace(namespace); namespace != "" {
+				c.Namespaces = append(c.Namespaces, namespace)
+			}
+		}
+		return nil
+	})
+	fs.StringVar(&c.NamespaceSelector, "namespace-selector", c.NamespaceSelector, "Label selector restricting the namespaces to handle TrainInKubes in")
+
+	fs.IntVar(&c.Workers, "workers", c.Workers, "Number of TrainInKubes reconciled at the same time")
+	fs.DurationVar(&c.ResyncPeriod.Duration, "resync-period", c.ResyncPeriod.Duration, "How often every TrainInKube is reconciled again")
+
+	fs.StringVar(&c.MetricsAddr, "metrics-addr", c.MetricsAddr, "Address the metrics are served on, they are not served when empty")
+	fs.StringVar(&c.HealthAddr, "health-addr", c.HealthAddr, "Address the /healthz and /readyz probes are served on, they are not served when empty")
+	fs.StringVar(&c.CoordinatorAddr, "coordinator-addr", c.CoordinatorAddr, "Address the persistent workers are coordinated on, they are not supported when empty")
+	fs.StringVar(&c.CoordinatorURL, "coordinator-url", c.CoordinatorURL, "URL the persistent workers reach the coordinator at, the tikoperator-coordinator Service by default")
+
+	fs.StringVar(&c.Images.Build, "build-image", c.Images.Build, "Image of the build stage when neither the stage nor spec.modelImage set one")
+	fs.StringVar(&c.Images.Split, "split-image", c.Images.Split, "Image of the split stage when the stage does not set one")
+	fs.StringVar(&c.Images.Train, "train-image", c.Images.Train, "Image of the train stage when the stage does not set one")
+	fs.StringVar(&c.Images.Aggregate, "aggregate-image", c.Images.Aggregate, "Image of the aggregate stage when the stage does not set one")
+	fs.StringVar(&c.Images.ParameterServer, "parameter-server-image", c.Images.ParameterServer, "Image of the parameter server when the TrainInKube does not set one")
+
+	fs.StringVar(&c.Log.Level, "log-level", c.Log.Level, "Log level: trace, debug, info, warning or error")
+	fs.StringVar(&c.Log.Format, "log-format", c.Log.Format, "Log format: text or json")
+
+	fs.BoolVar(&c.LeaderElection.Enabled, "leader-elect", c.LeaderElection.Enabled, "Elect a leader among the replicas of the operator, so that only one handles the TrainInKubes")
+	fs.StringVar(&c.LeaderElection.Namespace, "leader-election-namespace", c.LeaderElection.Namespace, "Namespace of the Lease used for the leader election, the namespace of the operator by default")
+	fs.StringVar(&c.LeaderElection.ID, "leader-election-id", c.LeaderElection.ID, "Name of the Lease used for the leader election")
+
+	return fs
+}
@@ -0,0 +1,176 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ChinmayaSharma-hue/TrainInKubes/pkg/train"
+)
+
+// writeConfig writes the config file in a temporary directory and returns its
+// path.
+func writeConfig(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("Error while writing the config file: %v", err)
+	}
+	return path
+}
+
+func TestParseDefaults(t *testing.T) {
+	config, path, err := Parse("tikoperator", nil)
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+	if path != "" {
+		t.Errorf("path = %q, want no config file", path)
+	}
+	if !reflect.DeepEqual(config, Default()) {
+		t.Errorf("Parse() = %+v, want the defaults %+v", config, Default())
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := writeConfig(t, `
+namespaces: [team-a, team-b]
+workers: 8
+resyncPeriod: 1m
+images:
+  train: trainjob:v2
+log:
+  format: json
+`)
+
+	config, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+
+	want := Default()
+	want.Namespaces = []string{"team-a", "team-b"}
+	want.Workers = 8
+	want.ResyncPeriod.Duration = time.Minute
+	want.Images.Train = "trainjob:v2"
+	want.Log.Format = "json"
+	if !reflect.DeepEqual(config, want) {
+		t.Errorf("Load() = %+v, want %+v", config, want)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+	}{
+		{name: "missing file", path: filepath.Join(t.TempDir(), "missing.yaml")},
+		{name: "unknown field", path: writeConfig(t, "worker: 8\n")},
+		{name: "wrong type", path: writeConfig(t, "workers: many\n")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Load(tt.path); err == nil {
+				t.Errorf("Load() succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(*Config)
+		wantErr string
+	}{
+		{name: "defaults", change: func(c *Config) {}},
+		{name: "no workers", change: func(c *Config) { c.Workers = 0 }, wantErr: "workers"},
+		{name: "negative resync period", change: func(c *Config) { c.ResyncPeriod.Duration = -time.Second }, wantErr: "resyncPeriod"},
+		{name: "no qps", change: func(c *Config) { c.QPS = 0 }, wantErr: "qps"},
+		{name: "unknown log level", change: func(c *Config) { c.Log.Level = "verbose" }, wantErr: "log level"},
+		{name: "unknown log format", change: func(c *Config) { c.Log.Format = "xml" }, wantErr: "log format"},
+		{name: "invalid namespace selector", change: func(c *Config) { c.NamespaceSelector = "a in (b" }, wantErr: "namespace selector"},
+		{name: "namespace selector", change: func(c *Config) { c.NamespaceSelector = "trainink8s.com/enabled=true" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Default()
+			tt.change(&config)
+
+			err := config.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want an error about %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseFlagsOverFile(t *testing.T) {
+	path := writeConfig(t, `
+workers: 8
+namespaces: [team-a]
+images:
+  build: buildjob:v2
+  train: trainjob:v2
+leaderElection:
+  enabled: true
+`)
+
+	config, gotPath, err := Parse("tikoperator", []string{
+		"--config", path,
+		"--workers", "2",
+		"--train-image", "trainjob:v3",
+		"--namespaces", "team-b, team-c",
+		"--leader-elect=false",
+	})
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+	if gotPath != path {
+		t.Errorf("path = %q, want %q", gotPath, path)
+	}
+
+	if config.Workers != 2 {
+		t.Errorf("Workers = %d, want the flag value 2", config.Workers)
+	}
+	if !reflect.DeepEqual(config.Namespaces, []string{"team-b", "team-c"}) {
+		t.Errorf("Namespaces = %v, want the flag value [team-b team-c]", config.Namespaces)
+	}
+	if config.LeaderElection.Enabled {
+		t.Errorf("LeaderElection.Enabled = true, want the flag value false")
+	}
+	wantImages := train.BuiltinImages()
+	wantImages.Build = "buildjob:v2"
+	wantImages.Train = "trainjob:v3"
+	if config.Images != wantImages {
+		t.Errorf("Images = %+v, want %+v", config.Images, wantImages)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "unknown flag", args: []string{"--worker", "2"}},
+		{name: "invalid value", args: []string{"--workers", "0"}},
+		{name: "invalid qps", args: []string{"--qps", "fast"}},
+		{name: "invalid file", args: []string{"--config", writeConfig(t, "log:\n  level: verbose\n")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := Parse("tikoperator", tt.args); err == nil {
+				t.Errorf("Parse(%v) succeeded, want an error", tt.args)
+			}
+		})
+	}
+}
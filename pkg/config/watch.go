@@ -0,0 +1,56 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"time"
+)
+
+// Watch checks the config file every interval until the context is done, and
+// calls onChange with the new config whenever the file changes. The flags are
+// applied again on top of the file, so they keep their precedence.
+func Watch(
+	ctx context.Context,
+	name string,
+	args []string,
+	path string,
+	interval time.Duration,
+	onChange func(Config),
+	onError func(error),
+) {
+	last, err := os.ReadFile(path)
+	if err != nil {
+		onError(err)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// ConfigMap volumes replace the file through a symlink, so the
+		// contents are compared rather than the modification time
+		data, err := os.ReadFile(path)
+		if err != nil {
+			onError(err)
+			continue
+		}
+		if bytes.Equal(data, last) {
+			continue
+		}
+		last = data
+
+		config, _, err := Parse(name, args)
+		if err != nil {
+			onError(err)
+			continue
+		}
+		onChange(config)
+	}
+}
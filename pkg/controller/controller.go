@@ -3,33 +3,75 @@ package controller
 import (
 	"context"
 	"errors"
+	"sync/atomic"
 	"time"
 
 	"github.com/gotway/gotway/pkg/log"
 
 	traininkubev1alpha1 "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/apis/trainink8s/v1alpha1"
 	traininkubev1alpha1clientset "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/client/clientset/versioned"
+	traininkubescheme "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/client/clientset/versioned/scheme"
 	traininkubev1alpha1informers "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/client/informers/externalversions"
+	"github.com/ChinmayaSharma-hue/TrainInKubes/pkg/coordinator"
+	"github.com/ChinmayaSharma-hue/TrainInKubes/pkg/train"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
 	kubeinformers "k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
 )
 
+// Options configure the controller.
+type Options struct {
+	// Namespaces selects the namespaces whose TrainInKubes are handled.
+	Namespaces Namespaces
+	// Workers is the number of TrainInKubes reconciled at the same time.
+	Workers int
+	// ResyncPeriod is how often every TrainInKube is reconciled again, which
+	// also picks up runs left behind by a missed event.
+	ResyncPeriod time.Duration
+	// Coordinator drives the persistent workers of the runs, which reach it
+	// at CoordinatorURL. Runs with persistent workers fail without it.
+	Coordinator    *coordinator.Server
+	CoordinatorURL string
+}
+
 type Controller struct {
-	kubeClientSet kubernetes.Interface
+	kubeClientSet        kubernetes.Interface
+	traininkubeClientSet traininkubev1alpha1clientset.Interface
 
 	traininkubeInformer cache.SharedIndexInformer
 	configmapInformer   cache.SharedIndexInformer
 	jobInformer         cache.SharedIndexInformer
 	nodeInformer        cache.SharedIndexInformer
+	namespaceInformer   cache.SharedIndexInformer
+
+	jobTracker *train.JobTracker
+
+	recorder record.EventRecorder
 
 	queue workqueue.RateLimitingInterface
 
-	namespace string
+	orchestrations *orchestrations
+
+	namespaces Namespaces
+	workers    int
+
+	coordinator    *coordinator.Server
+	coordinatorURL string
+
+	// synced is set once the caches of the informers are synced, and
+	// heartbeats tracks the workers, for the probes of the operator.
+	synced     atomic.Bool
+	heartbeats *heartbeats
 
 	logger log.Logger
 }
@@ -41,29 +83,34 @@ func (c *Controller) Run(ctx context.Context) error {
 	c.logger.Infof("Starting the controller...")
 
 	c.logger.Infof("Starting the informers...")
-	for _, i := range []cache.SharedIndexInformer{
+	informers := []cache.SharedIndexInformer{
 		c.traininkubeInformer,
+		c.configmapInformer,
 		c.jobInformer,
 		c.nodeInformer,
-	} {
+	}
+	if c.namespaceInformer != nil {
+		informers = append(informers, c.namespaceInformer)
+	}
+	synced := make([]cache.InformerSynced, 0, len(informers))
+	for _, i := range informers {
 		go i.Run(ctx.Done())
+		synced = append(synced, i.HasSynced)
 	}
 
 	c.logger.Infof("Waiting for the informers to sync...")
-	if !cache.WaitForCacheSync(ctx.Done(), []cache.InformerSynced{
-		c.traininkubeInformer.HasSynced,
-		c.jobInformer.HasSynced,
-		c.nodeInformer.HasSynced,
-	}...) {
+	if !cache.WaitForCacheSync(ctx.Done(), synced...) {
 		err := errors.New("Failed to wait for informers to sync")
 		utilruntime.HandleError(err)
 		return err
 	}
+	c.synced.Store(true)
 
-	c.logger.Infof("Starting 4 workers...")
-	for i := 0; i < 4; i++ {
+	c.logger.Infof("Starting %d workers...", c.workers)
+	for i := 0; i < c.workers; i++ {
+		worker := i
 		go wait.Until(func() {
-			c.runWorker(ctx)
+			c.runWorker(ctx, worker)
 		}, time.Second, ctx.Done())
 	}
 
@@ -72,62 +119,155 @@ func (c *Controller) Run(ctx context.Context) error {
 	<-ctx.Done()
 	c.logger.Infof("Shutting down the controller")
 
+	// Another replica may take over the runs as soon as this one returns, so
+	// the orchestrators have to be stopped first
+	c.orchestrations.stopAll()
+
 	return nil
 }
 
-func (c *Controller) addTrainInKube(obj interface{}) {
-	c.logger.Debugf("Adding TrainInKube")
+// enqueueTrainInKube queues the TrainInKube to be reconciled. Every change to a
+// TrainInKube, including the periodic resyncs, is queued, so that runs left
+// behind by a missed event are picked up again.
+func (c *Controller) enqueueTrainInKube(obj interface{}) {
+	// DeletionHandlingMetaNamespaceKeyFunc also handles the tombstones of
+	// deletions missed by the informer
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		c.logger.Errorf("Error while getting the key for the TrainInKube: %v", err)
+		return
+	}
+
+	c.queue.Add(key)
+}
 
-	traininkube, ok := obj.(*traininkubev1alpha1.TrainInKube)
+// enqueueOwner queues the TrainInKube owning the ConfigMap or Job, if any.
+func (c *Controller) enqueueOwner(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
 
-	if !ok {
-		c.logger.Errorf("Error while converting the object to TrainInKube")
+	object, err := meta.Accessor(obj)
+	if err != nil {
+		c.logger.Errorf("Error while getting the metadata of the object: %v", err)
+		return
 	}
 
-	c.queue.Add(event{
-		eventType:      addTrainInKube,
-		customResource: traininkube,
-	})
+	owner := metav1.GetControllerOf(object)
+	if owner == nil || owner.Kind != "TrainInKube" || owner.APIVersion != traininkubev1alpha1.SchemeGroupVersion.String() {
+		return
+	}
+
+	c.queue.Add(object.GetNamespace() + "/" + owner.Name)
 }
 
 func New(
 	kubeClientSet kubernetes.Interface,
 	traininkubev1alpha1ClientSet traininkubev1alpha1clientset.Interface,
-	namespace string,
+	options Options,
 	logger log.Logger,
 ) *Controller {
-	traininkubeInformerFactory := traininkubev1alpha1informers.NewSharedInformerFactory(
+	namespaces := options.Namespaces
+
+	// A single namespace is watched on its own, while any other selection
+	// watches the whole cluster and filters the TrainInKubes by namespace
+	traininkubeOptions := []traininkubev1alpha1informers.SharedInformerOption{}
+	childOptions := []kubeinformers.SharedInformerOption{
+		// Only the resources created for a run are cached
+		kubeinformers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = train.TrainInKubeLabel
+		}),
+	}
+	if namespace, ok := namespaces.single(); ok {
+		traininkubeOptions = append(traininkubeOptions, traininkubev1alpha1informers.WithNamespace(namespace))
+		childOptions = append(childOptions, kubeinformers.WithNamespace(namespace))
+	}
+
+	traininkubeInformerFactory := traininkubev1alpha1informers.NewSharedInformerFactoryWithOptions(
 		traininkubev1alpha1ClientSet,
-		time.Second*10,
+		options.ResyncPeriod,
+		traininkubeOptions...,
 	)
 
 	traininkubeInformer := traininkubeInformerFactory.Foo().V1alpha1().TrainInKubes().Informer()
 
-	kubeInformerFactory := kubeinformers.NewSharedInformerFactory(
+	kubeInformerFactory := kubeinformers.NewSharedInformerFactoryWithOptions(
 		kubeClientSet,
-		time.Second*10,
+		options.ResyncPeriod,
+		childOptions...,
 	)
 
 	configmapInformer := kubeInformerFactory.Core().V1().ConfigMaps().Informer()
 	jobInformer := kubeInformerFactory.Batch().V1().Jobs().Informer()
-	nodeInformer := kubeInformerFactory.Core().V1().Nodes().Informer()
 
-	queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	clusterInformerFactory := kubeinformers.NewSharedInformerFactory(
+		kubeClientSet,
+		options.ResyncPeriod,
+	)
+
+	nodeInformer := clusterInformerFactory.Core().V1().Nodes().Informer()
+	var namespaceInformer cache.SharedIndexInformer
+	if namespaces.hasSelector() {
+		namespaceInformer = clusterInformerFactory.Core().V1().Namespaces().Informer()
+	}
+
+	// The queue is named so that its metrics are recorded
+	queue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "traininkubes")
+
+	// Events are recorded on TrainInKubes, so their types have to be known to
+	// the scheme of the recorder
+	utilruntime.Must(traininkubescheme.AddToScheme(scheme.Scheme))
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartLogging(logger.Debugf)
+	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{
+		Interface: kubeClientSet.CoreV1().Events(""),
+	})
+	recorder := eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "tikoperator"})
 
 	ctrl := &Controller{
-		kubeClientSet:       kubeClientSet,
-		traininkubeInformer: traininkubeInformer,
-		configmapInformer:   configmapInformer,
-		jobInformer:         jobInformer,
-		nodeInformer:        nodeInformer,
-		queue:               queue,
-		namespace:           namespace,
-		logger:              logger,
+		kubeClientSet:        kubeClientSet,
+		traininkubeClientSet: traininkubev1alpha1ClientSet,
+		traininkubeInformer:  traininkubeInformer,
+		configmapInformer:    configmapInformer,
+		jobInformer:          jobInformer,
+		nodeInformer:         nodeInformer,
+		namespaceInformer:    namespaceInformer,
+		jobTracker:           train.NewJobTracker(jobInformer),
+		recorder:             recorder,
+		queue:                queue,
+		orchestrations:       newOrchestrations(),
+		namespaces:           namespaces,
+		workers:              options.Workers,
+		coordinator:          options.Coordinator,
+		coordinatorURL:       options.CoordinatorURL,
+		heartbeats:           newHeartbeats(options.Workers),
+		logger:               logger,
 	}
 
 	traininkubeInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc: ctrl.addTrainInKube,
+		AddFunc: ctrl.enqueueTrainInKube,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			ctrl.enqueueTrainInKube(newObj)
+		},
+		DeleteFunc: ctrl.enqueueTrainInKube,
 	})
 
+	// Changes to the resources created for a run move it forward
+	for _, informer := range []cache.SharedIndexInformer{configmapInformer, jobInformer} {
+		informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: ctrl.enqueueOwner,
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				ctrl.enqueueOwner(newObj)
+			},
+			DeleteFunc: ctrl.enqueueOwner,
+		})
+	}
+
+	if namespaceInformer != nil {
+		namespaceInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			UpdateFunc: ctrl.namespaceChanged,
+		})
+	}
+
 	return ctrl
 }
@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// workerTimeout is how long a worker can spend reconciling a single TrainInKube
+// before the controller is considered wedged. Reconciling only takes a few
+// requests to the API server, while the runs themselves are orchestrated in
+// the background.
+const workerTimeout = 5 * time.Minute
+
+// heartbeats keeps track of what each worker is doing. A worker beats when it
+// picks up a key and again when it is done with it, so a worker waiting for
+// the next key is always healthy.
+type heartbeats struct {
+	workers []heartbeat
+	lock    sync.Mutex
+}
+
+type heartbeat struct {
+	key       string
+	busySince time.Time
+}
+
+func newHeartbeats(workers int) *heartbeats {
+	return &heartbeats{
+		workers: make([]heartbeat, workers),
+	}
+}
+
+func (h *heartbeats) busy(worker int, key string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.workers[worker] = heartbeat{key: key, busySince: time.Now()}
+}
+
+func (h *heartbeats) idle(worker int) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.workers[worker] = heartbeat{}
+}
+
+// stuck returns an error naming the first worker busy with the same key for
+// longer than the timeout.
+func (h *heartbeats) stuck(timeout time.Duration) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for i, beat := range h.workers {
+		if beat.busySince.IsZero() {
+			continue
+		}
+		if busy := time.Since(beat.busySince); busy > timeout {
+			return fmt.Errorf("worker %d has been reconciling TrainInKube %s for %s", i, beat.key, busy.Round(time.Second))
+		}
+	}
+	return nil
+}
+
+// Ready returns an error until the caches of the informers are synced, before
+// which the controller does not reconcile anything.
+func (c *Controller) Ready() error {
+	if !c.synced.Load() {
+		return errors.New("the informers are not synced yet")
+	}
+	return nil
+}
+
+// Alive returns an error when a worker is wedged on a TrainInKube.
+func (c *Controller) Alive() error {
+	return c.heartbeats.stuck(workerTimeout)
+}
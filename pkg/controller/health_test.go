@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gotway/gotway/pkg/log"
+
+	traininkubefake "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/client/clientset/versioned/fake"
+	"github.com/ChinmayaSharma-hue/TrainInKubes/pkg/health"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// newHealthServer serves the probes of the controller the way the operator
+// does.
+func newHealthServer(t *testing.T, c *Controller) *httptest.Server {
+	t.Helper()
+	logger := log.NewLogger(log.Fields{}, "local", "error", io.Discard)
+	server := health.New("", logger)
+	server.AddLivenessCheck("workers", c.Alive)
+	server.AddReadinessCheck("informers", c.Ready)
+
+	ts := httptest.NewServer(server.Handler())
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func probe(t *testing.T, ts *httptest.Server, path string) int {
+	t.Helper()
+	resp, err := ts.Client().Get(ts.URL + path)
+	if err != nil {
+		t.Fatalf("Error while probing %s: %v", path, err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestReadinessWaitsForInformers(t *testing.T) {
+	// The jobs are only listed once the test lets them, which holds back the
+	// sync of the informers
+	release := make(chan struct{})
+	kubeClientSet := kubefake.NewSimpleClientset()
+	kubeClientSet.PrependReactor("list", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		<-release
+		return false, nil, nil
+	})
+	logger := log.NewLogger(log.Fields{}, "local", "error", io.Discard)
+	c := New(kubeClientSet, traininkubefake.NewSimpleClientset(), Options{
+		Namespaces: Namespaces{Names: []string{testNamespace}},
+		Workers:    1,
+	}, logger)
+	ts := newHealthServer(t, c)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = c.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	if code := probe(t, ts, health.ReadinessPath); code != http.StatusServiceUnavailable {
+		t.Errorf("readiness before the informers synced = %d, want %d", code, http.StatusServiceUnavailable)
+	}
+	if code := probe(t, ts, health.LivenessPath); code != http.StatusOK {
+		t.Errorf("liveness before the informers synced = %d, want %d", code, http.StatusOK)
+	}
+
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	for probe(t, ts, health.ReadinessPath) != http.StatusOK {
+		if time.Now().After(deadline) {
+			t.Fatalf("readiness did not pass once the informers synced")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestLivenessFailsOnStaleHeartbeat(t *testing.T) {
+	logger := log.NewLogger(log.Fields{}, "local", "error", io.Discard)
+	c := New(kubefake.NewSimpleClientset(), traininkubefake.NewSimpleClientset(), Options{
+		Namespaces: Namespaces{Names: []string{testNamespace}},
+		Workers:    2,
+	}, logger)
+	ts := newHealthServer(t, c)
+
+	c.heartbeats.busy(1, testNamespace+"/mnist")
+	if code := probe(t, ts, health.LivenessPath); code != http.StatusOK {
+		t.Errorf("liveness of a worker that just picked up a key = %d, want %d", code, http.StatusOK)
+	}
+
+	// The worker has been reconciling the same key for longer than the timeout
+	c.heartbeats.lock.Lock()
+	c.heartbeats.workers[1].busySince = time.Now().Add(-workerTimeout - time.Minute)
+	c.heartbeats.lock.Unlock()
+	if code := probe(t, ts, health.LivenessPath); code != http.StatusServiceUnavailable {
+		t.Errorf("liveness of a wedged worker = %d, want %d", code, http.StatusServiceUnavailable)
+	}
+
+	c.heartbeats.idle(1)
+	if code := probe(t, ts, health.LivenessPath); code != http.StatusOK {
+		t.Errorf("liveness once the worker is idle again = %d, want %d", code, http.StatusOK)
+	}
+}
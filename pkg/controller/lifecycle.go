@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	traininkubev1alpha1 "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/apis/trainink8s/v1alpha1"
+	"github.com/ChinmayaSharma-hue/TrainInKubes/pkg/metrics"
+	"github.com/ChinmayaSharma-hue/TrainInKubes/pkg/train"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+// restartDelay is how long a restart waits before checking again whether the
+// resources of the previous run are gone.
+const restartDelay = time.Second
+
+// restartTrainInKube stops the run of the TrainInKube, deletes its resources and
+// resets its status. The run is started again once the resources are gone.
+func (c *Controller) restartTrainInKube(ctx context.Context, key string, trainInKube *traininkubev1alpha1.TrainInKube) error {
+	c.orchestrations.stop(key)
+	c.recorder.Event(trainInKube, corev1.EventTypeNormal, train.ReasonRestarted, "The spec changed, restarting the run from the beginning")
+
+	err := c.deleteChildren(ctx, trainInKube.Namespace, trainInKube.Name)
+	if err != nil {
+		return err
+	}
+
+	_, err = train.UpdateStatus(ctx, c.traininkubeClientSet, trainInKube, func(trainInKube *traininkubev1alpha1.TrainInKube) {
+		trainInKube.Status = traininkubev1alpha1.TrainInKubeStatus{}
+	})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Error while resetting the status of the TrainInKube: %v", err)
+	}
+
+	return nil
+}
+
+// deleteTrainInKube stops the run of a deleted TrainInKube and deletes the
+// resources created for it.
+func (c *Controller) deleteTrainInKube(ctx context.Context, key string, namespace string, name string) error {
+	if _, running := c.orchestrations.get(key); running {
+		c.logger.Infof("TrainInKube %s was deleted, stopping the run", key)
+		c.orchestrations.stop(key)
+	}
+
+	exists, err := c.childrenExist(namespace, name)
+	if err != nil || !exists {
+		return err
+	}
+
+	return c.deleteChildren(ctx, namespace, name)
+}
+
+// deleteChildren deletes the ConfigMap, the jobs and the parameter server created
+// for the TrainInKube.
+func (c *Controller) deleteChildren(ctx context.Context, namespace string, name string) error {
+	propagation := metav1.DeletePropagationBackground
+	selector := labels.SelectorFromSet(labels.Set{train.TrainInKubeLabel: name}).String()
+
+	err := c.kubeClientSet.BatchV1().Jobs(namespace).DeleteCollection(
+		ctx,
+		metav1.DeleteOptions{PropagationPolicy: &propagation},
+		metav1.ListOptions{LabelSelector: selector},
+	)
+	if err != nil {
+		metrics.JobRequestErrors.WithLabelValues("delete").Inc()
+		return fmt.Errorf("Error while deleting the Jobs: %v", err)
+	}
+
+	err = c.kubeClientSet.CoreV1().ConfigMaps(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("Error while deleting the ConfigMap: %v", err)
+	}
+
+	err = train.DeleteParameterServer(ctx, c.kubeClientSet, namespace, name)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// childrenExist reports whether the informers still know of the ConfigMap or
+// any of the jobs created for the TrainInKube.
+func (c *Controller) childrenExist(namespace string, name string) (bool, error) {
+	_, exists, err := c.configmapInformer.GetIndexer().GetByKey(namespace + "/" + name)
+	if err != nil {
+		return false, fmt.Errorf("Error while getting the ConfigMap: %v", err)
+	}
+	if exists {
+		return true, nil
+	}
+
+	selector := labels.SelectorFromSet(labels.Set{train.TrainInKubeLabel: name})
+	jobs, err := c.jobInformer.GetIndexer().ByIndex(cache.NamespaceIndex, namespace)
+	if err != nil {
+		return false, fmt.Errorf("Error while listing the Jobs: %v", err)
+	}
+	for _, obj := range jobs {
+		job, ok := obj.(*batchv1.Job)
+		if ok && selector.Matches(labels.Set(job.Labels)) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
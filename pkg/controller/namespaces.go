@@ -0,0 +1,90 @@
+package controller
+
+import (
+	traininkubev1alpha1 "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/apis/trainink8s/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Namespaces selects the namespaces whose TrainInKubes are handled by the
+// controller. The zero value selects every namespace of the cluster.
+type Namespaces struct {
+	// Names lists the namespaces to handle. All namespaces are handled when
+	// it is empty.
+	Names []string
+	// Selector restricts the namespaces to the ones whose labels match.
+	Selector labels.Selector
+}
+
+// single returns the only namespace selected, if the selection is a single
+// namespace, so that the informers can be restricted to it.
+func (n Namespaces) single() (string, bool) {
+	if len(n.Names) != 1 || n.hasSelector() {
+		return "", false
+	}
+	return n.Names[0], true
+}
+
+func (n Namespaces) hasSelector() bool {
+	return n.Selector != nil && !n.Selector.Empty()
+}
+
+// watchesNamespace reports whether TrainInKubes of the namespace are handled
+// by the controller.
+func (c *Controller) watchesNamespace(namespace string) bool {
+	if len(c.namespaces.Names) > 0 {
+		found := false
+		for _, name := range c.namespaces.Names {
+			if name == namespace {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if !c.namespaces.hasSelector() {
+		return true
+	}
+
+	obj, exists, err := c.namespaceInformer.GetIndexer().GetByKey(namespace)
+	if err != nil || !exists {
+		return false
+	}
+	ns, ok := obj.(*corev1.Namespace)
+	if !ok {
+		return false
+	}
+	return c.namespaces.Selector.Matches(labels.Set(ns.Labels))
+}
+
+// namespaceChanged queues the TrainInKubes of a namespace whose labels changed,
+// so that runs start as soon as the namespace matches the selector.
+func (c *Controller) namespaceChanged(oldObj, newObj interface{}) {
+	oldNamespace, ok := oldObj.(*corev1.Namespace)
+	if !ok {
+		return
+	}
+	newNamespace, ok := newObj.(*corev1.Namespace)
+	if !ok {
+		return
+	}
+	if labels.Equals(oldNamespace.Labels, newNamespace.Labels) {
+		return
+	}
+
+	trainInKubes, err := c.traininkubeInformer.GetIndexer().ByIndex(cache.NamespaceIndex, newNamespace.Name)
+	if err != nil {
+		c.logger.Errorf("Error while listing the TrainInKubes of namespace %s: %v", newNamespace.Name, err)
+		return
+	}
+	for _, obj := range trainInKubes {
+		if trainInKube, ok := obj.(*traininkubev1alpha1.TrainInKube); ok {
+			c.enqueueTrainInKube(trainInKube)
+		}
+	}
+}
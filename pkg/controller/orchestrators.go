@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ChinmayaSharma-hue/TrainInKubes/pkg/metrics"
+	"github.com/ChinmayaSharma-hue/TrainInKubes/pkg/train"
+)
+
+// orchestration is a TrainOrchestrator running for a TrainInKube, along with
+// the function stopping it.
+type orchestration struct {
+	orchestrator *train.TrainOrchestrator
+	cancel       context.CancelFunc
+}
+
+// orchestrations keeps track of the in-flight runs, keyed by the namespace and
+// name of their TrainInKube.
+type orchestrations struct {
+	runs map[string]*orchestration
+	lock sync.Mutex
+
+	running sync.WaitGroup
+}
+
+func newOrchestrations() *orchestrations {
+	return &orchestrations{
+		runs: make(map[string]*orchestration),
+	}
+}
+
+// start runs the orchestrator in the background until it finishes or is
+// stopped, replacing any orchestrator already running for the same key.
+func (o *orchestrations) start(ctx context.Context, key string, orchestrator *train.TrainOrchestrator) {
+	ctx, cancel := context.WithCancel(ctx)
+	run := &orchestration{
+		orchestrator: orchestrator,
+		cancel:       cancel,
+	}
+
+	o.lock.Lock()
+	if previous, ok := o.runs[key]; ok {
+		previous.cancel()
+	}
+	o.runs[key] = run
+	metrics.ActiveOrchestrators.Set(float64(len(o.runs)))
+	o.lock.Unlock()
+
+	o.running.Add(1)
+	go func() {
+		defer o.running.Done()
+		defer o.remove(key, run)
+		orchestrator.Run(ctx, orchestrator.TrainInKube)
+	}()
+}
+
+// get returns the orchestrator running for the key, if any.
+func (o *orchestrations) get(key string) (*train.TrainOrchestrator, bool) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	run, ok := o.runs[key]
+	if !ok {
+		return nil, false
+	}
+	return run.orchestrator, true
+}
+
+// stop cancels the orchestrator running for the key, if any.
+func (o *orchestrations) stop(key string) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if run, ok := o.runs[key]; ok {
+		run.cancel()
+		delete(o.runs, key)
+		metrics.ActiveOrchestrators.Set(float64(len(o.runs)))
+	}
+}
+
+// stopAll cancels every orchestrator, and blocks until they all returned.
+func (o *orchestrations) stopAll() {
+	o.lock.Lock()
+	for key, run := range o.runs {
+		run.cancel()
+		delete(o.runs, key)
+	}
+	metrics.ActiveOrchestrators.Set(0)
+	o.lock.Unlock()
+
+	o.running.Wait()
+}
+
+func (o *orchestrations) remove(key string, run *orchestration) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	run.cancel()
+	if o.runs[key] == run {
+		delete(o.runs, key)
+		metrics.ActiveOrchestrators.Set(float64(len(o.runs)))
+	}
+}
@@ -4,23 +4,28 @@ import (
 	"context"
 	"fmt"
 	"strconv"
+	"time"
 
 	traininkubev1alpha1 "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/apis/trainink8s/v1alpha1"
+	"github.com/ChinmayaSharma-hue/TrainInKubes/pkg/metrics"
 	"github.com/ChinmayaSharma-hue/TrainInKubes/pkg/resources"
 	"github.com/ChinmayaSharma-hue/TrainInKubes/pkg/train"
 
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	cache "k8s.io/client-go/tools/cache"
 )
 
-func (c *Controller) runWorker(ctx context.Context) {
-	for c.processNextItem(ctx) {
+func (c *Controller) runWorker(ctx context.Context, worker int) {
+	for c.processNextItem(ctx, worker) {
 
 	}
 }
 
-func (c *Controller) processNextItem(ctx context.Context) bool {
+func (c *Controller) processNextItem(ctx context.Context, worker int) bool {
 	obj, shutdown := c.queue.Get()
 
 	if shutdown {
@@ -29,50 +34,163 @@ func (c *Controller) processNextItem(ctx context.Context) bool {
 
 	defer c.queue.Done(obj)
 
-	err := c.processItem(ctx, obj)
-	if err == nil {
-		c.logger.Debugf("Successfully processed the item")
+	key, ok := obj.(string)
+	if !ok {
+		c.logger.Errorf("Failed to cast the item to a key")
 		c.queue.Forget(obj)
-	} else if c.queue.NumRequeues(obj) < 3 {
-		c.logger.Errorf("Failed to process the item, requeuing it: %v", err)
-	} else {
-		c.logger.Errorf("Failed to process the item, dropping it: %v", err)
+		return true
+	}
+
+	c.heartbeats.busy(worker, key)
+	defer c.heartbeats.idle(worker)
+
+	start := time.Now()
+	err := c.Reconcile(ctx, key)
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	metrics.ReconcileDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+
+	if err == nil {
+		c.logger.Debugf("Successfully reconciled TrainInKube %s", key)
 		c.queue.Forget(obj)
-		utilruntime.HandleError(err)
+		return true
 	}
 
+	// Items are never dropped, as a dropped run would not move forward until
+	// its next resync. The rate limiter caps the delay between retries.
+	c.logger.Errorf("Failed to reconcile TrainInKube %s, requeuing it: %v", key, err)
+	utilruntime.HandleError(err)
+	c.queue.AddRateLimited(obj)
+
 	return true
 }
 
-func (c *Controller) processItem(ctx context.Context, obj interface{}) error {
-	event, ok := obj.(event)
+// Reconcile works out the stage of the run of a TrainInKube from its status and
+// the ConfigMap and Jobs observed for it, and moves the run forward by one step.
+// It is idempotent, so it can be called any number of times for the same key.
+func (c *Controller) Reconcile(ctx context.Context, key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return fmt.Errorf("Error while splitting the key %s: %v", key, err)
+	}
+	if !c.watchesNamespace(namespace) {
+		return nil
+	}
+
+	obj, exists, err := c.traininkubeInformer.GetIndexer().GetByKey(key)
+	if err != nil {
+		return fmt.Errorf("Error while getting the TrainInKube: %v", err)
+	}
+	if !exists {
+		return c.deleteTrainInKube(ctx, key, namespace, name)
+	}
+	trainInKube, ok := obj.(*traininkubev1alpha1.TrainInKube)
+	if !ok {
+		return fmt.Errorf("Error while converting the object to TrainInKube")
+	}
+	trainInKube = trainInKube.DeepCopy()
+
+	switch trainInKube.Status.Phase {
+	case traininkubev1alpha1.PhaseSucceeded:
+		return nil
+	case traininkubev1alpha1.PhaseFailed:
+		if trainInKube.Status.ObservedGeneration >= trainInKube.Generation {
+			return nil
+		}
+		c.logger.Infof("The spec of the failed TrainInKube %s changed, restarting the run", key)
+		return c.restartTrainInKube(ctx, key, trainInKube)
+	}
+
+	err = train.ValidateWorkers(trainInKube)
+	if err != nil {
+		return c.failTrainInKube(ctx, trainInKube, "InvalidSpec", err)
+	}
+	volume, volumeMount, err := train.StorageVolume(trainInKube)
+	if err != nil {
+		return c.failTrainInKube(ctx, trainInKube, "InvalidSpec", err)
+	}
+	paths, err := train.Paths(trainInKube)
+	if err != nil {
+		return c.failTrainInKube(ctx, trainInKube, "InvalidSpec", err)
+	}
+	specHash, err := train.SpecHash(trainInKube)
+	if err != nil {
+		return err
+	}
 
+	// The ConfigMap records the spec the run was started with
+	obj, exists, err = c.configmapInformer.GetIndexer().GetByKey(namespace + "/" + trainInKube.Name)
+	if err != nil {
+		return fmt.Errorf("Error while getting the ConfigMap: %v", err)
+	}
+	if !exists {
+		return c.createConfigMap(ctx, key, trainInKube, specHash)
+	}
+	configmap, ok := obj.(*corev1.ConfigMap)
 	if !ok {
-		c.logger.Errorf("Failed to cast the item to event")
-		return fmt.Errorf("Failed to cast the item to event")
+		return fmt.Errorf("Error while converting the object to ConfigMap")
+	}
+	if configmap.Annotations[train.SpecHashAnnotation] != specHash {
+		c.logger.Infof("The spec of TrainInKube %s changed, restarting the run", key)
+		return c.restartTrainInKube(ctx, key, trainInKube)
+	}
+	if configmap.Data["epochs"] != strconv.Itoa(trainInKube.Spec.Epochs) {
+		return c.updateEpochs(ctx, key, trainInKube, configmap)
+	}
+	if trainInKube.Status.ObservedGeneration != trainInKube.Generation {
+		return c.observeGeneration(ctx, trainInKube)
+	}
+	// The jobs are only created once the images of the run are recorded, so
+	// that they do not change when the config of the operator is reloaded
+	if trainInKube.Status.Images == nil {
+		return c.recordImages(ctx, trainInKube)
+	}
+
+	_, exists, err = c.jobInformer.GetIndexer().GetByKey(namespace + "/" + trainInKube.Name + "buildmodel")
+	if err != nil {
+		return fmt.Errorf("Error while getting the Job: %v", err)
+	}
+	if !exists && !meta.IsStatusConditionTrue(trainInKube.Status.Conditions, traininkubev1alpha1.ConditionModelBuilt) {
+		return c.createBuildJob(ctx, trainInKube, volume, volumeMount, paths)
 	}
 
-	switch event.eventType {
-	case addTrainInKube:
-		c.logger.Debugf("Processing the addTrainInKube event")
-		return c.processAddTrainInKube(ctx, event.customResource)
-	case addConfigMap:
-		c.logger.Debugf("Processing the addConfigMap event")
-		return c.processAddConfigMap(ctx, event.customResource)
-	case addBuildModel:
-		c.logger.Debugf("Processing the addBuildModel event")
-		return c.processAddBuildModel(ctx, event.customResource)
+	if _, running := c.orchestrations.get(key); !running {
+		return c.startOrchestrator(ctx, key, trainInKube)
 	}
 
 	return nil
 }
 
-func (c *Controller) processAddTrainInKube(ctx context.Context, trainInKube *traininkubev1alpha1.TrainInKube) error {
-	// configmap := createConfigMap(trainInKube, c.namespace)
+// createConfigMap starts the run by creating its ConfigMap, once the resources
+// of any previous run of the TrainInKube are gone.
+func (c *Controller) createConfigMap(
+	ctx context.Context,
+	key string,
+	trainInKube *traininkubev1alpha1.TrainInKube,
+	specHash string,
+) error {
+	// Jobs left behind by a previous run would be taken for the jobs of this one
+	exists, err := c.childrenExist(trainInKube.Namespace, trainInKube.Name)
+	if err != nil {
+		return err
+	}
+	if exists {
+		c.logger.Debugf("Waiting for the resources of the previous run of TrainInKube %s to be deleted", key)
+		err = c.deleteChildren(ctx, trainInKube.Namespace, trainInKube.Name)
+		if err != nil {
+			return err
+		}
+		c.queue.AddAfter(key, restartDelay)
+		return nil
+	}
+
 	data := map[string]string{
-		"epochs":                      string(trainInKube.Spec.Epochs),
-		"batchSize":                   string(trainInKube.Spec.BatchSize),
+		"epochs":                      strconv.Itoa(trainInKube.Spec.Epochs),
+		"batchSize":                   strconv.Itoa(trainInKube.Spec.BatchSize),
 		"numberOfSamples":             strconv.Itoa(trainInKube.Spec.NumberOfSamples),
+		"workers":                     strconv.Itoa(train.NumberOfWorkers(trainInKube)),
 		"preprocessedDatasetLocation": trainInKube.Spec.PreprocessedDataLocation,
 		"splitDatasetLocation":        trainInKube.Spec.SplitDatasetLocation,
 		"modelsLocation":              trainInKube.Spec.ModelsLocation,
@@ -82,108 +200,196 @@ func (c *Controller) processAddTrainInKube(ctx context.Context, trainInKube *tra
 	configmap := resources.CreateConfigMap(
 		resources.CreateCMWithName(trainInKube.Name),
 		resources.CreateCMWithData(data),
-		resources.CreateCMInNamespace(c.namespace),
+		resources.CreateCMInNamespace(trainInKube.Namespace),
+		resources.CreateCMWithLabels(train.Labels(trainInKube)),
+		resources.CreateCMWithAnnotations(map[string]string{
+			train.SpecHashAnnotation: specHash,
+		}),
 		resources.CreateCMWithOwnerReference(ownerReference),
 	)
 
-	exists, err := resourceExists(configmap, c.configmapInformer.GetIndexer())
-	if err != nil {
-		return fmt.Errorf("error while checking if the ConfigMap already exists: %v", err)
+	_, err = c.kubeClientSet.CoreV1().ConfigMaps(trainInKube.Namespace).Create(ctx, configmap, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		err = nil
+	} else if err == nil {
+		c.recorder.Eventf(trainInKube, corev1.EventTypeNormal, train.ReasonConfigMapCreated, "Created ConfigMap %s", configmap.Name)
 	}
-	if exists {
-		c.logger.Infof("ConfigMap already exists, skipping creation")
-		return nil
+	if err != nil {
+		return fmt.Errorf("Error while creating the ConfigMap: %v", err)
 	}
 
-	_, err = c.kubeClientSet.CoreV1().ConfigMaps(c.namespace).Create(ctx, configmap, metav1.CreateOptions{})
-
-	// Add an event to the TrainInKube signalling the end of creation of CongigMap
-	c.queue.Add(event{
-		eventType:      addConfigMap,
-		customResource: trainInKube,
+	// Record the start of the run, the number of workers and the images it was
+	// started with
+	images := train.StatusImages(train.DefaultImages())
+	_, err = train.UpdateStatus(ctx, c.traininkubeClientSet, trainInKube, func(trainInKube *traininkubev1alpha1.TrainInKube) {
+		if trainInKube.Status.Phase == "" {
+			trainInKube.Status.Phase = traininkubev1alpha1.PhasePending
+		}
+		trainInKube.Status.Workers = train.NumberOfWorkers(trainInKube)
+		if trainInKube.Status.StartTime == nil {
+			now := metav1.Now()
+			trainInKube.Status.StartTime = &now
+		}
+		if trainInKube.Status.Images == nil {
+			trainInKube.Status.Images = images
+		}
 	})
+	if err != nil {
+		return fmt.Errorf("Error while updating the status of the TrainInKube: %v", err)
+	}
 
-	return err
+	return nil
 }
 
-func (c *Controller) processAddConfigMap(
+// updateEpochs applies a new number of epochs to the run in progress.
+func (c *Controller) updateEpochs(
 	ctx context.Context,
+	key string,
 	trainInKube *traininkubev1alpha1.TrainInKube,
+	configmap *corev1.ConfigMap,
 ) error {
-	// Query the kubernetes server for the ConfigMap
-	// If the ConfigMap is not found, requeue the event
-	// If the ConfigMap is found, create a Job to build the model
-	_, err := c.kubeClientSet.CoreV1().ConfigMaps(c.namespace).Get(ctx, trainInKube.Name, metav1.GetOptions{})
+	c.logger.Infof("Changing the number of epochs of TrainInKube %s to %d", key, trainInKube.Spec.Epochs)
+
+	configmap = configmap.DeepCopy()
+	configmap.Data["epochs"] = strconv.Itoa(trainInKube.Spec.Epochs)
+	_, err := c.kubeClientSet.CoreV1().ConfigMaps(trainInKube.Namespace).Update(ctx, configmap, metav1.UpdateOptions{})
 	if err != nil {
-		return fmt.Errorf("Error while getting the ConfigMap: %v", err)
+		return fmt.Errorf("Error while updating the ConfigMap: %v", err)
 	}
 
-	// Create a Job to build the model
-	// job := createJob(trainInKube, configmap, c.namespace)
-	volume := resources.CreateHostPathVolume(trainInKube.Name+"volume", "/data")
-	volumeMount := resources.CreateVolumeMount(trainInKube.Name+"volume", "/data")
-	envVariables := map[string]string{
-		"MODEL_STORAGE_LOCATION": "/data",
+	if orchestrator, ok := c.orchestrations.get(key); ok {
+		orchestrator.SetEpochs(trainInKube.Spec.Epochs)
 	}
-	ownerReference := resources.CreateOwnerReference(trainInKube)
 
-	job := resources.CreateJob(
-		resources.CreateJobWithName(trainInKube.Name+"buildmodel"),
-		resources.CreateJobWithImage("buildjob:latest"),
-		resources.CreateJobInNamespace(c.namespace),
-		resources.CreateJobWithVolume(volume),
-		resources.CreateJobWithVolumeMounts(volumeMount),
-		resources.CreateJobWithEnv(envVariables),
-		resources.CreateJobWithOwnerReference(ownerReference),
-	)
+	return c.observeGeneration(ctx, trainInKube)
+}
 
-	exists, err := resourceExists(job, c.jobInformer.GetIndexer())
+// observeGeneration records that the run has caught up with the latest
+// generation of the spec.
+func (c *Controller) observeGeneration(ctx context.Context, trainInKube *traininkubev1alpha1.TrainInKube) error {
+	generation := trainInKube.Generation
+	_, err := train.UpdateStatus(ctx, c.traininkubeClientSet, trainInKube, func(trainInKube *traininkubev1alpha1.TrainInKube) {
+		trainInKube.Status.ObservedGeneration = generation
+	})
 	if err != nil {
-		return fmt.Errorf("Error while checking if the Job already exists: %v", err)
+		return fmt.Errorf("Error while updating the status of the TrainInKube: %v", err)
 	}
-	if exists {
-		c.logger.Infof("Job already exists, skipping creation")
-		return nil
+
+	return nil
+}
+
+// recordImages records the current default images in the status of a run that
+// was started without them, such as a run started by an earlier version of
+// the operator.
+func (c *Controller) recordImages(ctx context.Context, trainInKube *traininkubev1alpha1.TrainInKube) error {
+	images := train.StatusImages(train.DefaultImages())
+	_, err := train.UpdateStatus(ctx, c.traininkubeClientSet, trainInKube, func(trainInKube *traininkubev1alpha1.TrainInKube) {
+		if trainInKube.Status.Images == nil {
+			trainInKube.Status.Images = images
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("Error while updating the status of the TrainInKube: %v", err)
 	}
 
-	_, err = c.kubeClientSet.BatchV1().Jobs(c.namespace).Create(ctx, job, metav1.CreateOptions{})
+	return nil
+}
+
+func (c *Controller) createBuildJob(
+	ctx context.Context,
+	trainInKube *traininkubev1alpha1.TrainInKube,
+	volume corev1.Volume,
+	volumeMount corev1.VolumeMount,
+	paths train.DataPaths,
+) error {
+	job := train.BuildJob(trainInKube, volume, volumeMount, paths)
+
+	_, err := c.kubeClientSet.BatchV1().Jobs(trainInKube.Namespace).Create(ctx, job, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		err = nil
+	} else if err == nil {
+		metrics.JobsCreated.WithLabelValues(train.StageBuild).Inc()
+		c.recorder.Eventf(trainInKube, corev1.EventTypeNormal, train.ReasonBuildingModel, "Building the model with job %s", job.Name)
+	}
 	if err != nil {
+		metrics.JobRequestErrors.WithLabelValues("create").Inc()
 		return fmt.Errorf("Error while creating the Job: %v", err)
 	}
 
-	// Add an event to the TrainInKube signalling the end of creation of Job
-	c.queue.Add(event{
-		eventType:      addBuildModel,
-		customResource: trainInKube,
+	_, err = train.UpdateStatus(ctx, c.traininkubeClientSet, trainInKube, func(trainInKube *traininkubev1alpha1.TrainInKube) {
+		trainInKube.Status.Phase = traininkubev1alpha1.PhaseBuildingModel
 	})
+	if err != nil {
+		return fmt.Errorf("Error while updating the status of the TrainInKube: %v", err)
+	}
 
 	return nil
 }
 
-func (c *Controller) processAddBuildModel(ctx context.Context, trainInKube *traininkubev1alpha1.TrainInKube) error {
+// startOrchestrator starts the TrainOrchestrator taking the run from the build
+// job to the end of the training.
+func (c *Controller) startOrchestrator(
+	ctx context.Context,
+	key string,
+	trainInKube *traininkubev1alpha1.TrainInKube,
+) error {
+	// The cache may not have seen the status written by an orchestrator that
+	// just finished, so check the latest version before starting another one
+	latest, err := c.traininkubeClientSet.FooV1alpha1().TrainInKubes(trainInKube.Namespace).Get(ctx, trainInKube.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Error while getting the TrainInKube: %v", err)
+	}
+	if train.IsFinished(latest) {
+		return nil
+	}
+
 	// Create another struct that will be used to scale the jobs for training, monitors
 	// the resources available in the cluster, and periodically triggers the splitting job.
 	torch := &train.TrainOrchestrator{
-		KubeClientSet: c.kubeClientSet,
-		TrainInKube:   trainInKube,
-		JobInformer:   c.jobInformer,
-		Namespace:     c.namespace,
-		Logger:        c.logger,
+		KubeClientSet:        c.kubeClientSet,
+		TrainInKubeClientSet: c.traininkubeClientSet,
+		TrainInKube:          latest,
+		JobInformer:          c.jobInformer,
+		JobTracker:           c.jobTracker,
+		Recorder:             c.recorder,
+		Coordinator:          c.coordinator,
+		CoordinatorURL:       c.coordinatorURL,
+		Namespace:            latest.Namespace,
+		Logger:               c.logger,
 	}
 
-	// Start the TrainOrchestrator
-	go torch.Run(ctx, trainInKube)
+	// Start the TrainOrchestrator, which is stopped when the TrainInKube is
+	// deleted or restarted
+	c.orchestrations.start(ctx, key, torch)
 
 	return nil
 }
 
-func resourceExists(obj interface{}, indexer cache.Indexer) (bool, error) {
-	key, err := cache.MetaNamespaceKeyFunc(obj)
-
+// failTrainInKube marks the run as failed. The cause is not returned so that
+// the TrainInKube is not requeued, as retrying cannot fix the spec.
+func (c *Controller) failTrainInKube(
+	ctx context.Context,
+	trainInKube *traininkubev1alpha1.TrainInKube,
+	reason string,
+	cause error,
+) error {
+	c.logger.Errorf("Invalid TrainInKube %s: %v", trainInKube.Name, cause)
+	c.recorder.Eventf(trainInKube, corev1.EventTypeWarning, reason, "Invalid spec: %v", cause)
+
+	generation := trainInKube.Generation
+	_, err := train.UpdateStatus(ctx, c.traininkubeClientSet, trainInKube, func(trainInKube *traininkubev1alpha1.TrainInKube) {
+		now := metav1.Now()
+		trainInKube.Status.Phase = traininkubev1alpha1.PhaseFailed
+		trainInKube.Status.ObservedGeneration = generation
+		trainInKube.Status.CompletionTime = &now
+		train.SetCondition(trainInKube, traininkubev1alpha1.ConditionFailed, metav1.ConditionTrue, reason, cause.Error())
+	})
 	if err != nil {
-		return false, fmt.Errorf("error while getting the key for the object: %v", err)
+		return fmt.Errorf("Error while updating the status of the TrainInKube: %v", err)
 	}
 
-	_, exists, err := indexer.GetByKey(key)
-	return exists, err
+	return nil
 }
@@ -0,0 +1,209 @@
+package controller
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/gotway/gotway/pkg/log"
+
+	traininkubev1alpha1 "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/apis/trainink8s/v1alpha1"
+	traininkubefake "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/client/clientset/versioned/fake"
+	"github.com/ChinmayaSharma-hue/TrainInKubes/pkg/train"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testNamespace = "default"
+
+// newTestTrainInKube returns a TrainInKube in the middle of its run, at the
+// given generation of its spec.
+func newTestTrainInKube(generation int64) *traininkubev1alpha1.TrainInKube {
+	return &traininkubev1alpha1.TrainInKube{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "mnist",
+			Namespace:  testNamespace,
+			Generation: generation,
+		},
+		Spec: traininkubev1alpha1.TrainInKubeSpec{
+			ModelImage:      "model:latest",
+			Epochs:          2,
+			BatchSize:       4,
+			NumberOfSamples: 16,
+			Workers:         2,
+		},
+		Status: traininkubev1alpha1.TrainInKubeStatus{
+			Phase:              traininkubev1alpha1.PhaseTraining,
+			Workers:            2,
+			ObservedGeneration: 1,
+			Epoch:              1,
+			MiniBatch:          2,
+		},
+	}
+}
+
+// newTestConfigMap returns the ConfigMap recording the start of the run of the
+// TrainInKube, with the given spec hash.
+func newTestConfigMap(trainInKube *traininkubev1alpha1.TrainInKube, specHash string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        trainInKube.Name,
+			Namespace:   testNamespace,
+			Labels:      train.Labels(trainInKube),
+			Annotations: map[string]string{train.SpecHashAnnotation: specHash},
+		},
+		Data: map[string]string{
+			"epochs": "2",
+		},
+	}
+}
+
+// newTestController returns a controller backed by fake clientsets, with its
+// informer caches filled with the objects instead of being run.
+func newTestController(
+	t *testing.T,
+	trainInKube *traininkubev1alpha1.TrainInKube,
+	objects ...runtime.Object,
+) (*Controller, *kubefake.Clientset, *traininkubefake.Clientset) {
+	t.Helper()
+
+	kubeClientSet := kubefake.NewSimpleClientset(objects...)
+	traininkubeClientSet := traininkubefake.NewSimpleClientset(trainInKube)
+	logger := log.NewLogger(log.Fields{}, "local", "error", io.Discard)
+
+	c := New(kubeClientSet, traininkubeClientSet, Options{Namespaces: Namespaces{Names: []string{testNamespace}}}, logger)
+	if err := c.traininkubeInformer.GetIndexer().Add(trainInKube); err != nil {
+		t.Fatalf("Error while adding the TrainInKube to the cache: %v", err)
+	}
+	for _, obj := range objects {
+		if err := c.configmapInformer.GetIndexer().Add(obj); err != nil {
+			t.Fatalf("Error while adding the object to the cache: %v", err)
+		}
+	}
+
+	return c, kubeClientSet, traininkubeClientSet
+}
+
+func getTrainInKube(t *testing.T, clientSet *traininkubefake.Clientset) *traininkubev1alpha1.TrainInKube {
+	t.Helper()
+	trainInKube, err := clientSet.FooV1alpha1().TrainInKubes(testNamespace).Get(context.Background(), "mnist", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Error while getting the TrainInKube: %v", err)
+	}
+	return trainInKube
+}
+
+func hasAction(actions []k8stesting.Action, verb string, resource string) bool {
+	for _, action := range actions {
+		if action.GetVerb() == verb && action.GetResource().Resource == resource {
+			return true
+		}
+	}
+	return false
+}
+
+func TestReconcileRestartsOnSpecChange(t *testing.T) {
+	trainInKube := newTestTrainInKube(2)
+	configmap := newTestConfigMap(trainInKube, "stale")
+	c, kubeClientSet, traininkubeClientSet := newTestController(t, trainInKube, configmap)
+
+	if err := c.Reconcile(context.Background(), testNamespace+"/mnist"); err != nil {
+		t.Fatalf("Reconcile() error: %v", err)
+	}
+
+	actions := kubeClientSet.Actions()
+	if !hasAction(actions, "delete-collection", "jobs") {
+		t.Errorf("the jobs of the run were not deleted, actions: %v", actions)
+	}
+	if !hasAction(actions, "delete", "configmaps") {
+		t.Errorf("the ConfigMap of the run was not deleted, actions: %v", actions)
+	}
+	updated := getTrainInKube(t, traininkubeClientSet)
+	if updated.Status.Phase != "" || updated.Status.Epoch != 0 || updated.Status.MiniBatch != 0 {
+		t.Errorf("status was not reset: %+v", updated.Status)
+	}
+}
+
+func TestReconcileUpdatesEpochs(t *testing.T) {
+	trainInKube := newTestTrainInKube(2)
+	specHash, err := train.SpecHash(trainInKube)
+	if err != nil {
+		t.Fatalf("SpecHash() error: %v", err)
+	}
+	configmap := newTestConfigMap(trainInKube, specHash)
+	trainInKube.Spec.Epochs = 5
+	c, kubeClientSet, traininkubeClientSet := newTestController(t, trainInKube, configmap)
+
+	if err := c.Reconcile(context.Background(), testNamespace+"/mnist"); err != nil {
+		t.Fatalf("Reconcile() error: %v", err)
+	}
+
+	actions := kubeClientSet.Actions()
+	if hasAction(actions, "delete-collection", "jobs") || hasAction(actions, "delete", "configmaps") {
+		t.Errorf("the run was restarted, actions: %v", actions)
+	}
+	updatedConfigMap, err := kubeClientSet.CoreV1().ConfigMaps(testNamespace).Get(context.Background(), "mnist", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Error while getting the ConfigMap: %v", err)
+	}
+	if got := updatedConfigMap.Data["epochs"]; got != "5" {
+		t.Errorf("epochs in the ConfigMap = %q, want %q", got, "5")
+	}
+	updated := getTrainInKube(t, traininkubeClientSet)
+	if updated.Status.Phase != traininkubev1alpha1.PhaseTraining || updated.Status.MiniBatch != 2 {
+		t.Errorf("status of the run in progress changed: %+v", updated.Status)
+	}
+	if updated.Status.ObservedGeneration != 2 {
+		t.Errorf("ObservedGeneration = %d, want 2", updated.Status.ObservedGeneration)
+	}
+}
+
+func TestReconcileRestartsFailedRunOnSpecChange(t *testing.T) {
+	trainInKube := newTestTrainInKube(2)
+	trainInKube.Status.Phase = traininkubev1alpha1.PhaseFailed
+	c, _, traininkubeClientSet := newTestController(t, trainInKube)
+
+	if err := c.Reconcile(context.Background(), testNamespace+"/mnist"); err != nil {
+		t.Fatalf("Reconcile() error: %v", err)
+	}
+
+	if updated := getTrainInKube(t, traininkubeClientSet); updated.Status.Phase != "" {
+		t.Errorf("Phase = %q, want the status to be reset", updated.Status.Phase)
+	}
+
+	// Once the failure is observed for the latest generation, the run stays failed
+	trainInKube.Status.ObservedGeneration = 2
+	c, _, traininkubeClientSet = newTestController(t, trainInKube)
+	if err := c.Reconcile(context.Background(), testNamespace+"/mnist"); err != nil {
+		t.Fatalf("Reconcile() error: %v", err)
+	}
+	if updated := getTrainInKube(t, traininkubeClientSet); updated.Status.Phase != traininkubev1alpha1.PhaseFailed {
+		t.Errorf("Phase = %q, want %q", updated.Status.Phase, traininkubev1alpha1.PhaseFailed)
+	}
+}
+
+func TestReconcileRecordsImages(t *testing.T) {
+	trainInKube := newTestTrainInKube(1)
+	specHash, err := train.SpecHash(trainInKube)
+	if err != nil {
+		t.Fatalf("SpecHash() error: %v", err)
+	}
+	configmap := newTestConfigMap(trainInKube, specHash)
+	c, _, traininkubeClientSet := newTestController(t, trainInKube, configmap)
+
+	if err := c.Reconcile(context.Background(), testNamespace+"/mnist"); err != nil {
+		t.Fatalf("Reconcile() error: %v", err)
+	}
+
+	updated := getTrainInKube(t, traininkubeClientSet)
+	if updated.Status.Images == nil {
+		t.Fatalf("the images of the run were not recorded")
+	}
+	if got, want := train.Images(*updated.Status.Images), train.DefaultImages(); got != want {
+		t.Errorf("recorded images = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,229 @@
+package coordinator
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Actions the workers are asked to take in a step.
+const (
+	// ActionTrain computes the gradients of the shard of the worker for a
+	// minibatch.
+	ActionTrain = "train"
+	// ActionAggregate averages the gradients of the minibatch into the model.
+	ActionAggregate = "aggregate"
+	// ActionStop makes the worker exit once it acknowledged the step.
+	ActionStop = "stop"
+)
+
+// Step is the work assigned to the workers of a run. The ID of a step is the
+// same when it is assigned again, for example after the operator restarted, so
+// a worker acknowledges a step it already completed without running it again.
+type Step struct {
+	ID     string `json:"id"`
+	Action string `json:"action"`
+	// Attempt counts the times the step was assigned again after failing,
+	// from 0.
+	Attempt int `json:"attempt"`
+
+	// Epoch and MiniBatch count from 1.
+	Epoch         int `json:"epoch,omitempty"`
+	MiniBatch     int `json:"miniBatch,omitempty"`
+	StartingIndex int `json:"startingIndex,omitempty"`
+	EndingIndex   int `json:"endingIndex,omitempty"`
+	// Gradients lists the indices of the gradients to average, for the
+	// aggregate steps.
+	Gradients []int `json:"gradients,omitempty"`
+}
+
+// Ack is sent by a worker once it is done with a step. Error is empty when the
+// step succeeded.
+type Ack struct {
+	Error string `json:"error,omitempty"`
+}
+
+var (
+	errUnknownWorker = errors.New("unknown worker")
+	errStaleStep     = errors.New("the step is not assigned to the worker")
+	errClosed        = errors.New("the run is not coordinated anymore")
+)
+
+// Run holds the step assigned to the workers of a TrainInKube, and collects
+// their acknowledgments.
+type Run struct {
+	namespace string
+	name      string
+	workers   int
+	// token authenticates the requests of the workers.
+	token string
+
+	// closed is set once the run is unregistered.
+	closed  bool
+	step    *Step
+	pending map[int]bool
+	failed  map[int]string
+	// changed is closed, and replaced, whenever the step or the
+	// acknowledgments change.
+	changed chan struct{}
+	lock    sync.Mutex
+}
+
+func newRun(namespace string, name string, workers int, token string) *Run {
+	return &Run{
+		namespace: namespace,
+		name:      name,
+		workers:   workers,
+		token:     token,
+		changed:   make(chan struct{}),
+	}
+}
+
+// Workers returns the number of workers of the run.
+func (r *Run) Workers() int {
+	return r.workers
+}
+
+// Do assigns the step to the given workers, or to all of them when none are
+// given, and blocks until every one of them acknowledged it. This is the
+// barrier between the steps of a run. It returns the error reported by each
+// worker that failed the step, keyed by worker index.
+func (r *Run) Do(ctx context.Context, step Step, workers ...int) (map[int]string, error) {
+	if len(workers) == 0 {
+		workers = make([]int, r.workers)
+		for i := range workers {
+			workers[i] = i
+		}
+	}
+
+	r.lock.Lock()
+	if r.closed {
+		r.lock.Unlock()
+		return nil, errClosed
+	}
+	r.step = &step
+	r.pending = map[int]bool{}
+	r.failed = map[int]string{}
+	for _, worker := range workers {
+		if worker < 0 || worker >= r.workers {
+			r.lock.Unlock()
+			return nil, errUnknownWorker
+		}
+		r.pending[worker] = true
+	}
+	r.notify()
+	r.lock.Unlock()
+
+	for {
+		r.lock.Lock()
+		if r.closed {
+			r.lock.Unlock()
+			return nil, errClosed
+		}
+		if len(r.pending) == 0 {
+			failed := r.failed
+			r.lock.Unlock()
+			return failed, nil
+		}
+		changed := r.changed
+		r.lock.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Pending returns the workers that have not acknowledged the current step yet.
+func (r *Run) Pending() []int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	pending := make([]int, 0, len(r.pending))
+	for worker := range r.pending {
+		pending = append(pending, worker)
+	}
+	sort.Ints(pending)
+	return pending
+}
+
+// next returns the step assigned to the worker that it has not acknowledged
+// yet, waiting up to the timeout for one. It returns nil when there is none.
+func (r *Run) next(ctx context.Context, worker int, timeout time.Duration) (*Step, error) {
+	if worker < 0 || worker >= r.workers {
+		return nil, errUnknownWorker
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		r.lock.Lock()
+		if r.closed {
+			r.lock.Unlock()
+			return nil, errClosed
+		}
+		if r.step != nil && r.pending[worker] {
+			step := *r.step
+			r.lock.Unlock()
+			return &step, nil
+		}
+		changed := r.changed
+		r.lock.Unlock()
+
+		select {
+		case <-changed:
+		case <-timer.C:
+			return nil, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// ack records that the worker is done with the step. Acknowledging the same
+// step twice is not an error, so that workers can retry their requests.
+func (r *Run) ack(worker int, id string, ack Ack) error {
+	if worker < 0 || worker >= r.workers {
+		return errUnknownWorker
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.closed {
+		return errClosed
+	}
+	if r.step == nil || r.step.ID != id {
+		return errStaleStep
+	}
+	if !r.pending[worker] {
+		return nil
+	}
+	delete(r.pending, worker)
+	if ack.Error != "" {
+		r.failed[worker] = ack.Error
+	}
+	r.notify()
+	return nil
+}
+
+// close wakes up everyone waiting on the run, which fail from then on.
+func (r *Run) close() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.closed = true
+	r.notify()
+}
+
+// notify wakes up everyone waiting for a change. It must be called with the
+// lock held.
+func (r *Run) notify() {
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
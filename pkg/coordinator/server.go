@@ -0,0 +1,229 @@
+package coordinator
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotway/gotway/pkg/log"
+)
+
+// LeaderLabel is set on the pod of the operator that leads, so that the Service
+// in front of the coordinator only sends the workers to it.
+const LeaderLabel = "trainink8s.com/leader"
+
+// BasePath is the prefix of the paths served to the workers:
+//
+//	GET  /v1/namespaces/<namespace>/traininkubes/<name>/workers/<index>/step
+//	POST /v1/namespaces/<namespace>/traininkubes/<name>/workers/<index>/steps/<id>
+//
+// The first returns the step assigned to the worker as JSON, waiting up to the
+// timeout query parameter for one, or answers with 204 when there is none yet.
+// The second acknowledges the step with an Ack as the body. Both need the
+// token of the run as a bearer token in the Authorization header.
+const BasePath = "/v1/namespaces/"
+
+// The time a worker waits for its next step by default, and at most.
+const (
+	defaultPollTimeout = 30 * time.Second
+	maxPollTimeout     = 5 * time.Minute
+)
+
+// Server coordinates the persistent workers of the runs over HTTP. Each worker
+// repeatedly asks for the step assigned to it, runs it and acknowledges it.
+type Server struct {
+	addr string
+
+	runs map[string]*Run
+	lock sync.Mutex
+
+	logger log.Logger
+}
+
+func New(addr string, logger log.Logger) *Server {
+	return &Server{
+		addr:   addr,
+		runs:   map[string]*Run{},
+		logger: logger,
+	}
+}
+
+// Register starts coordinating the workers of a TrainInKube, which
+// authenticate with the token, replacing the run registered for it before, if
+// any.
+func (s *Server) Register(namespace string, name string, workers int, token string) *Run {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	run := newRun(namespace, name, workers, token)
+	if previous := s.runs[namespace+"/"+name]; previous != nil {
+		previous.close()
+	}
+	s.runs[namespace+"/"+name] = run
+	return run
+}
+
+// Unregister stops coordinating the run. The workers waiting for their next
+// step get a 404 right away, and so do their later requests.
+func (s *Server) Unregister(run *Run) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	key := run.namespace + "/" + run.name
+	if s.runs[key] == run {
+		delete(s.runs, key)
+	}
+	run.close()
+}
+
+func (s *Server) run(namespace string, name string) *Run {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.runs[namespace+"/"+name]
+}
+
+// Handler returns the handler serving the workers, so that it can also be
+// mounted on a test server.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(BasePath, s.serve)
+	return mux
+}
+
+// Run serves the workers until the context is cancelled.
+func (s *Server) Run(ctx context.Context) error {
+	server := &http.Server{
+		Addr:              s.addr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			s.logger.Errorf("Error while shutting down the coordinator server: %v", err)
+		}
+	}()
+
+	s.logger.Infof("Starting the coordinator server on %s", s.addr)
+	err := server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	// <namespace>/traininkubes/<name>/workers/<index>/step or
+	// <namespace>/traininkubes/<name>/workers/<index>/steps/<id>
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, BasePath), "/")
+	if len(parts) < 6 || parts[1] != "traininkubes" || parts[3] != "workers" {
+		http.NotFound(w, r)
+		return
+	}
+	worker, err := strconv.Atoi(parts[4])
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid worker index %q", parts[4]), http.StatusBadRequest)
+		return
+	}
+	run := s.run(parts[0], parts[2])
+	if run == nil {
+		http.Error(w, fmt.Sprintf("TrainInKube %s/%s is not coordinated by this operator", parts[0], parts[2]), http.StatusNotFound)
+		return
+	}
+	if !authorized(r, run) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case len(parts) == 6 && parts[5] == "step":
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.serveStep(w, r, run, worker)
+	case len(parts) == 7 && parts[5] == "steps":
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.serveAck(w, r, run, worker, parts[6])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) serveStep(w http.ResponseWriter, r *http.Request, run *Run, worker int) {
+	timeout := defaultPollTimeout
+	if value := r.URL.Query().Get("timeout"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < 0 {
+			http.Error(w, fmt.Sprintf("invalid timeout %q", value), http.StatusBadRequest)
+			return
+		}
+		timeout = parsed
+	}
+	if timeout > maxPollTimeout {
+		timeout = maxPollTimeout
+	}
+
+	step, err := run.next(r.Context(), worker, timeout)
+	if errors.Is(err, errUnknownWorker) || errors.Is(err, errClosed) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		// The worker went away
+		return
+	}
+	if step == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(step); err != nil {
+		s.logger.Errorf("Error while sending step %s to worker %d: %v", step.ID, worker, err)
+	}
+}
+
+func (s *Server) serveAck(w http.ResponseWriter, r *http.Request, run *Run, worker int, id string) {
+	var ack Ack
+	// An empty body acknowledges a step that succeeded
+	if err := json.NewDecoder(r.Body).Decode(&ack); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, fmt.Sprintf("invalid acknowledgment: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	err := run.ack(worker, id, ack)
+	switch {
+	case errors.Is(err, errUnknownWorker), errors.Is(err, errClosed):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, errStaleStep):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		if ack.Error != "" {
+			s.logger.Warnf("Worker %d of TrainInKube %s/%s failed step %s: %s", worker, run.namespace, run.name, id, ack.Error)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// authorized reports whether the request carries the token of the run.
+func authorized(r *http.Request, run *Run) bool {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return found && subtle.ConstantTimeCompare([]byte(token), []byte(run.token)) == 1
+}
@@ -0,0 +1,227 @@
+package coordinator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gotway/gotway/pkg/log"
+)
+
+const (
+	testToken   = "secret"
+	testTimeout = 5 * time.Second
+)
+
+func newTestServer(t *testing.T) (*Server, *httptest.Server) {
+	t.Helper()
+	server := New("", log.NewLogger(log.Fields{}, "local", "error", io.Discard))
+	ts := httptest.NewServer(server.Handler())
+	t.Cleanup(ts.Close)
+	return server, ts
+}
+
+func workerPath(name string, worker int) string {
+	return fmt.Sprintf("%sdefault/traininkubes/%s/workers/%d", BasePath, name, worker)
+}
+
+// request sends the request as a worker authenticated with the token, and
+// returns the status and the body of the response.
+func request(t *testing.T, ts *httptest.Server, method string, path string, token string, body []byte) (int, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(method, ts.URL+path, bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Error while creating the request: %v", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("Error while sending %s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Error while reading the response: %v", err)
+	}
+	return resp.StatusCode, respBody
+}
+
+// nextStep asks for the next step of the worker, and fails the test unless
+// there is one.
+func nextStep(t *testing.T, ts *httptest.Server, worker int) Step {
+	t.Helper()
+	code, body := request(t, ts, http.MethodGet, workerPath("mnist", worker)+"/step?timeout=5s", testToken, nil)
+	if code != http.StatusOK {
+		t.Fatalf("GET step of worker %d = %d %q, want %d", worker, code, body, http.StatusOK)
+	}
+	var step Step
+	if err := json.Unmarshal(body, &step); err != nil {
+		t.Fatalf("Error while reading the step: %v", err)
+	}
+	return step
+}
+
+func ack(t *testing.T, ts *httptest.Server, worker int, id string, ack Ack) int {
+	t.Helper()
+	body, err := json.Marshal(ack)
+	if err != nil {
+		t.Fatalf("Error while writing the acknowledgment: %v", err)
+	}
+	code, _ := request(t, ts, http.MethodPost, workerPath("mnist", worker)+"/steps/"+id, testToken, body)
+	return code
+}
+
+type doResult struct {
+	failed map[int]string
+	err    error
+}
+
+// doAsync assigns the step in the background and returns the channel its
+// result is sent on.
+func doAsync(run *Run, step Step, workers ...int) chan doResult {
+	result := make(chan doResult, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+		defer cancel()
+		failed, err := run.Do(ctx, step, workers...)
+		result <- doResult{failed: failed, err: err}
+	}()
+	return result
+}
+
+func TestServeSteps(t *testing.T) {
+	server, ts := newTestServer(t)
+	run := server.Register("default", "mnist", 2, testToken)
+
+	train := Step{ID: "epoch-1-minibatch-1-train", Action: ActionTrain, Epoch: 1, MiniBatch: 1, EndingIndex: 2}
+	done := doAsync(run, train)
+
+	for worker := 0; worker < 2; worker++ {
+		if step := nextStep(t, ts, worker); !reflect.DeepEqual(step, train) {
+			t.Errorf("step of worker %d = %+v, want %+v", worker, step, train)
+		}
+	}
+
+	if code := ack(t, ts, 0, train.ID, Ack{}); code != http.StatusNoContent {
+		t.Errorf("ack of worker 0 = %d, want %d", code, http.StatusNoContent)
+	}
+	// Workers retry their acknowledgments when they are not sure they went
+	// through
+	if code := ack(t, ts, 0, train.ID, Ack{}); code != http.StatusNoContent {
+		t.Errorf("duplicate ack of worker 0 = %d, want %d", code, http.StatusNoContent)
+	}
+	if pending := run.Pending(); !reflect.DeepEqual(pending, []int{1}) {
+		t.Errorf("pending workers = %v, want [1]", pending)
+	}
+
+	if code := ack(t, ts, 1, train.ID, Ack{Error: "out of memory"}); code != http.StatusNoContent {
+		t.Errorf("ack of worker 1 = %d, want %d", code, http.StatusNoContent)
+	}
+	result := <-done
+	if result.err != nil {
+		t.Fatalf("Do() error: %v", result.err)
+	}
+	if want := map[int]string{1: "out of memory"}; !reflect.DeepEqual(result.failed, want) {
+		t.Errorf("failed workers = %v, want %v", result.failed, want)
+	}
+
+	// Nothing is left for the workers until the next step
+	code, _ := request(t, ts, http.MethodGet, workerPath("mnist", 0)+"/step?timeout=10ms", testToken, nil)
+	if code != http.StatusNoContent {
+		t.Errorf("GET step with none assigned = %d, want %d", code, http.StatusNoContent)
+	}
+
+	aggregate := Step{ID: "epoch-1-minibatch-1-aggregate", Action: ActionAggregate, Gradients: []int{0, 1}}
+	done = doAsync(run, aggregate, 0)
+	if step := nextStep(t, ts, 0); step.ID != aggregate.ID {
+		t.Errorf("next step of worker 0 = %s, want %s", step.ID, aggregate.ID)
+	}
+	if code := ack(t, ts, 1, train.ID, Ack{}); code != http.StatusConflict {
+		t.Errorf("ack of a stale step = %d, want %d", code, http.StatusConflict)
+	}
+	if code := ack(t, ts, 0, aggregate.ID, Ack{}); code != http.StatusNoContent {
+		t.Errorf("ack of worker 0 = %d, want %d", code, http.StatusNoContent)
+	}
+	if result := <-done; result.err != nil || len(result.failed) != 0 {
+		t.Errorf("Do() = %v, %v, want the step to succeed", result.failed, result.err)
+	}
+}
+
+func TestServeRejects(t *testing.T) {
+	server, ts := newTestServer(t)
+	server.Register("default", "mnist", 2, testToken)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{name: "unknown run", method: http.MethodGet, path: workerPath("cifar", 0) + "/step", token: testToken, want: http.StatusNotFound},
+		{name: "unknown worker", method: http.MethodGet, path: workerPath("mnist", 2) + "/step", token: testToken, want: http.StatusNotFound},
+		{name: "invalid worker", method: http.MethodGet, path: BasePath + "default/traininkubes/mnist/workers/first/step", token: testToken, want: http.StatusBadRequest},
+		{name: "unknown path", method: http.MethodGet, path: workerPath("mnist", 0) + "/steps", token: testToken, want: http.StatusNotFound},
+		{name: "no token", method: http.MethodGet, path: workerPath("mnist", 0) + "/step", want: http.StatusUnauthorized},
+		{name: "wrong token", method: http.MethodPost, path: workerPath("mnist", 0) + "/steps/stop", token: "guess", want: http.StatusUnauthorized},
+		{name: "invalid timeout", method: http.MethodGet, path: workerPath("mnist", 0) + "/step?timeout=soon", token: testToken, want: http.StatusBadRequest},
+		{name: "wrong method", method: http.MethodPost, path: workerPath("mnist", 0) + "/step", token: testToken, want: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, body := request(t, ts, tt.method, tt.path, tt.token, nil); code != tt.want {
+				t.Errorf("%s %s = %d %q, want %d", tt.method, tt.path, code, body, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnregisterDuringPoll(t *testing.T) {
+	server, ts := newTestServer(t)
+	run := server.Register("default", "mnist", 2, testToken)
+	done := doAsync(run, Step{ID: "stop", Action: ActionStop}, 1)
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+workerPath("mnist", 0)+"/step?timeout=1m", nil)
+	if err != nil {
+		t.Fatalf("Error while creating the request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	polled := make(chan int, 1)
+	go func() {
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			polled <- 0
+			return
+		}
+		resp.Body.Close()
+		polled <- resp.StatusCode
+	}()
+	// Give the worker the time to start waiting
+	time.Sleep(50 * time.Millisecond)
+	server.Unregister(run)
+
+	select {
+	case code := <-polled:
+		if code != http.StatusNotFound {
+			t.Errorf("GET step of an unregistered run = %d, want %d", code, http.StatusNotFound)
+		}
+	case <-time.After(testTimeout):
+		t.Fatalf("The worker kept waiting after the run was unregistered")
+	}
+	if result := <-done; result.err == nil {
+		t.Errorf("Do() succeeded on an unregistered run")
+	}
+	if code := ack(t, ts, 1, "stop", Ack{}); code != http.StatusNotFound {
+		t.Errorf("ack on an unregistered run = %d, want %d", code, http.StatusNotFound)
+	}
+}
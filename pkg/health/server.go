@@ -0,0 +1,125 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gotway/gotway/pkg/log"
+)
+
+// Paths the probes are served on.
+const (
+	LivenessPath  = "/healthz"
+	ReadinessPath = "/readyz"
+)
+
+// Check returns an error when the part of the operator it checks is not
+// healthy.
+type Check func() error
+
+// namedCheck is a check along with the name it is reported under.
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Server serves the liveness and readiness probes of the operator over HTTP.
+type Server struct {
+	addr string
+
+	liveness  []namedCheck
+	readiness []namedCheck
+
+	logger log.Logger
+}
+
+func New(addr string, logger log.Logger) *Server {
+	return &Server{
+		addr:   addr,
+		logger: logger,
+	}
+}
+
+// AddLivenessCheck adds a check that makes the operator restart when it fails.
+// Checks have to be added before the server runs.
+func (s *Server) AddLivenessCheck(name string, check Check) {
+	s.liveness = append(s.liveness, namedCheck{name: name, check: check})
+}
+
+// AddReadinessCheck adds a check that keeps the operator out of the endpoints
+// of its Service while it fails. Checks have to be added before the server
+// runs.
+func (s *Server) AddReadinessCheck(name string, check Check) {
+	s.readiness = append(s.readiness, namedCheck{name: name, check: check})
+}
+
+// Handler returns the handler serving the probes, so that it can also be
+// mounted on a test server.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(LivenessPath, func(w http.ResponseWriter, r *http.Request) {
+		s.serve(w, r, s.liveness)
+	})
+	mux.HandleFunc(ReadinessPath, func(w http.ResponseWriter, r *http.Request) {
+		s.serve(w, r, s.readiness)
+	})
+	return mux
+}
+
+// Run serves the probes until the context is cancelled.
+func (s *Server) Run(ctx context.Context) error {
+	server := &http.Server{
+		Addr:              s.addr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			s.logger.Errorf("Error while shutting down the health server: %v", err)
+		}
+	}()
+
+	s.logger.Infof("Starting the health server on %s", s.addr)
+	err := server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// serve runs all the checks, and answers with 200 when they all pass or with
+// 503 listing the failed ones. The result of every check is listed when the
+// verbose query parameter is set.
+func (s *Server) serve(w http.ResponseWriter, r *http.Request, checks []namedCheck) {
+	_, verbose := r.URL.Query()["verbose"]
+
+	var report strings.Builder
+	failed := false
+	for _, c := range checks {
+		if err := c.check(); err != nil {
+			failed = true
+			fmt.Fprintf(&report, "[-] %s failed: %v\n", c.name, err)
+		} else if verbose {
+			fmt.Fprintf(&report, "[+] %s ok\n", c.name)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if failed {
+		s.logger.Warnf("Failing the %s probe:\n%s", r.URL.Path, report.String())
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, report.String())
+		return
+	}
+	fmt.Fprint(w, report.String())
+	fmt.Fprint(w, "ok\n")
+}
@@ -0,0 +1,53 @@
+package health
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gotway/gotway/pkg/log"
+)
+
+func get(t *testing.T, ts *httptest.Server, path string) (int, string) {
+	t.Helper()
+	resp, err := ts.Client().Get(ts.URL + path)
+	if err != nil {
+		t.Fatalf("Error while getting %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Error while reading the response: %v", err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func TestServe(t *testing.T) {
+	var readyErr error
+	server := New("", log.NewLogger(log.Fields{}, "local", "error", io.Discard))
+	server.AddLivenessCheck("workers", func() error { return nil })
+	server.AddReadinessCheck("informers", func() error { return readyErr })
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	if code, body := get(t, ts, LivenessPath); code != http.StatusOK || body != "ok\n" {
+		t.Errorf("liveness = %d %q, want %d %q", code, body, http.StatusOK, "ok\n")
+	}
+
+	readyErr = errors.New("the informers are not synced yet")
+	code, body := get(t, ts, ReadinessPath)
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("readiness = %d, want %d", code, http.StatusServiceUnavailable)
+	}
+	if !strings.Contains(body, "[-] informers failed: the informers are not synced yet") {
+		t.Errorf("readiness report %q does not name the failed check", body)
+	}
+
+	readyErr = nil
+	if code, body := get(t, ts, ReadinessPath+"?verbose"); code != http.StatusOK || body != "[+] informers ok\nok\n" {
+		t.Errorf("verbose readiness = %d %q, want %d %q", code, body, http.StatusOK, "[+] informers ok\nok\n")
+	}
+}
@@ -0,0 +1,171 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes the names of all the metrics of the operator.
+const namespace = "traininkubes"
+
+// Registry holds all the metrics of the operator, along with the metrics of the
+// Go runtime and of the process.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// ReconcileDuration is the time taken to reconcile a TrainInKube, by the
+	// result of the reconciliation, either success or error.
+	ReconcileDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "reconcile_duration_seconds",
+		Help:      "Time taken to reconcile a TrainInKube.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"result"})
+
+	// StageDuration is the time taken by a stage of a run, from the creation of
+	// its jobs to the end of the last of them. Minibatches have one train and
+	// one aggregate stage each.
+	StageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "stage_duration_seconds",
+		Help:      "Time taken by a stage of a run, by stage.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 15),
+	}, []string{"stage"})
+
+	// JobDuration is the time from the start of a job to its end, by stage and
+	// by result, either succeeded or failed.
+	JobDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "job_duration_seconds",
+		Help:      "Time from the start of a job to its end, by stage and result.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 15),
+	}, []string{"stage", "result"})
+
+	JobsCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "jobs_created_total",
+		Help:      "Jobs created by the operator, by stage.",
+	}, []string{"stage"})
+
+	JobsDeleted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "jobs_deleted_total",
+		Help:      "Jobs of runs that were deleted, by stage.",
+	}, []string{"stage"})
+
+	JobsFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "jobs_failed_total",
+		Help:      "Jobs of runs that failed, by stage.",
+	}, []string{"stage"})
+
+	// JobRequestErrors counts the requests to create or delete jobs that were
+	// rejected by the API server, by operation.
+	JobRequestErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "job_request_errors_total",
+		Help:      "Requests to create or delete jobs that failed, by operation.",
+	}, []string{"operation"})
+
+	// StragglerWorkers counts the workers handled by the straggler policies
+	// of the runs, by the action taken: "backup" when a backup copy of the
+	// worker was started, "stopped" when it was stopped before finishing.
+	StragglerWorkers = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "straggler_workers_total",
+		Help:      "Slow workers handled by the straggler policies of the runs, by action.",
+	}, []string{"action"})
+
+	ActiveOrchestrators = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_orchestrators",
+		Help:      "Runs being orchestrated by the operator.",
+	})
+
+	runEpoch = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "run_epoch",
+		Help:      "Epoch being trained by a run, counting from 1.",
+	}, []string{"namespace", "name"})
+
+	runEpochs = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "run_epochs",
+		Help:      "Number of epochs of a run.",
+	}, []string{"namespace", "name"})
+
+	runMiniBatch = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "run_minibatch",
+		Help:      "Minibatch being trained by a run, counting from 1.",
+	}, []string{"namespace", "name"})
+
+	runMiniBatches = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "run_minibatches",
+		Help:      "Number of minibatches in each epoch of a run.",
+	}, []string{"namespace", "name"})
+
+	runLastProgress = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "run_last_progress_timestamp_seconds",
+		Help:      "Time a run last finished a minibatch, or started, as a Unix timestamp.",
+	}, []string{"namespace", "name"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		ReconcileDuration,
+		StageDuration,
+		JobDuration,
+		JobsCreated,
+		JobsDeleted,
+		JobsFailed,
+		JobRequestErrors,
+		StragglerWorkers,
+		ActiveOrchestrators,
+		runEpoch,
+		runEpochs,
+		runMiniBatch,
+		runMiniBatches,
+		runLastProgress,
+	)
+}
+
+// Handler returns the handler serving the metrics in the Prometheus format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// SetRunSize records the number of epochs of a run, and the number of
+// minibatches in each of them.
+func SetRunSize(namespace string, name string, epochs int, miniBatches int) {
+	runEpochs.WithLabelValues(namespace, name).Set(float64(epochs))
+	runMiniBatches.WithLabelValues(namespace, name).Set(float64(miniBatches))
+}
+
+// SetRunProgress records the epoch and the minibatch being trained by a run,
+// counting from 1.
+func SetRunProgress(namespace string, name string, epoch int, miniBatch int) {
+	runEpoch.WithLabelValues(namespace, name).Set(float64(epoch))
+	runMiniBatch.WithLabelValues(namespace, name).Set(float64(miniBatch))
+}
+
+// MarkRunProgress records that a run moved forward, which stuck runs stop
+// doing.
+func MarkRunProgress(namespace string, name string) {
+	runLastProgress.WithLabelValues(namespace, name).Set(float64(time.Now().Unix()))
+}
+
+// DeleteRun removes the metrics of a run once it is no longer orchestrated.
+func DeleteRun(namespace string, name string) {
+	for _, gauge := range []*prometheus.GaugeVec{runEpoch, runEpochs, runMiniBatch, runMiniBatches, runLastProgress} {
+		gauge.DeleteLabelValues(namespace, name)
+	}
+}
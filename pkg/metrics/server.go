@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gotway/gotway/pkg/log"
+)
+
+// Path the metrics are served on.
+const Path = "/metrics"
+
+// Server serves the metrics of the operator over HTTP.
+type Server struct {
+	addr string
+
+	logger log.Logger
+}
+
+func NewServer(addr string, logger log.Logger) *Server {
+	return &Server{
+		addr:   addr,
+		logger: logger,
+	}
+}
+
+// Handler returns the handler serving the metrics, so that it can also be
+// mounted on a test server.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(Path, Handler())
+	return mux
+}
+
+// Run serves the metrics until the context is cancelled.
+func (s *Server) Run(ctx context.Context) error {
+	server := &http.Server{
+		Addr:              s.addr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			s.logger.Errorf("Error while shutting down the metrics server: %v", err)
+		}
+	}()
+
+	s.logger.Infof("Starting the metrics server on %s", s.addr)
+	err := server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gotway/gotway/pkg/log"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// scrape gets the metrics from the server like Prometheus does, and returns
+// them by name.
+func scrape(t *testing.T, ts *httptest.Server) map[string]*dto.MetricFamily {
+	t.Helper()
+	resp, err := ts.Client().Get(ts.URL + Path)
+	if err != nil {
+		t.Fatalf("Error while scraping the metrics: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Got status %d for %s", resp.StatusCode, Path)
+	}
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(resp.Body)
+	if err != nil {
+		t.Fatalf("Error while parsing the metrics: %v", err)
+	}
+	return families
+}
+
+// find returns the metric of the family with the labels, or nil when there is
+// none.
+func find(families map[string]*dto.MetricFamily, name string, labels map[string]string) *dto.Metric {
+	family, ok := families[name]
+	if !ok {
+		return nil
+	}
+	for _, metric := range family.GetMetric() {
+		matched := 0
+		for _, pair := range metric.GetLabel() {
+			if value, ok := labels[pair.GetName()]; ok && value == pair.GetValue() {
+				matched++
+			}
+		}
+		if matched == len(labels) {
+			return metric
+		}
+	}
+	return nil
+}
+
+func value(t *testing.T, families map[string]*dto.MetricFamily, name string, labels map[string]string) float64 {
+	t.Helper()
+	metric := find(families, name, labels)
+	if metric == nil {
+		t.Fatalf("No %s metric with the labels %v", name, labels)
+	}
+	switch {
+	case metric.Gauge != nil:
+		return metric.Gauge.GetValue()
+	case metric.Counter != nil:
+		return metric.Counter.GetValue()
+	case metric.Histogram != nil:
+		return float64(metric.Histogram.GetSampleCount())
+	}
+	t.Fatalf("Unsupported type of the %s metric", name)
+	return 0
+}
+
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	logger := log.NewLogger(log.Fields{}, "local", "error", io.Discard)
+	ts := httptest.NewServer(NewServer("", logger).Handler())
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestWorkqueueMetrics(t *testing.T) {
+	ts := newTestServer(t)
+
+	queue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "testqueue")
+	defer queue.ShutDown()
+	queue.Add("default/first")
+	queue.Add("default/second")
+	queue.AddRateLimited("default/third")
+
+	labels := map[string]string{"name": "testqueue"}
+	families := scrape(t, ts)
+	if depth := value(t, families, "traininkubes_workqueue_depth", labels); depth != 2 {
+		t.Errorf("Got a depth of %v, want 2", depth)
+	}
+	if retries := value(t, families, "traininkubes_workqueue_retries_total", labels); retries != 1 {
+		t.Errorf("Got %v retries, want 1", retries)
+	}
+}
+
+func TestOperatorMetrics(t *testing.T) {
+	ts := newTestServer(t)
+
+	ReconcileDuration.WithLabelValues("success").Observe((100 * time.Millisecond).Seconds())
+	JobsCreated.WithLabelValues("train").Add(6)
+	JobsCreated.WithLabelValues("aggregate").Inc()
+
+	families := scrape(t, ts)
+	if count := value(t, families, "traininkubes_reconcile_duration_seconds", map[string]string{"result": "success"}); count != 1 {
+		t.Errorf("Got %v reconciliations, want 1", count)
+	}
+	if created := value(t, families, "traininkubes_jobs_created_total", map[string]string{"stage": "train"}); created != 6 {
+		t.Errorf("Got %v train jobs created, want 6", created)
+	}
+	if created := value(t, families, "traininkubes_jobs_created_total", map[string]string{"stage": "aggregate"}); created != 1 {
+		t.Errorf("Got %v aggregate jobs created, want 1", created)
+	}
+}
+
+func TestRunMetrics(t *testing.T) {
+	ts := newTestServer(t)
+	run := map[string]string{"namespace": "team-a", "name": "example"}
+
+	SetRunSize("team-a", "example", 10, 20)
+	SetRunProgress("team-a", "example", 3, 7)
+	MarkRunProgress("team-a", "example")
+
+	families := scrape(t, ts)
+	for name, want := range map[string]float64{
+		"traininkubes_run_epoch":       3,
+		"traininkubes_run_epochs":      10,
+		"traininkubes_run_minibatch":   7,
+		"traininkubes_run_minibatches": 20,
+	} {
+		if got := value(t, families, name, run); got != want {
+			t.Errorf("Got %v for %s, want %v", got, name, want)
+		}
+	}
+	if find(families, "traininkubes_run_last_progress_timestamp_seconds", run) == nil {
+		t.Errorf("No last progress of the run")
+	}
+
+	DeleteRun("team-a", "example")
+	families = scrape(t, ts)
+	for _, name := range []string{
+		"traininkubes_run_epoch",
+		"traininkubes_run_epochs",
+		"traininkubes_run_minibatch",
+		"traininkubes_run_minibatches",
+		"traininkubes_run_last_progress_timestamp_seconds",
+	} {
+		if find(families, name, run) != nil {
+			t.Errorf("The %s metric of the deleted run is still served", name)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package paramserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// StatusError is returned by the client when the server answers with an error.
+type StatusError struct {
+	Code    int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("parameter server answered with %d: %s", e.Code, e.Message)
+}
+
+// IsConflict reports whether the server refused the request because the weights
+// are not at the step of the request, or are already set.
+func IsConflict(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.Code == http.StatusConflict
+}
+
+// Client talks to a parameter server, for the operator as well as for workers
+// written in Go.
+type Client struct {
+	url    string
+	client *http.Client
+}
+
+// NewClient returns a client of the parameter server at the URL. The default
+// HTTP client is used when none is given.
+func NewClient(url string, client *http.Client) *Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Client{
+		url:    strings.TrimSuffix(url, "/"),
+		client: client,
+	}
+}
+
+// Healthy reports whether the server is serving.
+func (c *Client) Healthy(ctx context.Context) error {
+	return c.do(ctx, http.MethodGet, HealthPath, nil, nil)
+}
+
+// Status returns the state of the server.
+func (c *Client) Status(ctx context.Context) (*Status, error) {
+	var status Status
+	if err := c.do(ctx, http.MethodGet, BasePath+"status", nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Weights returns the weights, which have to be at the given version unless it
+// is negative.
+func (c *Client) Weights(ctx context.Context, version int) (*Weights, error) {
+	path := BasePath + "weights"
+	if version >= 0 {
+		path += "?version=" + strconv.Itoa(version)
+	}
+	var weights Weights
+	if err := c.do(ctx, http.MethodGet, path, nil, &weights); err != nil {
+		return nil, err
+	}
+	return &weights, nil
+}
+
+// InitWeights sets the weights before the first step.
+func (c *Client) InitWeights(ctx context.Context, tensors []Tensor) error {
+	return c.do(ctx, http.MethodPut, BasePath+"weights", Weights{Tensors: tensors}, nil)
+}
+
+// PushGradients sends the gradients of the step under the index.
+func (c *Client) PushGradients(ctx context.Context, step int, index int, tensors []Tensor) error {
+	path := fmt.Sprintf("%ssteps/%d/gradients/%d", BasePath, step, index)
+	return c.do(ctx, http.MethodPut, path, Gradients{Tensors: tensors}, nil)
+}
+
+// Apply averages the gradients of the step with the given indices into the
+// weights.
+func (c *Client) Apply(ctx context.Context, step int, gradients []int) error {
+	path := fmt.Sprintf("%ssteps/%d/apply", BasePath, step)
+	return c.do(ctx, http.MethodPost, path, Update{Gradients: gradients}, nil)
+}
+
+func (c *Client) do(ctx context.Context, method string, path string, in interface{}, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, c.url+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		return &StatusError{Code: response.StatusCode, Message: strings.TrimSpace(string(message))}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(response.Body).Decode(out)
+}
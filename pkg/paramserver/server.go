@@ -0,0 +1,597 @@
+package paramserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotway/gotway/pkg/log"
+)
+
+// BasePath is the prefix of the paths served to the workers and the operator:
+//
+//	GET  /v1/status
+//	GET  /v1/weights?version=<version>
+//	PUT  /v1/weights
+//	PUT  /v1/steps/<step>/gradients/<index>
+//	POST /v1/steps/<step>/apply
+//
+// The weights are returned with the number of updates applied to them as their
+// version, and 409 when the version query parameter is set to another one. They
+// are set once with a PUT before the first step, after which another PUT gets a
+// 409. The workers push the gradients of the step the weights are at under the
+// index of their gradients, and the step is applied with an Update as the body,
+// which averages the listed gradients into the weights and moves them to the
+// next version. Applying the previous step again with the same gradients is a
+// no-op, so that the operator can retry it.
+//
+// With a checkpoint, the weights are written to it every time they change, and
+// read back when the server starts, so that they outlive its pod. A checkpoint
+// written for another run is ignored. The gradients pushed for the step in
+// progress are only kept in memory.
+const BasePath = "/v1/"
+
+// HealthPath answers with 200 as long as the server is serving.
+const HealthPath = "/healthz"
+
+// DefaultLearningRate is the learning rate of the gradient descent when none is
+// given.
+const DefaultLearningRate = 0.01
+
+// maxBodySize caps the size of the weights and the gradients sent to the server.
+const maxBodySize = 1 << 30
+
+// requestError is an error of a request, answered with the status code.
+type requestError struct {
+	code    int
+	message string
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
+var (
+	errNotInitialized = &requestError{code: http.StatusNotFound, message: "the weights are not set"}
+	errInitialized    = &requestError{code: http.StatusConflict, message: "the weights are already set"}
+)
+
+// conflict returns the error of a request that does not match the step the
+// weights are at.
+func conflict(format string, args ...interface{}) error {
+	return &requestError{code: http.StatusConflict, message: fmt.Sprintf(format, args...)}
+}
+
+// Tensor is a dense tensor, such as the weights or the gradients of a layer,
+// with its values in row-major order.
+type Tensor struct {
+	Shape  []int     `json:"shape"`
+	Values []float32 `json:"values"`
+}
+
+// Weights are the weights of the model after Version steps were applied.
+type Weights struct {
+	Version int      `json:"version"`
+	Tensors []Tensor `json:"tensors"`
+}
+
+// Gradients are the gradients of a worker, one tensor for each of the weights.
+type Gradients struct {
+	Tensors []Tensor `json:"tensors"`
+}
+
+// Update lists the indices of the gradients averaged into the weights by a step.
+type Update struct {
+	Gradients []int `json:"gradients"`
+}
+
+// Status is the state of the server. Gradients are the sorted indices of the
+// gradients pushed for the step the weights are at.
+type Status struct {
+	Initialized bool  `json:"initialized"`
+	Version     int   `json:"version"`
+	Gradients   []int `json:"gradients"`
+}
+
+// checkpoint is what the server writes to its checkpoint.
+type checkpoint struct {
+	Run     string  `json:"run"`
+	Weights Weights `json:"weights"`
+	Applied []int   `json:"applied"`
+}
+
+// Server keeps the weights of a single run, and updates them with the averaged
+// gradients of the workers through stochastic gradient descent.
+type Server struct {
+	addr         string
+	learningRate float32
+	// checkpoint is the file the weights are saved to, if any, for the run
+	checkpoint string
+	run        string
+
+	weights   []Tensor
+	version   int
+	gradients map[int][]Tensor
+	// applied are the gradients of the last step, so that it can be applied
+	// again without changing the weights.
+	applied []int
+	lock    sync.Mutex
+
+	logger log.Logger
+}
+
+// New returns a server keeping the weights of the run in the checkpoint file, or
+// only in memory when the checkpoint is empty.
+func New(addr string, learningRate float64, checkpoint string, run string, logger log.Logger) *Server {
+	return &Server{
+		addr:         addr,
+		learningRate: float32(learningRate),
+		checkpoint:   checkpoint,
+		run:          run,
+		gradients:    map[int][]Tensor{},
+		logger:       logger,
+	}
+}
+
+// Restore reads the weights back from the checkpoint, if it was written for the
+// run.
+func (s *Server) Restore() error {
+	if s.checkpoint == "" {
+		return nil
+	}
+	data, err := os.ReadFile(s.checkpoint)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Error while reading the checkpoint: %v", err)
+	}
+
+	var saved checkpoint
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("Error while reading the checkpoint %s: %v", s.checkpoint, err)
+	}
+	if saved.Run != s.run {
+		s.logger.Infof("Ignoring the checkpoint %s of run %q", s.checkpoint, saved.Run)
+		return nil
+	}
+	if err := validateTensors(saved.Weights.Tensors); err != nil {
+		return fmt.Errorf("Invalid weights in the checkpoint %s: %v", s.checkpoint, err)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.weights = saved.Weights.Tensors
+	s.version = saved.Weights.Version
+	s.applied = saved.Applied
+	s.logger.Infof("Restored the weights at version %d from %s", s.version, s.checkpoint)
+	return nil
+}
+
+// save writes the weights to the checkpoint. The file is replaced at once, so
+// that a server stopped while writing it keeps the previous weights. It is
+// called with the lock held.
+func (s *Server) save() error {
+	if s.checkpoint == "" {
+		return nil
+	}
+	data, err := json.Marshal(checkpoint{
+		Run:     s.run,
+		Weights: Weights{Version: s.version, Tensors: s.weights},
+		Applied: s.applied,
+	})
+	if err != nil {
+		return fmt.Errorf("Error while writing the checkpoint: %v", err)
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(s.checkpoint), filepath.Base(s.checkpoint)+".*")
+	if err != nil {
+		return fmt.Errorf("Error while writing the checkpoint: %v", err)
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), s.checkpoint)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return fmt.Errorf("Error while writing the checkpoint: %v", err)
+	}
+	return nil
+}
+
+// Handler returns the handler serving the workers and the operator, so that it
+// can also be mounted on a test server.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(BasePath, s.serve)
+	mux.HandleFunc(HealthPath, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	return mux
+}
+
+// Run serves the workers until the context is cancelled, starting from the
+// weights of the checkpoint.
+func (s *Server) Run(ctx context.Context) error {
+	if err := s.Restore(); err != nil {
+		return err
+	}
+
+	server := &http.Server{
+		Addr:              s.addr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			s.logger.Errorf("Error while shutting down the parameter server: %v", err)
+		}
+	}()
+
+	s.logger.Infof("Starting the parameter server on %s", s.addr)
+	err := server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	// status, weights, steps/<step>/gradients/<index> or steps/<step>/apply
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, BasePath), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "status":
+		if !allowMethod(w, r, http.MethodGet) {
+			return
+		}
+		s.writeJSON(w, s.status())
+	case len(parts) == 1 && parts[0] == "weights":
+		switch r.Method {
+		case http.MethodGet:
+			s.serveWeights(w, r)
+		case http.MethodPut:
+			s.serveInit(w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	case len(parts) == 4 && parts[0] == "steps" && parts[2] == "gradients":
+		if !allowMethod(w, r, http.MethodPut) {
+			return
+		}
+		step, ok := parseIndex(w, "step", parts[1])
+		if !ok {
+			return
+		}
+		index, ok := parseIndex(w, "gradient index", parts[3])
+		if !ok {
+			return
+		}
+		s.servePush(w, r, step, index)
+	case len(parts) == 3 && parts[0] == "steps" && parts[2] == "apply":
+		if !allowMethod(w, r, http.MethodPost) {
+			return
+		}
+		step, ok := parseIndex(w, "step", parts[1])
+		if !ok {
+			return
+		}
+		s.serveApply(w, r, step)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) serveWeights(w http.ResponseWriter, r *http.Request) {
+	version := -1
+	if value := r.URL.Query().Get("version"); value != "" {
+		parsed, ok := parseIndex(w, "version", value)
+		if !ok {
+			return
+		}
+		version = parsed
+	}
+
+	weights, err := s.currentWeights(version)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	s.writeJSON(w, weights)
+}
+
+func (s *Server) serveInit(w http.ResponseWriter, r *http.Request) {
+	var weights Weights
+	if !readJSON(w, r, &weights) {
+		return
+	}
+	if weights.Version != 0 {
+		http.Error(w, "the weights can only be set before the first step", http.StatusConflict)
+		return
+	}
+	if err := validateTensors(weights.Tensors); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.init(weights.Tensors); err != nil {
+		writeError(w, err)
+		return
+	}
+	s.logger.Infof("Set the weights, %d tensors", len(weights.Tensors))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) servePush(w http.ResponseWriter, r *http.Request, step int, index int) {
+	var gradients Gradients
+	if !readJSON(w, r, &gradients) {
+		return
+	}
+
+	if err := s.push(step, index, gradients.Tensors); err != nil {
+		writeError(w, err)
+		return
+	}
+	s.logger.Debugf("Received gradients %d of step %d", index, step)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) serveApply(w http.ResponseWriter, r *http.Request, step int) {
+	var update Update
+	if !readJSON(w, r, &update) {
+		return
+	}
+	if len(update.Gradients) == 0 {
+		http.Error(w, "the update has no gradients", http.StatusBadRequest)
+		return
+	}
+
+	applied, err := s.apply(step, update.Gradients)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if applied {
+		s.logger.Infof("Applied step %d with gradients %v", step, update.Gradients)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) status() Status {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	gradients := make([]int, 0, len(s.gradients))
+	for index := range s.gradients {
+		gradients = append(gradients, index)
+	}
+	sort.Ints(gradients)
+	return Status{
+		Initialized: s.weights != nil,
+		Version:     s.version,
+		Gradients:   gradients,
+	}
+}
+
+// currentWeights returns the weights, which have to be at the given version
+// unless it is negative.
+func (s *Server) currentWeights(version int) (*Weights, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.weights == nil {
+		return nil, errNotInitialized
+	}
+	if version >= 0 && version != s.version {
+		return nil, conflict("asked for version %d, the weights are at version %d", version, s.version)
+	}
+	// The tensors are only replaced, never changed in place, so they can
+	// be encoded once the lock is released
+	return &Weights{Version: s.version, Tensors: s.weights}, nil
+}
+
+func (s *Server) init(tensors []Tensor) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.weights != nil {
+		return errInitialized
+	}
+	s.weights = tensors
+	if err := s.save(); err != nil {
+		s.weights = nil
+		return err
+	}
+	return nil
+}
+
+func (s *Server) push(step int, index int, tensors []Tensor) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.weights == nil {
+		return errNotInitialized
+	}
+	if step != s.version {
+		return conflict("got gradients of step %d, the weights are at step %d", step, s.version)
+	}
+	if err := matchShapes(s.weights, tensors); err != nil {
+		return &requestError{code: http.StatusBadRequest, message: err.Error()}
+	}
+	// Gradients pushed again, by a worker that was retried, replace the
+	// earlier ones
+	s.gradients[index] = tensors
+	return nil
+}
+
+// apply averages the gradients into the weights, and reports whether they were
+// changed, which they are not when the step was already applied.
+func (s *Server) apply(step int, indices []int) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.weights == nil {
+		return false, errNotInitialized
+	}
+	indices = sortedUnique(indices)
+	if step == s.version-1 && equalInts(indices, s.applied) {
+		return false, nil
+	}
+	if step != s.version {
+		return false, conflict("asked to apply step %d, the weights are at step %d", step, s.version)
+	}
+
+	var missing []int
+	for _, index := range indices {
+		if _, ok := s.gradients[index]; !ok {
+			missing = append(missing, index)
+		}
+	}
+	if len(missing) > 0 {
+		return false, conflict("missing gradients %v of step %d", missing, step)
+	}
+
+	scale := s.learningRate / float32(len(indices))
+	weights := make([]Tensor, len(s.weights))
+	for i, tensor := range s.weights {
+		values := make([]float32, len(tensor.Values))
+		copy(values, tensor.Values)
+		for _, index := range indices {
+			for j, gradient := range s.gradients[index][i].Values {
+				values[j] -= scale * gradient
+			}
+		}
+		weights[i] = Tensor{Shape: tensor.Shape, Values: values}
+	}
+
+	previous, previousApplied := s.weights, s.applied
+	s.weights = weights
+	s.version++
+	s.applied = indices
+	// The step is only applied once it is saved, so that it is never lost
+	// after being acknowledged
+	if err := s.save(); err != nil {
+		s.weights, s.applied = previous, previousApplied
+		s.version--
+		return false, err
+	}
+	s.gradients = map[int][]Tensor{}
+	return true, nil
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.logger.Errorf("Error while writing the response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	var requestErr *requestError
+	if errors.As(err, &requestErr) {
+		http.Error(w, requestErr.message, requestErr.code)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(v)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid body: %v", err), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func parseIndex(w http.ResponseWriter, name string, value string) (int, bool) {
+	index, err := strconv.Atoi(value)
+	if err != nil || index < 0 {
+		http.Error(w, fmt.Sprintf("invalid %s %q", name, value), http.StatusBadRequest)
+		return 0, false
+	}
+	return index, true
+}
+
+// validateTensors checks that every tensor has as many values as its shape.
+func validateTensors(tensors []Tensor) error {
+	if len(tensors) == 0 {
+		return errors.New("no tensors")
+	}
+	for i, tensor := range tensors {
+		size := 1
+		for _, dimension := range tensor.Shape {
+			if dimension < 0 {
+				return fmt.Errorf("tensor %d has a negative dimension in shape %v", i, tensor.Shape)
+			}
+			size *= dimension
+		}
+		if size != len(tensor.Values) {
+			return fmt.Errorf("tensor %d has %d values for shape %v", i, len(tensor.Values), tensor.Shape)
+		}
+	}
+	return nil
+}
+
+// matchShapes checks that the gradients have the shapes of the weights.
+func matchShapes(weights []Tensor, gradients []Tensor) error {
+	if len(gradients) != len(weights) {
+		return fmt.Errorf("got %d gradient tensors for %d weight tensors", len(gradients), len(weights))
+	}
+	for i := range gradients {
+		if !equalInts(gradients[i].Shape, weights[i].Shape) || len(gradients[i].Values) != len(weights[i].Values) {
+			return fmt.Errorf("gradient tensor %d does not have the shape %v of the weights", i, weights[i].Shape)
+		}
+	}
+	return nil
+}
+
+func sortedUnique(numbers []int) []int {
+	sorted := append([]int(nil), numbers...)
+	sort.Ints(sorted)
+	unique := sorted[:0]
+	for i, number := range sorted {
+		if i == 0 || number != sorted[i-1] {
+			unique = append(unique, number)
+		}
+	}
+	return unique
+}
+
+func equalInts(a []int, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
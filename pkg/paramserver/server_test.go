@@ -0,0 +1,269 @@
+package paramserver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/gotway/gotway/pkg/log"
+)
+
+// learningRate is a power of two, so that the updates are exact in float32.
+const learningRate = 0.5
+
+func newTestClient(t *testing.T) *Client {
+	t.Helper()
+	return serve(t, newTestServer(t, "", ""))
+}
+
+func newTestServer(t *testing.T, checkpoint string, run string) *Server {
+	t.Helper()
+	logger := log.NewLogger(log.Fields{}, "local", "error", io.Discard)
+	server := New("", learningRate, checkpoint, run, logger)
+	if err := server.Restore(); err != nil {
+		t.Fatalf("Error while restoring the checkpoint: %v", err)
+	}
+	return server
+}
+
+// serve serves the server until the test ends, and returns a client of it.
+func serve(t *testing.T, server *Server) *Client {
+	t.Helper()
+	ts := httptest.NewServer(server.Handler())
+	t.Cleanup(ts.Close)
+	return NewClient(ts.URL, ts.Client())
+}
+
+func initialWeights() []Tensor {
+	return []Tensor{
+		{Shape: []int{2, 2}, Values: []float32{1, 2, 3, 4}},
+		{Shape: []int{1}, Values: []float32{10}},
+	}
+}
+
+// workerGradients are the gradients pushed by the fake worker with the index.
+func workerGradients(index int) []Tensor {
+	g := float32(index + 1)
+	return []Tensor{
+		{Shape: []int{2, 2}, Values: []float32{g, 2 * g, 0, -g}},
+		{Shape: []int{1}, Values: []float32{4 * g}},
+	}
+}
+
+// runWorkers runs the fake workers of the step concurrently, which pull the
+// weights at the step and push their gradients.
+func runWorkers(t *testing.T, client *Client, step int, indices []int) {
+	t.Helper()
+	ctx := context.Background()
+	errs := make(chan error, len(indices))
+	var wg sync.WaitGroup
+	for _, index := range indices {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			if _, err := client.Weights(ctx, step); err != nil {
+				errs <- err
+				return
+			}
+			errs <- client.PushGradients(ctx, step, index, workerGradients(index))
+		}(index)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Error in a worker of step %d: %v", step, err)
+		}
+	}
+}
+
+func statusCode(err error) int {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Code
+	}
+	return 0
+}
+
+func TestInitWeights(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+
+	if _, err := client.Weights(ctx, -1); statusCode(err) != http.StatusNotFound {
+		t.Fatalf("Got %v for the weights before they are set, want 404", err)
+	}
+	if err := client.InitWeights(ctx, initialWeights()); err != nil {
+		t.Fatalf("Error while setting the weights: %v", err)
+	}
+	if err := client.InitWeights(ctx, initialWeights()); !IsConflict(err) {
+		t.Fatalf("Got %v for setting the weights again, want 409", err)
+	}
+
+	weights, err := client.Weights(ctx, 0)
+	if err != nil {
+		t.Fatalf("Error while getting the weights: %v", err)
+	}
+	if weights.Version != 0 || !reflect.DeepEqual(weights.Tensors, initialWeights()) {
+		t.Errorf("Got weights %+v, want the initial ones at version 0", weights)
+	}
+}
+
+func TestPushGradients(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+	if err := client.InitWeights(ctx, initialWeights()); err != nil {
+		t.Fatalf("Error while setting the weights: %v", err)
+	}
+
+	if err := client.PushGradients(ctx, 1, 0, workerGradients(0)); !IsConflict(err) {
+		t.Errorf("Got %v for gradients of another step, want 409", err)
+	}
+
+	mismatched := workerGradients(0)
+	mismatched[0] = Tensor{Shape: []int{4}, Values: mismatched[0].Values}
+	if err := client.PushGradients(ctx, 0, 0, mismatched); statusCode(err) != http.StatusBadRequest {
+		t.Errorf("Got %v for gradients in another shape, want 400", err)
+	}
+	if err := client.PushGradients(ctx, 0, 0, workerGradients(0)[:1]); statusCode(err) != http.StatusBadRequest {
+		t.Errorf("Got %v for gradients missing a tensor, want 400", err)
+	}
+
+	runWorkers(t, client, 0, []int{0, 1, 2})
+	status, err := client.Status(ctx)
+	if err != nil {
+		t.Fatalf("Error while getting the status: %v", err)
+	}
+	want := Status{Initialized: true, Version: 0, Gradients: []int{0, 1, 2}}
+	if !reflect.DeepEqual(*status, want) {
+		t.Errorf("Got status %+v, want %+v", *status, want)
+	}
+}
+
+func TestApply(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+	if err := client.InitWeights(ctx, initialWeights()); err != nil {
+		t.Fatalf("Error while setting the weights: %v", err)
+	}
+	runWorkers(t, client, 0, []int{0, 1, 2})
+
+	// The gradients of worker 1 are left out, like those of a straggler
+	if err := client.Apply(ctx, 0, []int{2, 0}); err != nil {
+		t.Fatalf("Error while applying step 0: %v", err)
+	}
+
+	// w - learningRate * (g0 + g2) / 2, where the gradients of worker k are
+	// scaled by k + 1
+	want := []Tensor{
+		{Shape: []int{2, 2}, Values: []float32{1 - 0.5*2, 2 - 0.5*4, 3, 4 + 0.5*2}},
+		{Shape: []int{1}, Values: []float32{10 - 0.5*8}},
+	}
+	weights, err := client.Weights(ctx, 1)
+	if err != nil {
+		t.Fatalf("Error while getting the weights of step 1: %v", err)
+	}
+	if weights.Version != 1 || !reflect.DeepEqual(weights.Tensors, want) {
+		t.Fatalf("Got weights %+v, want %+v at version 1", weights, want)
+	}
+
+	if _, err := client.Weights(ctx, 0); !IsConflict(err) {
+		t.Errorf("Got %v for the weights of a stale version, want 409", err)
+	}
+
+	// Applying the previous step again, as the operator does when it did not
+	// get the answer, leaves the weights as they are
+	if err := client.Apply(ctx, 0, []int{0, 2}); err != nil {
+		t.Fatalf("Error while applying step 0 again: %v", err)
+	}
+	weights, err = client.Weights(ctx, -1)
+	if err != nil {
+		t.Fatalf("Error while getting the weights: %v", err)
+	}
+	if weights.Version != 1 || !reflect.DeepEqual(weights.Tensors, want) {
+		t.Errorf("Applying step 0 again changed the weights to %+v", weights)
+	}
+	if err := client.Apply(ctx, 0, []int{0, 1}); !IsConflict(err) {
+		t.Errorf("Got %v for applying step 0 again with other gradients, want 409", err)
+	}
+
+	runWorkers(t, client, 1, []int{0})
+	if err := client.Apply(ctx, 1, []int{0, 1}); !IsConflict(err) {
+		t.Errorf("Got %v for applying missing gradients, want 409", err)
+	}
+	status, err := client.Status(ctx)
+	if err != nil {
+		t.Fatalf("Error while getting the status: %v", err)
+	}
+	if status.Version != 1 || !reflect.DeepEqual(status.Gradients, []int{0}) {
+		t.Errorf("Applying missing gradients changed the status to %+v", *status)
+	}
+}
+
+// TestCheckpoint restarts the server from its checkpoint, as its pod is when it
+// is evicted in the middle of a run.
+func TestCheckpoint(t *testing.T) {
+	checkpoint := filepath.Join(t.TempDir(), "weights.json")
+	client := serve(t, newTestServer(t, checkpoint, "run-1"))
+	ctx := context.Background()
+	if err := client.InitWeights(ctx, initialWeights()); err != nil {
+		t.Fatalf("Error while setting the weights: %v", err)
+	}
+	runWorkers(t, client, 0, []int{0, 1})
+	if err := client.Apply(ctx, 0, []int{0, 1}); err != nil {
+		t.Fatalf("Error while applying step 0: %v", err)
+	}
+	want, err := client.Weights(ctx, 1)
+	if err != nil {
+		t.Fatalf("Error while getting the weights: %v", err)
+	}
+	// The gradients of the step in progress are not kept
+	runWorkers(t, client, 1, []int{0})
+
+	restarted := serve(t, newTestServer(t, checkpoint, "run-1"))
+	weights, err := restarted.Weights(ctx, 1)
+	if err != nil {
+		t.Fatalf("Error while getting the restored weights: %v", err)
+	}
+	if !reflect.DeepEqual(weights, want) {
+		t.Errorf("Got restored weights %+v, want %+v", weights, want)
+	}
+	status, err := restarted.Status(ctx)
+	if err != nil {
+		t.Fatalf("Error while getting the status: %v", err)
+	}
+	if wantStatus := (Status{Initialized: true, Version: 1, Gradients: []int{}}); !reflect.DeepEqual(*status, wantStatus) {
+		t.Errorf("Got status %+v after the restart, want %+v", *status, wantStatus)
+	}
+	// The operator may not have gotten the answer of the last step before
+	// the restart
+	if err := restarted.Apply(ctx, 0, []int{0, 1}); err != nil {
+		t.Errorf("Error while applying step 0 again after the restart: %v", err)
+	}
+
+	// A new run starts from new weights
+	newRun := serve(t, newTestServer(t, checkpoint, "run-2"))
+	if _, err := newRun.Weights(ctx, -1); statusCode(err) != http.StatusNotFound {
+		t.Errorf("Got %v for the weights of a new run, want 404", err)
+	}
+	if err := newRun.InitWeights(ctx, initialWeights()); err != nil {
+		t.Errorf("Error while setting the weights of a new run: %v", err)
+	}
+}
+
+func TestRestoreInvalidCheckpoint(t *testing.T) {
+	checkpoint := filepath.Join(t.TempDir(), "weights.json")
+	if err := os.WriteFile(checkpoint, []byte(`{"run": "run-1", "weights": {"version": 3}}`), 0o644); err != nil {
+		t.Fatalf("Error while writing the checkpoint: %v", err)
+	}
+	server := New("", learningRate, checkpoint, "run-1", log.NewLogger(log.Fields{}, "local", "error", io.Discard))
+	if err := server.Restore(); err == nil {
+		t.Errorf("Restored a checkpoint without weights")
+	}
+}
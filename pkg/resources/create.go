@@ -1,6 +1,7 @@
 package resources
 
 import (
+	appsv1 "k8s.io/api/apps/v1"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -39,6 +40,12 @@ func CreateJobWithOptions(jopts *JobOptions) *batchv1.Job {
 
 func CreateJobSpecWithOptions(jopts *JobOptions) batchv1.JobSpec {
 	return batchv1.JobSpec{
+		BackoffLimit:          jopts.BackoffLimit,
+		ActiveDeadlineSeconds: jopts.ActiveDeadlineSeconds,
+		PodFailurePolicy:      jopts.PodFailurePolicy,
+		CompletionMode:        jopts.CompletionMode,
+		Completions:           jopts.Completions,
+		Parallelism:           jopts.Parallelism,
 		Template: corev1.PodTemplateSpec{
 			ObjectMeta: metav1.ObjectMeta{
 				GenerateName: jopts.Name + "-",
@@ -51,12 +58,19 @@ func CreateJobSpecWithOptions(jopts *JobOptions) batchv1.JobSpec {
 						Name:            jopts.Name,
 						Image:           jopts.Image,
 						ImagePullPolicy: jopts.ImagePullPolicy,
+						Command:         jopts.Command,
+						Args:            jopts.Args,
 						VolumeMounts:    jopts.VolumeMounts,
 						Env:             jopts.Env,
+						Resources:       jopts.Resources,
 					},
 				},
-				Volumes:       jopts.Volumes,
-				RestartPolicy: corev1.RestartPolicyNever,
+				Volumes:           jopts.Volumes,
+				RestartPolicy:     corev1.RestartPolicyNever,
+				NodeSelector:      jopts.NodeSelector,
+				Tolerations:       jopts.Tolerations,
+				Affinity:          jopts.Affinity,
+				PriorityClassName: jopts.PriorityClassName,
 			},
 		},
 	}
@@ -66,6 +80,8 @@ func CreateConfigMap(options ...CreateConfigMapOption) *corev1.ConfigMap {
 	cmopts := &ConfigMapOptions{
 		Name:            "defaultcmname",
 		Data:            make(map[string]string),
+		Labels:          make(map[string]string),
+		Annotations:     make(map[string]string),
 		Namespace:       "default",
 		OwnerReferences: make([]metav1.OwnerReference, 0),
 	}
@@ -82,9 +98,116 @@ func CreateConfigMapWithOptions(cmopts *ConfigMapOptions) *corev1.ConfigMap {
 		ObjectMeta: metav1.ObjectMeta{
 			Name:            cmopts.Name,
 			Namespace:       cmopts.Namespace,
-			Labels:          make(map[string]string),
+			Labels:          cmopts.Labels,
+			Annotations:     cmopts.Annotations,
 			OwnerReferences: cmopts.OwnerReferences,
 		},
 		Data: cmopts.Data,
 	}
 }
+
+func CreateDeployment(options ...CreateDeploymentOption) *appsv1.Deployment {
+	dopts := &DeploymentOptions{
+		Name:            "defaultdeploymentname",
+		ImagePullPolicy: corev1.PullPolicy("IfNotPresent"),
+		Labels:          make(map[string]string),
+		Selector:        make(map[string]string),
+		OwnerReferences: make([]metav1.OwnerReference, 0),
+		Namespace:       "default",
+		Replicas:        1,
+		Env:             make([]corev1.EnvVar, 0),
+	}
+
+	for _, o := range options {
+		o.apply(dopts)
+	}
+
+	return CreateDeploymentWithOptions(dopts)
+}
+
+// CreateDeploymentWithOptions returns the Deployment. Its pods are labelled with
+// the selector, which is also added to the labels of the Deployment.
+func CreateDeploymentWithOptions(dopts *DeploymentOptions) *appsv1.Deployment {
+	labels := make(map[string]string, len(dopts.Labels)+len(dopts.Selector))
+	podLabels := make(map[string]string, len(dopts.Selector))
+	for key, val := range dopts.Labels {
+		labels[key] = val
+	}
+	for key, val := range dopts.Selector {
+		labels[key] = val
+		podLabels[key] = val
+	}
+	replicas := dopts.Replicas
+
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            dopts.Name,
+			Namespace:       dopts.Namespace,
+			Labels:          labels,
+			OwnerReferences: dopts.OwnerReferences,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: dopts.Selector,
+			},
+			Strategy: dopts.Strategy,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: podLabels,
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:            dopts.Name,
+							Image:           dopts.Image,
+							ImagePullPolicy: dopts.ImagePullPolicy,
+							Command:         dopts.Command,
+							Args:            dopts.Args,
+							Env:             dopts.Env,
+							Ports:           dopts.Ports,
+							VolumeMounts:    dopts.VolumeMounts,
+							Resources:       dopts.Resources,
+							ReadinessProbe:  dopts.ReadinessProbe,
+							LivenessProbe:   dopts.LivenessProbe,
+						},
+					},
+					Volumes: dopts.Volumes,
+				},
+			},
+		},
+	}
+}
+
+func CreateService(options ...CreateServiceOption) *corev1.Service {
+	sopts := &ServiceOptions{
+		Name:            "defaultservicename",
+		Labels:          make(map[string]string),
+		Selector:        make(map[string]string),
+		OwnerReferences: make([]metav1.OwnerReference, 0),
+		Namespace:       "default",
+		Ports:           make([]corev1.ServicePort, 0),
+	}
+
+	for _, o := range options {
+		o.apply(sopts)
+	}
+
+	return CreateServiceWithOptions(sopts)
+}
+
+func CreateServiceWithOptions(sopts *ServiceOptions) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            sopts.Name,
+			Namespace:       sopts.Namespace,
+			Labels:          sopts.Labels,
+			OwnerReferences: sopts.OwnerReferences,
+		},
+		Spec: corev1.ServiceSpec{
+			Type:     corev1.ServiceTypeClusterIP,
+			Selector: sopts.Selector,
+			Ports:    sopts.Ports,
+		},
+	}
+}
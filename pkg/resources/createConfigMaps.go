@@ -28,6 +28,20 @@ func CreateCMWithData(data map[string]string) CreateConfigMapOption {
 	})
 }
 
+func CreateCMWithLabels(labels map[string]string) CreateConfigMapOption {
+	return createConfigMapOptionAdapter(func(co *ConfigMapOptions) error {
+		co.Labels = labels
+		return nil
+	})
+}
+
+func CreateCMWithAnnotations(annotations map[string]string) CreateConfigMapOption {
+	return createConfigMapOptionAdapter(func(co *ConfigMapOptions) error {
+		co.Annotations = annotations
+		return nil
+	})
+}
+
 func CreateCMInNamespace(namespace string) CreateConfigMapOption {
 	return createConfigMapOptionAdapter(func(co *ConfigMapOptions) error {
 		co.Namespace = namespace
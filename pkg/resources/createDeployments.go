@@ -0,0 +1,169 @@
+package resources
+
+import (
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+type CreateDeploymentOption interface {
+	apply(*DeploymentOptions) error
+}
+
+type createDeploymentOptionAdapter func(*DeploymentOptions) error
+
+func (c createDeploymentOptionAdapter) apply(d *DeploymentOptions) error {
+	return c(d)
+}
+
+func CreateDeploymentWithName(name string) CreateDeploymentOption {
+	return createDeploymentOptionAdapter(func(d *DeploymentOptions) error {
+		d.Name = name
+		return nil
+	})
+}
+
+func CreateDeploymentInNamespace(namespace string) CreateDeploymentOption {
+	return createDeploymentOptionAdapter(func(d *DeploymentOptions) error {
+		d.Namespace = namespace
+		return nil
+	})
+}
+
+func CreateDeploymentWithImage(imageName string) CreateDeploymentOption {
+	return createDeploymentOptionAdapter(func(d *DeploymentOptions) error {
+		d.Image = imageName
+		return nil
+	})
+}
+
+func CreateDeploymentWithImagePullPolicy(policy string) CreateDeploymentOption {
+	return createDeploymentOptionAdapter(func(d *DeploymentOptions) error {
+		if policy != "" {
+			d.ImagePullPolicy = corev1.PullPolicy(policy)
+		}
+		return nil
+	})
+}
+
+func CreateDeploymentWithLabels(labels map[string]string) CreateDeploymentOption {
+	return createDeploymentOptionAdapter(func(d *DeploymentOptions) error {
+		d.Labels = labels
+		return nil
+	})
+}
+
+// CreateDeploymentWithSelector sets the labels the Deployment selects its pods
+// by, which are set on the pods.
+func CreateDeploymentWithSelector(selector map[string]string) CreateDeploymentOption {
+	return createDeploymentOptionAdapter(func(d *DeploymentOptions) error {
+		d.Selector = selector
+		return nil
+	})
+}
+
+func CreateDeploymentWithReplicas(replicas int32) CreateDeploymentOption {
+	return createDeploymentOptionAdapter(func(d *DeploymentOptions) error {
+		d.Replicas = replicas
+		return nil
+	})
+}
+
+func CreateDeploymentWithEnv(envVariables map[string]string) CreateDeploymentOption {
+	return createDeploymentOptionAdapter(func(d *DeploymentOptions) error {
+		for key, val := range envVariables {
+			envVar := corev1.EnvVar{
+				Name:  key,
+				Value: val,
+			}
+			d.Env = append(d.Env, envVar)
+		}
+		return nil
+	})
+}
+
+func CreateDeploymentWithCommand(command []string) CreateDeploymentOption {
+	return createDeploymentOptionAdapter(func(d *DeploymentOptions) error {
+		d.Command = command
+		return nil
+	})
+}
+
+func CreateDeploymentWithArgs(args []string) CreateDeploymentOption {
+	return createDeploymentOptionAdapter(func(d *DeploymentOptions) error {
+		d.Args = args
+		return nil
+	})
+}
+
+func CreateDeploymentWithPort(name string, port int32) CreateDeploymentOption {
+	return createDeploymentOptionAdapter(func(d *DeploymentOptions) error {
+		d.Ports = append(d.Ports, corev1.ContainerPort{
+			Name:          name,
+			ContainerPort: port,
+			Protocol:      corev1.ProtocolTCP,
+		})
+		return nil
+	})
+}
+
+func CreateDeploymentWithVolume(volume corev1.Volume) CreateDeploymentOption {
+	return createDeploymentOptionAdapter(func(d *DeploymentOptions) error {
+		d.Volumes = append(d.Volumes, volume)
+		return nil
+	})
+}
+
+func CreateDeploymentWithVolumeMounts(volumeMount corev1.VolumeMount) CreateDeploymentOption {
+	return createDeploymentOptionAdapter(func(d *DeploymentOptions) error {
+		d.VolumeMounts = append(d.VolumeMounts, volumeMount)
+		return nil
+	})
+}
+
+func CreateDeploymentWithResources(resources corev1.ResourceRequirements) CreateDeploymentOption {
+	return createDeploymentOptionAdapter(func(d *DeploymentOptions) error {
+		d.Resources = resources
+		return nil
+	})
+}
+
+// CreateDeploymentWithHTTPProbes checks the liveness and the readiness of the
+// container with a GET of the path on the named port.
+func CreateDeploymentWithHTTPProbes(path string, port string) CreateDeploymentOption {
+	return createDeploymentOptionAdapter(func(d *DeploymentOptions) error {
+		handler := corev1.ProbeHandler{
+			HTTPGet: &corev1.HTTPGetAction{
+				Path: path,
+				Port: intstr.FromString(port),
+			},
+		}
+		d.ReadinessProbe = &corev1.Probe{
+			ProbeHandler:  handler,
+			PeriodSeconds: 5,
+		}
+		d.LivenessProbe = &corev1.Probe{
+			ProbeHandler:     handler,
+			PeriodSeconds:    10,
+			FailureThreshold: 3,
+		}
+		return nil
+	})
+}
+
+// CreateDeploymentWithRecreateStrategy stops the running pods before starting
+// new ones, so that there is never more than one replica.
+func CreateDeploymentWithRecreateStrategy() CreateDeploymentOption {
+	return createDeploymentOptionAdapter(func(d *DeploymentOptions) error {
+		d.Strategy = appsv1.DeploymentStrategy{Type: appsv1.RecreateDeploymentStrategyType}
+		return nil
+	})
+}
+
+func CreateDeploymentWithOwnerReference(ownerReference metav1.OwnerReference) CreateDeploymentOption {
+	return createDeploymentOptionAdapter(func(d *DeploymentOptions) error {
+		d.OwnerReferences = append(d.OwnerReferences, ownerReference)
+		return nil
+	})
+}
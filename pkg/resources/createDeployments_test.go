@@ -0,0 +1,42 @@
+package resources
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func TestCreateDeploymentSelectsItsPods(t *testing.T) {
+	selector := map[string]string{"trainink8s.com/parameter-server": "example"}
+	deployment := CreateDeployment(
+		CreateDeploymentWithName("exampleparamserver"),
+		CreateDeploymentWithLabels(map[string]string{"trainink8s.com/traininkube": "example"}),
+		CreateDeploymentWithSelector(selector),
+	)
+
+	// The API server rejects Deployments whose selector does not match the
+	// labels of their pod template
+	podSelector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		t.Fatalf("Error while parsing the selector: %v", err)
+	}
+	if podSelector.Empty() {
+		t.Fatalf("The Deployment selects every pod")
+	}
+	if !podSelector.Matches(labels.Set(deployment.Spec.Template.Labels)) {
+		t.Errorf("The selector %v does not match the pod labels %v", podSelector, deployment.Spec.Template.Labels)
+	}
+
+	for key, value := range map[string]string{
+		"trainink8s.com/traininkube":      "example",
+		"trainink8s.com/parameter-server": "example",
+	} {
+		if deployment.Labels[key] != value {
+			t.Errorf("Got label %s=%q on the Deployment, want %q", key, deployment.Labels[key], value)
+		}
+	}
+	if *deployment.Spec.Replicas != 1 {
+		t.Errorf("Got %d replicas, want 1", *deployment.Spec.Replicas)
+	}
+}
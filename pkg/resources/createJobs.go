@@ -1,7 +1,10 @@
 package resources
 
 import (
+	"fmt"
+
 	traininkubev1alpha1 "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/apis/trainink8s/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -78,6 +81,110 @@ func CreateJobWithEnv(envVariables map[string]string) CreateJobOption {
 	})
 }
 
+func CreateJobWithEnvVars(envVars []corev1.EnvVar) CreateJobOption {
+	return createJobOptionAdapter(func(j *JobOptions) error {
+		j.Env = append(j.Env, envVars...)
+		return nil
+	})
+}
+
+func CreateJobWithCommand(command []string) CreateJobOption {
+	return createJobOptionAdapter(func(j *JobOptions) error {
+		j.Command = command
+		return nil
+	})
+}
+
+func CreateJobWithArgs(args []string) CreateJobOption {
+	return createJobOptionAdapter(func(j *JobOptions) error {
+		j.Args = args
+		return nil
+	})
+}
+
+// CreateJobWithStage sets the container of the job from a TrainInKube stage.
+// The stage env is appended after any env set before it, so it should be
+// passed after CreateJobWithEnv to take precedence.
+func CreateJobWithStage(stage traininkubev1alpha1.StageSpec) CreateJobOption {
+	return createJobOptionAdapter(func(j *JobOptions) error {
+		if stage.Image != "" {
+			j.Image = stage.Image
+		}
+		if stage.ImagePullPolicy != "" {
+			j.ImagePullPolicy = corev1.PullPolicy(stage.ImagePullPolicy)
+		}
+		j.Command = stage.Command
+		j.Args = stage.Args
+		j.Env = append(j.Env, stage.Env...)
+		j.Resources = stage.Resources
+		j.NodeSelector = stage.NodeSelector
+		j.Tolerations = stage.Tolerations
+		j.Affinity = stage.Affinity
+		j.PriorityClassName = stage.PriorityClassName
+		return CreateJobWithRetryPolicy(stage.RetryPolicy).apply(j)
+	})
+}
+
+// CreateJobWithRetryPolicy sets the backoff limit, the deadline and the pod
+// failure policy of the job from a TrainInKube retry policy. The retries by
+// the operator are not part of the job.
+func CreateJobWithRetryPolicy(policy traininkubev1alpha1.RetryPolicy) CreateJobOption {
+	return createJobOptionAdapter(func(j *JobOptions) error {
+		j.BackoffLimit = policy.BackoffLimit
+		j.ActiveDeadlineSeconds = policy.ActiveDeadlineSeconds
+		j.PodFailurePolicy = CreatePodFailurePolicy(policy)
+		return nil
+	})
+}
+
+// CreateJobWithIndexedCompletions runs the given number of pods at once, each
+// with its own completion index from 0, in the JOB_COMPLETION_INDEX variable.
+// The job succeeds once a pod of every index succeeded.
+func CreateJobWithIndexedCompletions(completions int32) CreateJobOption {
+	return createJobOptionAdapter(func(j *JobOptions) error {
+		mode := batchv1.IndexedCompletion
+		j.CompletionMode = &mode
+		j.Completions = &completions
+		j.Parallelism = &completions
+		return nil
+	})
+}
+
+func CreateJobWithResources(resources corev1.ResourceRequirements) CreateJobOption {
+	return createJobOptionAdapter(func(j *JobOptions) error {
+		j.Resources = resources
+		return nil
+	})
+}
+
+func CreateJobWithNodeSelector(nodeSelector map[string]string) CreateJobOption {
+	return createJobOptionAdapter(func(j *JobOptions) error {
+		j.NodeSelector = nodeSelector
+		return nil
+	})
+}
+
+func CreateJobWithTolerations(tolerations []corev1.Toleration) CreateJobOption {
+	return createJobOptionAdapter(func(j *JobOptions) error {
+		j.Tolerations = append(j.Tolerations, tolerations...)
+		return nil
+	})
+}
+
+func CreateJobWithAffinity(affinity *corev1.Affinity) CreateJobOption {
+	return createJobOptionAdapter(func(j *JobOptions) error {
+		j.Affinity = affinity
+		return nil
+	})
+}
+
+func CreateJobWithPriorityClassName(priorityClassName string) CreateJobOption {
+	return createJobOptionAdapter(func(j *JobOptions) error {
+		j.PriorityClassName = priorityClassName
+		return nil
+	})
+}
+
 func CreateJobWithOwnerReference(ownerReference metav1.OwnerReference) CreateJobOption {
 	return createJobOptionAdapter(func(j *JobOptions) error {
 		j.OwnerReferences = append(j.OwnerReferences, ownerReference)
@@ -89,6 +196,45 @@ func CreateOwnerReference(trainInKube *traininkubev1alpha1.TrainInKube) metav1.O
 	return *metav1.NewControllerRef(trainInKube, traininkubev1alpha1.SchemeGroupVersion.WithKind("TrainInKube"))
 }
 
+// CreatePodFailurePolicy fails the job right away on the fatal exit codes of the
+// retry policy, and on every exit code but the retriable ones when those are
+// set. Pods disrupted by evictions, preemptions or node failures never count
+// towards the backoff limit, so the job simply replaces them.
+func CreatePodFailurePolicy(policy traininkubev1alpha1.RetryPolicy) *batchv1.PodFailurePolicy {
+	podFailurePolicy := &batchv1.PodFailurePolicy{
+		Rules: []batchv1.PodFailurePolicyRule{
+			{
+				Action: batchv1.PodFailurePolicyActionIgnore,
+				OnPodConditions: []batchv1.PodFailurePolicyOnPodConditionsPattern{
+					{
+						Type:   corev1.DisruptionTarget,
+						Status: corev1.ConditionTrue,
+					},
+				},
+			},
+		},
+	}
+	if len(policy.FatalExitCodes) > 0 {
+		podFailurePolicy.Rules = append(podFailurePolicy.Rules, batchv1.PodFailurePolicyRule{
+			Action: batchv1.PodFailurePolicyActionFailJob,
+			OnExitCodes: &batchv1.PodFailurePolicyOnExitCodesRequirement{
+				Operator: batchv1.PodFailurePolicyOnExitCodesOpIn,
+				Values:   policy.FatalExitCodes,
+			},
+		})
+	}
+	if len(policy.RetriableExitCodes) > 0 {
+		podFailurePolicy.Rules = append(podFailurePolicy.Rules, batchv1.PodFailurePolicyRule{
+			Action: batchv1.PodFailurePolicyActionFailJob,
+			OnExitCodes: &batchv1.PodFailurePolicyOnExitCodesRequirement{
+				Operator: batchv1.PodFailurePolicyOnExitCodesOpNotIn,
+				Values:   policy.RetriableExitCodes,
+			},
+		})
+	}
+	return podFailurePolicy
+}
+
 func CreateHostPathVolume(name string, path string) corev1.Volume {
 	return corev1.Volume{
 		Name: name,
@@ -100,6 +246,70 @@ func CreateHostPathVolume(name string, path string) corev1.Volume {
 	}
 }
 
+func CreatePersistentVolumeClaimVolume(name string, claimName string, readOnly bool) corev1.Volume {
+	return corev1.Volume{
+		Name: name,
+		VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: claimName,
+				ReadOnly:  readOnly,
+			},
+		},
+	}
+}
+
+func CreateNFSVolume(name string, server string, path string, readOnly bool) corev1.Volume {
+	return corev1.Volume{
+		Name: name,
+		VolumeSource: corev1.VolumeSource{
+			NFS: &corev1.NFSVolumeSource{
+				Server:   server,
+				Path:     path,
+				ReadOnly: readOnly,
+			},
+		},
+	}
+}
+
+func CreateCSIVolume(name string, source corev1.CSIVolumeSource) corev1.Volume {
+	return corev1.Volume{
+		Name: name,
+		VolumeSource: corev1.VolumeSource{
+			CSI: &source,
+		},
+	}
+}
+
+// CreateStorageVolume creates the volume for the source set in the TrainInKube
+// storage spec. It returns an error unless exactly one source is set.
+func CreateStorageVolume(name string, storage traininkubev1alpha1.StorageSpec) (corev1.Volume, error) {
+	var volumes []corev1.Volume
+
+	if storage.HostPath != nil {
+		volume := CreateHostPathVolume(name, storage.HostPath.Path)
+		volume.HostPath.Type = storage.HostPath.Type
+		volumes = append(volumes, volume)
+	}
+	if storage.PersistentVolumeClaim != nil {
+		volumes = append(volumes, CreatePersistentVolumeClaimVolume(
+			name,
+			storage.PersistentVolumeClaim.ClaimName,
+			storage.PersistentVolumeClaim.ReadOnly,
+		))
+	}
+	if storage.NFS != nil {
+		volumes = append(volumes, CreateNFSVolume(name, storage.NFS.Server, storage.NFS.Path, storage.NFS.ReadOnly))
+	}
+	if storage.CSI != nil {
+		volumes = append(volumes, CreateCSIVolume(name, *storage.CSI.DeepCopy()))
+	}
+
+	if len(volumes) != 1 {
+		return corev1.Volume{}, fmt.Errorf("exactly one storage source must be set, got %d", len(volumes))
+	}
+	return volumes[0], nil
+}
+
 func CreateVolumeMount(name string, mountPath string) corev1.VolumeMount {
 	return corev1.VolumeMount{
 		Name:      name,
@@ -0,0 +1,68 @@
+package resources
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+type CreateServiceOption interface {
+	apply(*ServiceOptions) error
+}
+
+type createServiceOptionAdapter func(*ServiceOptions) error
+
+func (c createServiceOptionAdapter) apply(s *ServiceOptions) error {
+	return c(s)
+}
+
+func CreateServiceWithName(name string) CreateServiceOption {
+	return createServiceOptionAdapter(func(s *ServiceOptions) error {
+		s.Name = name
+		return nil
+	})
+}
+
+func CreateServiceInNamespace(namespace string) CreateServiceOption {
+	return createServiceOptionAdapter(func(s *ServiceOptions) error {
+		s.Namespace = namespace
+		return nil
+	})
+}
+
+func CreateServiceWithLabels(labels map[string]string) CreateServiceOption {
+	return createServiceOptionAdapter(func(s *ServiceOptions) error {
+		s.Labels = labels
+		return nil
+	})
+}
+
+// CreateServiceWithSelector sets the labels of the pods the Service sends the
+// traffic to.
+func CreateServiceWithSelector(selector map[string]string) CreateServiceOption {
+	return createServiceOptionAdapter(func(s *ServiceOptions) error {
+		s.Selector = selector
+		return nil
+	})
+}
+
+// CreateServiceWithPort exposes the port, and sends its traffic to the port of
+// the same name on the pods.
+func CreateServiceWithPort(name string, port int32) CreateServiceOption {
+	return createServiceOptionAdapter(func(s *ServiceOptions) error {
+		s.Ports = append(s.Ports, corev1.ServicePort{
+			Name:       name,
+			Port:       port,
+			TargetPort: intstr.FromString(name),
+			Protocol:   corev1.ProtocolTCP,
+		})
+		return nil
+	})
+}
+
+func CreateServiceWithOwnerReference(ownerReference metav1.OwnerReference) CreateServiceOption {
+	return createServiceOptionAdapter(func(s *ServiceOptions) error {
+		s.OwnerReferences = append(s.OwnerReferences, ownerReference)
+		return nil
+	})
+}
@@ -1,6 +1,8 @@
 package resources
 
 import (
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -15,11 +17,59 @@ type JobOptions struct {
 	Volumes         []corev1.Volume
 	VolumeMounts    []corev1.VolumeMount
 	Env             []corev1.EnvVar
+	Command         []string
+	Args            []string
+
+	Resources         corev1.ResourceRequirements
+	NodeSelector      map[string]string
+	Tolerations       []corev1.Toleration
+	Affinity          *corev1.Affinity
+	PriorityClassName string
+
+	BackoffLimit          *int32
+	ActiveDeadlineSeconds *int64
+	PodFailurePolicy      *batchv1.PodFailurePolicy
+
+	CompletionMode *batchv1.CompletionMode
+	Completions    *int32
+	Parallelism    *int32
 }
 
 type ConfigMapOptions struct {
 	Name            string
 	Data            map[string]string
+	Labels          map[string]string
+	Annotations     map[string]string
 	Namespace       string
 	OwnerReferences []metav1.OwnerReference
 }
+
+type DeploymentOptions struct {
+	Name            string
+	Image           string
+	ImagePullPolicy corev1.PullPolicy
+	Labels          map[string]string
+	Selector        map[string]string
+	OwnerReferences []metav1.OwnerReference
+	Namespace       string
+	Replicas        int32
+	Env             []corev1.EnvVar
+	Command         []string
+	Args            []string
+	Ports           []corev1.ContainerPort
+	Volumes         []corev1.Volume
+	VolumeMounts    []corev1.VolumeMount
+	Resources       corev1.ResourceRequirements
+	ReadinessProbe  *corev1.Probe
+	LivenessProbe   *corev1.Probe
+	Strategy        appsv1.DeploymentStrategy
+}
+
+type ServiceOptions struct {
+	Name            string
+	Labels          map[string]string
+	Selector        map[string]string
+	OwnerReferences []metav1.OwnerReference
+	Namespace       string
+	Ports           []corev1.ServicePort
+}
@@ -0,0 +1,79 @@
+package train
+
+import (
+	"errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Reasons of the events recorded on TrainInKubes.
+const (
+	ReasonInvalidSpec            = "InvalidSpec"
+	ReasonRestarted              = "Restarted"
+	ReasonConfigMapCreated       = "ConfigMapCreated"
+	ReasonBuildingModel          = "BuildingModel"
+	ReasonModelBuilt             = "ModelBuilt"
+	ReasonBuildFailed            = "BuildFailed"
+	ReasonSplittingData          = "SplittingData"
+	ReasonDataSplit              = "DataSplit"
+	ReasonSplitFailed            = "SplitFailed"
+	ReasonWorkersStarted         = "WorkersStarted"
+	ReasonParameterServerStarted = "ParameterServerStarted"
+	ReasonEpochStarted           = "EpochStarted"
+	ReasonEpochCompleted         = "EpochCompleted"
+	ReasonJobFailed              = "JobFailed"
+	ReasonAggregationFailed      = "AggregationFailed"
+	ReasonModelExported          = "ModelExported"
+	ReasonRetryingJobs           = "RetryingJobs"
+	ReasonBackupWorker           = "BackupWorker"
+	ReasonStragglersStopped      = "StragglersStopped"
+	ReasonTrainingSucceeded      = "TrainingSucceeded"
+	ReasonTrainingFailed         = "TrainingFailed"
+)
+
+// JobFailedError is returned when waiting for a job that failed, or that was
+// deleted before finishing.
+type JobFailedError struct {
+	Job     string
+	Reason  string
+	Message string
+}
+
+// podFailurePolicyReason is the reason of the failure of jobs failed by their
+// pod failure policy, on a fatal exit code.
+const podFailurePolicyReason = "PodFailurePolicy"
+
+// Fatal reports whether the job failed on a fatal exit code, in which case it
+// is not retried.
+func (e *JobFailedError) Fatal() bool {
+	return e.Reason == podFailurePolicyReason
+}
+
+func (e *JobFailedError) Error() string {
+	return fmt.Sprintf("Job %s failed: %s", e.Job, e.Message)
+}
+
+// givingUp returns a copy of the error stating that the job is not run again
+// after the given number of retries.
+func (e *JobFailedError) givingUp(retries int) *JobFailedError {
+	err := *e
+	if retries > 0 {
+		err.Message = fmt.Sprintf("%s, giving up after %d retries", e.Message, retries)
+	}
+	return &err
+}
+
+// event records an event on the TrainInKube of the orchestrator.
+func (t *TrainOrchestrator) event(eventType string, reason string, messageFmt string, args ...interface{}) {
+	t.Recorder.Eventf(t.TrainInKube, eventType, reason, messageFmt, args...)
+}
+
+// jobFailedEvent records a warning naming the failed job, when the error comes
+// from a failed job.
+func (t *TrainOrchestrator) jobFailedEvent(reason string, err error) {
+	var jobErr *JobFailedError
+	if errors.As(err, &jobErr) {
+		t.event(corev1.EventTypeWarning, reason, "Job %s failed: %s", jobErr.Job, jobErr.Message)
+	}
+}
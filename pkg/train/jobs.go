@@ -0,0 +1,327 @@
+package train
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	traininkubev1alpha1 "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/apis/trainink8s/v1alpha1"
+	"github.com/ChinmayaSharma-hue/TrainInKubes/pkg/metrics"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// The delay before the first retry of a stage when the retry policy does not
+// set one, and the cap on the delay as it doubles with each retry.
+const (
+	defaultRetryBackoff = 10 * time.Second
+	maxRetryBackoff     = 5 * time.Minute
+)
+
+// jobStub returns a job with only the name and namespace set, to look up a job
+// created elsewhere.
+func (t *TrainOrchestrator) jobStub(name string) *batchv1.Job {
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: t.Namespace,
+		},
+	}
+}
+
+// ensureJob creates the job, unless a job for the same step was already created
+// before the operator restarted, in which case that job is returned. A job of
+// the same name left over from an earlier step is deleted first.
+func (t *TrainOrchestrator) ensureJob(ctx context.Context, job *batchv1.Job) (*batchv1.Job, error) {
+	key, err := cache.MetaNamespaceKeyFunc(job)
+	if err != nil {
+		return nil, fmt.Errorf("error while getting the key for the object: %v", err)
+	}
+
+	obj, exists, err := t.JobInformer.GetIndexer().GetByKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("Error while checking if the Job already exists: %v", err)
+	}
+	if exists {
+		existing, ok := obj.(*batchv1.Job)
+		if !ok {
+			return nil, errors.New("Error while converting the job object to job type")
+		}
+		if sameStep(existing, job) {
+			t.Logger.Infof("Job %s already exists, waiting for it", key)
+			return existing, nil
+		}
+
+		t.Logger.Infof("Deleting Job %s left over from an earlier step", key)
+		err = t.deleteJobs(ctx, existing)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	created, err := t.KubeClientSet.BatchV1().Jobs(job.Namespace).Create(ctx, job, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		// The build job is also created by the controller, which may have
+		// recreated it after it was deleted for a retry
+		existing, getErr := t.KubeClientSet.BatchV1().Jobs(job.Namespace).Get(ctx, job.Name, metav1.GetOptions{})
+		if getErr == nil && sameStep(existing, job) {
+			return existing, nil
+		}
+	}
+	if err != nil {
+		metrics.JobRequestErrors.WithLabelValues("create").Inc()
+		return nil, fmt.Errorf("Error while creating the Job: %v", err)
+	}
+	metrics.JobsCreated.WithLabelValues(JobStage(job)).Inc()
+	return created, nil
+}
+
+// jobExists reports whether the job was already created for the same step.
+func (t *TrainOrchestrator) jobExists(job *batchv1.Job) (bool, error) {
+	key, err := cache.MetaNamespaceKeyFunc(job)
+	if err != nil {
+		return false, fmt.Errorf("error while getting the key for the object: %v", err)
+	}
+
+	obj, exists, err := t.JobInformer.GetIndexer().GetByKey(key)
+	if err != nil || !exists {
+		return false, err
+	}
+	existing, ok := obj.(*batchv1.Job)
+	return ok && sameStep(existing, job), nil
+}
+
+// runJobs creates the jobs of a stage and waits for all of them to finish. The
+// jobs that failed are run again as allowed by the retry policy of the stage,
+// while the jobs that succeeded are kept along with their output. It returns
+// the jobs of the last attempt, and the error of the first job that failed for
+// good, if any.
+//
+// The retries are capped per step. Each job records the retry it was created
+// for in its AttemptLabel, so that the cap holds across operator restarts.
+func (t *TrainOrchestrator) runJobs(
+	ctx context.Context,
+	policy traininkubev1alpha1.RetryPolicy,
+	jobs ...*batchv1.Job,
+) ([]*batchv1.Job, error) {
+	retries := 0
+	if policy.Retries != nil {
+		retries = int(*policy.Retries)
+	}
+
+	created := make([]*batchv1.Job, len(jobs))
+	pending := make([]int, len(jobs))
+	for i := range jobs {
+		pending[i] = i
+	}
+
+	retry := 0
+	for {
+		var err error
+		for _, i := range pending {
+			created[i], err = t.ensureJob(ctx, withAttempt(jobs[i], retry))
+			if err != nil {
+				return created, err
+			}
+			// Jobs adopted after a restart may come from a later retry
+			if attempt := jobAttempt(created[i]); attempt > retry {
+				retry = attempt
+			}
+		}
+
+		failed, failure, err := t.waitForAllJobs(ctx, created, pending)
+		if err != nil {
+			return created, err
+		}
+		if len(failed) == 0 {
+			return created, nil
+		}
+
+		if failure.Fatal() {
+			return created, failure
+		}
+		if retry >= retries {
+			return created, failure.givingUp(retries)
+		}
+
+		delay := retryBackoff(policy, retry)
+		retry++
+
+		failedJobs := make([]*batchv1.Job, 0, len(failed))
+		names := make([]string, 0, len(failed))
+		for _, i := range failed {
+			failedJobs = append(failedJobs, created[i])
+			names = append(names, created[i].Name)
+		}
+		t.Logger.Infof("Jobs %s of stage %s failed, retrying them in %s: %v", strings.Join(names, ", "), JobStage(jobs[0]), delay, failure)
+		t.event(corev1.EventTypeWarning, ReasonRetryingJobs, "Running the failed jobs %s of stage %s again in %s, retry %d of %d: %v",
+			strings.Join(names, ", "), JobStage(jobs[0]), delay, retry, retries, failure)
+
+		// The failed jobs are kept during the backoff, so that the controller
+		// does not recreate the build job right away
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return created, ctx.Err()
+		}
+
+		err = t.deleteJobs(ctx, failedJobs...)
+		if err != nil {
+			return created, err
+		}
+		pending = failed
+	}
+}
+
+// waitForAllJobs blocks until all the jobs at the given indices finished, even
+// when some of them fail. It returns the indices of the jobs that failed, along
+// with the error of the first of them. The error is only returned when waiting
+// itself failed.
+func (t *TrainOrchestrator) waitForAllJobs(
+	ctx context.Context,
+	jobs []*batchv1.Job,
+	indices []int,
+) ([]int, *JobFailedError, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		index int
+		err   error
+	}
+
+	doneCh := make(chan result, len(indices))
+	for _, i := range indices {
+		go func(i int) {
+			doneCh <- result{index: i, err: t.JobTracker.WaitForJobToFinish(ctx, jobs[i])}
+		}(i)
+	}
+
+	var failed []int
+	var failure *JobFailedError
+	var waitErr error
+	for range indices {
+		done := <-doneCh
+		if done.err == nil {
+			continue
+		}
+		var jobErr *JobFailedError
+		if !errors.As(done.err, &jobErr) {
+			if waitErr == nil {
+				waitErr = done.err
+				cancel()
+			}
+			continue
+		}
+		failed = append(failed, done.index)
+		if failure == nil {
+			failure = jobErr
+		}
+	}
+	if waitErr != nil {
+		return nil, nil, waitErr
+	}
+	sort.Ints(failed)
+	return failed, failure, nil
+}
+
+// withAttempt returns a copy of the job labelled with the retry it is created
+// for, counting from 0.
+func withAttempt(job *batchv1.Job, retry int) *batchv1.Job {
+	job = job.DeepCopy()
+	if job.Labels == nil {
+		job.Labels = map[string]string{}
+	}
+	job.Labels[AttemptLabel] = strconv.Itoa(retry)
+	return job
+}
+
+// jobAttempt returns the retry the job was created for, which is 0 for jobs
+// created without the AttemptLabel.
+func jobAttempt(job *batchv1.Job) int {
+	attempt, err := strconv.Atoi(job.Labels[AttemptLabel])
+	if err != nil {
+		return 0
+	}
+	return attempt
+}
+
+// retryBackoff returns the delay before the given retry of a stage, counting
+// from 0.
+func retryBackoff(policy traininkubev1alpha1.RetryPolicy, retry int) time.Duration {
+	delay := defaultRetryBackoff
+	if policy.Backoff != nil && policy.Backoff.Duration > 0 {
+		delay = policy.Backoff.Duration
+	}
+	for i := 0; i < retry && delay < maxRetryBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryBackoff {
+		delay = maxRetryBackoff
+	}
+	return delay
+}
+
+// deleteJobs deletes the jobs along with their pods, and blocks until they are
+// gone. Jobs that do not exist are skipped.
+func (t *TrainOrchestrator) deleteJobs(ctx context.Context, jobs ...*batchv1.Job) error {
+	for _, job := range jobs {
+		err := t.deleteJob(ctx, job)
+		if err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	deleteCh := make(chan error, len(jobs))
+	for _, job := range jobs {
+		go func(job *batchv1.Job) {
+			deleteCh <- t.JobTracker.WaitForJobToBeDeleted(ctx, job)
+		}(job)
+	}
+	for range jobs {
+		err := <-deleteCh
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteJob deletes the job without waiting for it to be gone. The job is only
+// removed after its pods, so that a job stopped before finishing cannot write
+// its output once a new job took its place.
+func (t *TrainOrchestrator) deleteJob(ctx context.Context, job *batchv1.Job) error {
+	propagation := metav1.DeletePropagationForeground
+	err := t.KubeClientSet.BatchV1().Jobs(job.Namespace).Delete(ctx, job.Name, metav1.DeleteOptions{
+		PropagationPolicy: &propagation,
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		metrics.JobRequestErrors.WithLabelValues("delete").Inc()
+		return fmt.Errorf("Error while deleting the Job: %v", err)
+	}
+	return nil
+}
+
+// observeStage records the duration of the stage that started at the given
+// time and just ended.
+func observeStage(stage string, start time.Time) {
+	metrics.StageDuration.WithLabelValues(stage).Observe(time.Since(start).Seconds())
+}
+
+// sameStep reports whether the jobs were created for the same epoch and
+// minibatch. Jobs that are not part of a minibatch always match.
+func sameStep(existing *batchv1.Job, job *batchv1.Job) bool {
+	return existing.Labels[EpochLabel] == job.Labels[EpochLabel] &&
+		existing.Labels[MiniBatchLabel] == job.Labels[MiniBatchLabel]
+}
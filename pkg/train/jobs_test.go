@@ -0,0 +1,269 @@
+package train
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gotway/gotway/pkg/log"
+
+	traininkubev1alpha1 "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/apis/trainink8s/v1alpha1"
+	traininkubefake "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/client/clientset/versioned/fake"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubeinformers "k8s.io/client-go/informers"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		backoff *metav1.Duration
+		retry   int
+		want    time.Duration
+	}{
+		{name: "unset", retry: 0, want: defaultRetryBackoff},
+		{name: "zero", backoff: &metav1.Duration{}, retry: 0, want: defaultRetryBackoff},
+		{name: "negative", backoff: &metav1.Duration{Duration: -time.Second}, retry: 0, want: defaultRetryBackoff},
+		{name: "first retry", backoff: &metav1.Duration{Duration: time.Second}, retry: 0, want: time.Second},
+		{name: "doubled", backoff: &metav1.Duration{Duration: time.Second}, retry: 3, want: 8 * time.Second},
+		{name: "capped", retry: 5, want: maxRetryBackoff},
+		{name: "over the cap", backoff: &metav1.Duration{Duration: time.Hour}, retry: 0, want: maxRetryBackoff},
+		{name: "high retry count", backoff: &metav1.Duration{Duration: time.Second}, retry: 1 << 30, want: maxRetryBackoff},
+		{name: "doubling past the range", backoff: &metav1.Duration{Duration: 1 << 61}, retry: 10, want: maxRetryBackoff},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := traininkubev1alpha1.RetryPolicy{Backoff: tt.backoff}
+			if got := retryBackoff(policy, tt.retry); got != tt.want {
+				t.Errorf("retryBackoff(%v, %d) = %s, want %s", tt.backoff, tt.retry, got, tt.want)
+			}
+		})
+	}
+}
+
+// jobOutcomes decides how each job created through the fake clientset ends,
+// by its name and the number of times it was created. Jobs given no condition
+// keep running. Indexed Jobs are given the completed indexes, when set.
+type jobOutcomes struct {
+	lock             sync.Mutex
+	created          map[string]int
+	jobs             []*batchv1.Job
+	outcome          func(name string, attempt int) batchv1.JobCondition
+	completedIndexes func(name string, attempt int) string
+}
+
+func (o *jobOutcomes) count(name string) int {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.created[name]
+}
+
+// createdJobs returns the jobs created so far, as they were sent to the fake
+// clientset.
+func (o *jobOutcomes) createdJobs() []*batchv1.Job {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return append([]*batchv1.Job(nil), o.jobs...)
+}
+
+// newRunningOrchestrator returns an orchestrator whose jobs finish as soon as
+// they are created, as decided by the outcomes. The objects exist before the
+// orchestrator starts, as if they were left by an earlier run of the operator.
+// The job informer feeding its tracker runs until the test ends.
+func newRunningOrchestrator(t *testing.T, outcomes *jobOutcomes, objects ...runtime.Object) *TrainOrchestrator {
+	t.Helper()
+
+	kubeClientSet := kubefake.NewSimpleClientset(objects...)
+	kubeClientSet.PrependReactor("create", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		job := action.(k8stesting.CreateAction).GetObject().(*batchv1.Job)
+
+		outcomes.lock.Lock()
+		outcomes.created[job.Name]++
+		outcomes.jobs = append(outcomes.jobs, job.DeepCopy())
+		attempt := outcomes.created[job.Name]
+		outcomes.lock.Unlock()
+
+		// The job is stored by the default reaction, already finished unless
+		// it keeps running
+		job.CreationTimestamp = metav1.Now()
+		if condition := outcomes.outcome(job.Name, attempt); condition.Type != "" {
+			job.Status.Conditions = append(job.Status.Conditions, condition)
+		}
+		if outcomes.completedIndexes != nil {
+			job.Status.CompletedIndexes = outcomes.completedIndexes(job.Name, attempt)
+		}
+		return false, nil, nil
+	})
+
+	factory := kubeinformers.NewSharedInformerFactory(kubeClientSet, 0)
+	jobInformer := factory.Batch().V1().Jobs().Informer()
+	tracker := NewJobTracker(jobInformer)
+
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	go jobInformer.Run(stopCh)
+	if !cache.WaitForCacheSync(stopCh, jobInformer.HasSynced) {
+		t.Fatalf("Failed to wait for the informer to sync")
+	}
+
+	trainInKube := newTestTrainInKube()
+	return &TrainOrchestrator{
+		KubeClientSet:        kubeClientSet,
+		TrainInKubeClientSet: traininkubefake.NewSimpleClientset(trainInKube),
+		TrainInKube:          trainInKube,
+		JobInformer:          jobInformer,
+		JobTracker:           tracker,
+		Recorder:             record.NewFakeRecorder(100),
+		Namespace:            testNamespace,
+		Logger:               log.NewLogger(log.Fields{}, "local", "error", io.Discard),
+	}
+}
+
+func int32Ptr(i int32) *int32 {
+	return &i
+}
+
+func complete() batchv1.JobCondition {
+	return batchv1.JobCondition{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}
+}
+
+func failed(reason string) batchv1.JobCondition {
+	return batchv1.JobCondition{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: reason, Message: "exit code 1"}
+}
+
+func TestRunJobsRetriesFailedJobs(t *testing.T) {
+	outcomes := &jobOutcomes{
+		created: make(map[string]int),
+		outcome: func(name string, attempt int) batchv1.JobCondition {
+			// Only the second worker fails, and only on its first attempt
+			if name == "mnisttraimodel1" && attempt == 1 {
+				return failed("BackoffLimitExceeded")
+			}
+			return complete()
+		},
+	}
+	orchestrator := newRunningOrchestrator(t, outcomes)
+
+	jobs := []*batchv1.Job{
+		newJob("mnisttraimodel0"),
+		newJob("mnisttraimodel1"),
+		newJob("mnisttraimodel2"),
+	}
+	policy := traininkubev1alpha1.RetryPolicy{
+		Retries: int32Ptr(2),
+		Backoff: &metav1.Duration{Duration: time.Millisecond},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	if _, err := orchestrator.runJobs(ctx, policy, jobs...); err != nil {
+		t.Fatalf("runJobs() error: %v", err)
+	}
+
+	want := map[string]int{"mnisttraimodel0": 1, "mnisttraimodel1": 2, "mnisttraimodel2": 1}
+	for name, count := range want {
+		if got := outcomes.count(name); got != count {
+			t.Errorf("%s was created %d times, want %d", name, got, count)
+		}
+	}
+}
+
+func TestRunJobsGivesUp(t *testing.T) {
+	tests := []struct {
+		name      string
+		reason    string
+		retries   int32
+		wantCount int
+	}{
+		{name: "out of retries", reason: "BackoffLimitExceeded", retries: 1, wantCount: 2},
+		{name: "fatal exit code", reason: podFailurePolicyReason, retries: 3, wantCount: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outcomes := &jobOutcomes{
+				created: make(map[string]int),
+				outcome: func(name string, attempt int) batchv1.JobCondition {
+					if name == "mnistupdatemodel" {
+						return failed(tt.reason)
+					}
+					return complete()
+				},
+			}
+			orchestrator := newRunningOrchestrator(t, outcomes)
+			policy := traininkubev1alpha1.RetryPolicy{
+				Retries: int32Ptr(tt.retries),
+				Backoff: &metav1.Duration{Duration: time.Millisecond},
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+			defer cancel()
+			_, err := orchestrator.runJobs(ctx, policy, newJob("mnistupdatemodel"))
+
+			var jobErr *JobFailedError
+			if !errors.As(err, &jobErr) {
+				t.Fatalf("runJobs() error = %v, want a JobFailedError", err)
+			}
+			if got := outcomes.count("mnistupdatemodel"); got != tt.wantCount {
+				t.Errorf("the job was created %d times, want %d", got, tt.wantCount)
+			}
+		})
+	}
+}
+
+// TestRunJobsAdoptsFinishedJobs starts from the jobs of a step left by an
+// earlier run of the operator, one of which failed.
+func TestRunJobsAdoptsFinishedJobs(t *testing.T) {
+	tests := []struct {
+		name          string
+		failedAttempt string
+		wantCreated   int
+		wantErr       bool
+	}{
+		{name: "retries left", failedAttempt: "0", wantCreated: 1},
+		{name: "out of retries", failedAttempt: "2", wantCreated: 0, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			succeeded := newJob("mnisttraimodel0")
+			succeeded.Labels = map[string]string{AttemptLabel: "0"}
+			succeeded.Status.Conditions = []batchv1.JobCondition{complete()}
+			lost := newJob("mnisttraimodel1")
+			lost.Labels = map[string]string{AttemptLabel: tt.failedAttempt}
+			lost.Status.Conditions = []batchv1.JobCondition{failed("BackoffLimitExceeded")}
+
+			outcomes := &jobOutcomes{
+				created: make(map[string]int),
+				outcome: func(name string, attempt int) batchv1.JobCondition { return complete() },
+			}
+			orchestrator := newRunningOrchestrator(t, outcomes, succeeded, lost)
+			policy := traininkubev1alpha1.RetryPolicy{
+				Retries: int32Ptr(2),
+				Backoff: &metav1.Duration{Duration: time.Millisecond},
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+			defer cancel()
+			_, err := orchestrator.runJobs(ctx, policy, newJob("mnisttraimodel0"), newJob("mnisttraimodel1"))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("runJobs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got := outcomes.count("mnisttraimodel0"); got != 0 {
+				t.Errorf("the job that succeeded was created again %d times", got)
+			}
+			if got := outcomes.count("mnisttraimodel1"); got != tt.wantCreated {
+				t.Errorf("the failed job was created again %d times, want %d", got, tt.wantCreated)
+			}
+		})
+	}
+}
@@ -6,32 +6,81 @@ import (
 	"fmt"
 
 	traininkubev1alpha1 "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/apis/trainink8s/v1alpha1"
+	traininkubev1alpha1clientset "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/client/clientset/versioned"
+	"github.com/ChinmayaSharma-hue/TrainInKubes/pkg/coordinator"
+	"github.com/ChinmayaSharma-hue/TrainInKubes/pkg/metrics"
+	"github.com/ChinmayaSharma-hue/TrainInKubes/pkg/paramserver"
 	"github.com/ChinmayaSharma-hue/TrainInKubes/pkg/resources"
 	"github.com/gotway/gotway/pkg/log"
 	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
+// DefaultWorkers is the number of data parallel workers used when the
+// TrainInKube does not set spec.workers.
+const DefaultWorkers = 6
+
 type TrainOrchestrator struct {
-	KubeClientSet kubernetes.Interface
-	TrainInKube   *traininkubev1alpha1.TrainInKube
-	JobInformer   cache.SharedIndexInformer
+	KubeClientSet        kubernetes.Interface
+	TrainInKubeClientSet traininkubev1alpha1clientset.Interface
+	TrainInKube          *traininkubev1alpha1.TrainInKube
+	JobInformer          cache.SharedIndexInformer
+	JobTracker           *JobTracker
+	Recorder             record.EventRecorder
+
+	// Coordinator drives the persistent workers, which reach it at
+	// CoordinatorURL.
+	Coordinator    *coordinator.Server
+	CoordinatorURL string
 
 	Namespace string
 
 	Logger log.Logger
+
+	// epochs overrides spec.epochs when the TrainInKube is updated while the
+	// run is in progress.
+	epochs     int
+	epochsLock sync.Mutex
+
+	// parameterServer is the client of the parameter server of the run, set
+	// once it is ready when the run deploys one.
+	parameterServer *paramserver.Client
 }
 
 func (t *TrainOrchestrator) Run(ctx context.Context, TrainInKube *traininkubev1alpha1.TrainInKube) {
 	t.Logger.Infof("Starting the job orchestrator...")
+	defer metrics.DeleteRun(TrainInKube.Namespace, TrainInKube.Name)
 
 	err := t.Orchestrate(ctx, TrainInKube)
+	if err != nil && ctx.Err() != nil {
+		// The run was stopped by the controller, after the TrainInKube was
+		// deleted or restarted, so it did not fail.
+		t.Logger.Infof("Stopped the job orchestrator of TrainInKube %s", TrainInKube.Name)
+		return
+	}
 	if err != nil {
 		t.Logger.Errorf("Error while orchestrating the jobs: %v", err)
+		t.event(corev1.EventTypeWarning, ReasonTrainingFailed, "The run failed: %v", err)
+
+		statusErr := t.updateStatus(ctx, func(TrainInKube *traininkubev1alpha1.TrainInKube) {
+			now := metav1.Now()
+			TrainInKube.Status.Phase = traininkubev1alpha1.PhaseFailed
+			TrainInKube.Status.CompletionTime = &now
+			SetCondition(TrainInKube, traininkubev1alpha1.ConditionFailed, metav1.ConditionTrue, "OrchestrationFailed", err.Error())
+		})
+		if statusErr != nil {
+			t.Logger.Errorf("Error while updating the status of the TrainInKube: %v", statusErr)
+		}
 	}
 }
 
@@ -41,246 +90,462 @@ func (t *TrainOrchestrator) Orchestrate(ctx context.Context, TrainInKube *traini
 		return fmt.Errorf("Error while getting the ConfigMap: %v", err)
 	}
 
-	// Create a job that divides the data between the jobs
-
-	volume := resources.CreateHostPathVolume(TrainInKube.Name+"volume", "/data")
-	volumeMount := resources.CreateVolumeMount(TrainInKube.Name+"volume", "/data")
-	envVariables := map[string]string{
-		"DIVISIONS":        strconv.Itoa(6),
-		"DATASET_LOCATION": "/data/PreprocessedData",
-		"SPLIT_LOCATION":   "/data/Chunks",
+	err = ValidateWorkers(TrainInKube)
+	if err != nil {
+		return err
+	}
+	if IsPersistent(TrainInKube) && UsesParameterServer(TrainInKube) {
+		return errors.New("Persistent workers do not support a parameter server")
 	}
-	ownerReference := resources.CreateOwnerReference(TrainInKube)
-
-	job := resources.CreateJob(
-		resources.CreateJobWithName(TrainInKube.Name+"splitdata"),
-		resources.CreateJobWithImage("splitjob:latest"),
-		resources.CreateJobInNamespace(t.Namespace),
-		resources.CreateJobWithVolume(volume),
-		resources.CreateJobWithVolumeMounts(volumeMount),
-		resources.CreateJobWithEnv(envVariables),
-		resources.CreateJobWithOwnerReference(ownerReference),
-	)
 
-	exists, err := resourceExists(job, t.JobInformer.GetIndexer())
+	volume, volumeMount, err := StorageVolume(TrainInKube)
 	if err != nil {
-		return fmt.Errorf("Error while checking if the Job already exists: %v", err)
+		return err
 	}
-	if exists {
-		t.Logger.Infof("Job already exists, skipping creation")
-		return nil
+	paths, err := Paths(TrainInKube)
+	if err != nil {
+		return err
 	}
 
-	created_job, err := t.KubeClientSet.BatchV1().Jobs(t.Namespace).Create(ctx, job, metav1.CreateOptions{})
+	err = t.buildModel(ctx, TrainInKube, volume, volumeMount, paths)
 	if err != nil {
-		return fmt.Errorf("Error while creating the Job: %v", err)
+		return err
 	}
 
-	// Block the function till the job finishes execution
-	errorCh := make(chan error)
-	go waitForJobToFinish(created_job, t.JobInformer, errorCh)
-	err = <-errorCh
+	err = t.splitData(ctx, TrainInKube, volume, volumeMount, paths)
 	if err != nil {
 		return err
 	}
 
-	for i := 0; i < int(TrainInKube.Spec.Epochs); i++ {
-		startingIndex := 0
-		endingIndex := int(TrainInKube.Spec.BatchSize / 6)
-
-		if TrainInKube.Spec.BatchSize == 0 {
-			return errors.New("Batch size cannot be 0")
+	if UsesParameterServer(TrainInKube) {
+		err = t.startParameterServer(ctx, TrainInKube, volume, volumeMount, paths)
+		if err != nil {
+			return err
 		}
+	}
 
-		numberOfMiniBatches := int(TrainInKube.Spec.NumberOfSamples / TrainInKube.Spec.BatchSize)
-
-		for j := 0; j < numberOfMiniBatches; j++ {
-			created_jobs := make([]*batchv1.Job, 6)
-			for k := 0; k < 6; k++ {
-				volume := resources.CreateHostPathVolume(TrainInKube.Name+"volume", "/data")
-				volumeMount := resources.CreateVolumeMount(TrainInKube.Name+"volume", "/data")
-				envVariables := map[string]string{
-					"MODEL_LOCATION":    "/data/model.h5",
-					"GRADIENT_LOCATION": "/data/Gradients",
-					"FEATURES_LOCATION": "/data/Chunks/x_train_" + strconv.Itoa(k) + ".npy",
-					"LABELS_LOCATION":   "/data/Chunks/y_train_" + strconv.Itoa(k) + ".npy",
-					"STARTING_INDEX":    strconv.Itoa(startingIndex),
-					"ENDING_INDEX":      strconv.Itoa(endingIndex),
-					"JOB_INDEX":         strconv.Itoa(k),
-				}
-				ownerReference := resources.CreateOwnerReference(TrainInKube)
-
-				job := resources.CreateJob(
-					resources.CreateJobWithName(TrainInKube.Name+"traimodel"+strconv.Itoa(k)),
-					resources.CreateJobWithImage("trainjob:latest"),
-					resources.CreateJobInNamespace(t.Namespace),
-					resources.CreateJobWithVolume(volume),
-					resources.CreateJobWithVolumeMounts(volumeMount),
-					resources.CreateJobWithEnv(envVariables),
-					resources.CreateJobWithOwnerReference(ownerReference),
-				)
-
-				exists, err := resourceExists(job, t.JobInformer.GetIndexer())
-				if err != nil {
-					return fmt.Errorf("Error while checking if the Job already exists: %v", err)
-				}
-				if exists {
-					t.Logger.Infof("Job already exists, skipping creation")
-					return nil
-				}
+	// Pick up the run at the minibatch recorded in the status, which is the
+	// first one of the run unless the operator restarted in the middle of it
+	startingEpoch, startingMiniBatch := 0, 0
+	if t.TrainInKube.Status.Epoch > 0 {
+		startingEpoch = t.TrainInKube.Status.Epoch - 1
+		startingMiniBatch = t.TrainInKube.Status.MiniBatch - 1
+		t.Logger.Infof("Resuming TrainInKube %s at epoch %d, minibatch %d", TrainInKube.Name, startingEpoch+1, startingMiniBatch+1)
+	}
 
-				created_job, err := t.KubeClientSet.BatchV1().Jobs(t.Namespace).Create(ctx, job, metav1.CreateOptions{})
-				if err != nil {
-					return fmt.Errorf("Error while creating the Job: %v", err)
-				}
-				// Add the job to the slice of jobs
-				created_jobs[k] = created_job
-			}
-			// Wait until the execution of all the jobs finishes using go routines
-			doneCh := make(chan error, 6)
-			for _, job := range created_jobs {
-				go waitForJobToFinish(job, t.JobInformer, doneCh)
-			}
-			for l := 0; l < 6; l++ {
-				err := <-doneCh
-				if err != nil {
-					return err
+	numberOfMiniBatches := TrainInKube.Spec.NumberOfSamples / TrainInKube.Spec.BatchSize
+	metrics.MarkRunProgress(TrainInKube.Namespace, TrainInKube.Name)
+
+	// Persistent workers are started once, and the minibatches are run in
+	// the context that is cancelled when their job ends early
+	runCtx := ctx
+	var workers *persistentWorkers
+	if IsPersistent(TrainInKube) {
+		var cancel context.CancelCauseFunc
+		workers, runCtx, cancel, err = t.startPersistentWorkers(ctx, TrainInKube, volume, volumeMount, paths)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			cancel(nil)
+			t.Coordinator.Unregister(workers.run)
+			// Workers of a run that failed would wait for their next
+			// step forever
+			if !workers.stopping.Load() && ctx.Err() == nil {
+				if err := t.deleteJobs(ctx, workers.job); err != nil {
+					t.Logger.Errorf("Error while deleting the persistent workers: %v", err)
 				}
 			}
+		}()
+	}
 
-			t.Logger.Infof("Finished executing all the jobs for epoch %d", i)
+	for i := startingEpoch; i < t.numberOfEpochs(); i++ {
+		if startingMiniBatch == 0 {
+			t.event(corev1.EventTypeNormal, ReasonEpochStarted, "Started epoch %d of %d", i+1, t.numberOfEpochs())
+		} else {
+			t.event(corev1.EventTypeNormal, ReasonEpochStarted, "Resumed epoch %d of %d at minibatch %d", i+1, t.numberOfEpochs(), startingMiniBatch+1)
+		}
 
-			// Delete all the jobs that were created for the minibatch
-			for _, job := range created_jobs {
-				err := t.KubeClientSet.BatchV1().Jobs(t.Namespace).Delete(ctx, job.Name, metav1.DeleteOptions{})
-				if err != nil {
-					return fmt.Errorf("Error while deleting the Job: %v", err)
-				}
-			}
-			deleteCh := make(chan error, 6)
-			for _, job := range created_jobs {
-				go waitForJobToBeDeleted(job, t.JobInformer, deleteCh)
+		for j := startingMiniBatch; j < numberOfMiniBatches; j++ {
+			var err error
+			if workers != nil {
+				err = t.trainMiniBatchPersistent(runCtx, workers, TrainInKube, i, j)
+			} else {
+				err = t.trainMiniBatch(ctx, TrainInKube, i, j, volume, volumeMount, paths)
 			}
-			for l := 0; l < 6; l++ {
-				err := <-deleteCh
-				if err != nil {
-					return err
-				}
+			if err != nil {
+				return err
 			}
 
-			// Create a job that averages over all the gradients
-			volume := resources.CreateHostPathVolume(TrainInKube.Name+"volume", "/data")
-			volumeMount := resources.CreateVolumeMount(TrainInKube.Name+"volume", "/data")
-			envVariables := map[string]string{
-				"MODEL_LOCATION":    "/data/model.h5",
-				"GRADIENT_LOCATION": "/data/Gradients",
-				"NUMBER_OF_GRADS":   strconv.Itoa(6),
+			t.Logger.Infof("Finished minibatch %d of epoch %d", j+1, i+1)
+			metrics.MarkRunProgress(TrainInKube.Namespace, TrainInKube.Name)
+			if j == numberOfMiniBatches-1 {
+				t.event(corev1.EventTypeNormal, ReasonEpochCompleted, "Completed epoch %d of %d", i+1, t.numberOfEpochs())
 			}
-			ownerReference := resources.CreateOwnerReference(TrainInKube)
-
-			job := resources.CreateJob(
-				resources.CreateJobWithName(TrainInKube.Name+"updatemodel"),
-				resources.CreateJobWithImage("modelupdatejob:latest"),
-				resources.CreateJobInNamespace(t.Namespace),
-				resources.CreateJobWithVolume(volume),
-				resources.CreateJobWithVolumeMounts(volumeMount),
-				resources.CreateJobWithEnv(envVariables),
-				resources.CreateJobWithOwnerReference(ownerReference),
-			)
-
-			exists, err := resourceExists(job, t.JobInformer.GetIndexer())
-			if err != nil {
-				return fmt.Errorf("Error while checking if the Job already exists: %v", err)
-			}
-			if exists {
-				t.Logger.Infof("Job already exists, skipping creation")
-				return nil
+
+			// Record the next minibatch before cleaning up, so that the
+			// gradients of this one are never applied twice
+			nextEpoch, nextMiniBatch := i, j+1
+			if nextMiniBatch == numberOfMiniBatches {
+				nextEpoch, nextMiniBatch = i+1, 0
 			}
-			created_job, err := t.KubeClientSet.BatchV1().Jobs(t.Namespace).Create(ctx, job, metav1.CreateOptions{})
-			if err != nil {
-				return fmt.Errorf("Error while creating the Job: %v", err)
+			if nextEpoch >= t.numberOfEpochs() {
+				break
 			}
-			go waitForJobToFinish(created_job, t.JobInformer, errorCh)
-			err = <-errorCh
+			err = t.updateStatus(ctx, func(TrainInKube *traininkubev1alpha1.TrainInKube) {
+				TrainInKube.Status.Epoch = nextEpoch + 1
+				TrainInKube.Status.MiniBatch = nextMiniBatch + 1
+			})
 			if err != nil {
-				return err
+				return fmt.Errorf("Error while recording the progress of the run: %v", err)
 			}
 
-			err = t.KubeClientSet.BatchV1().Jobs(t.Namespace).Delete(ctx, created_job.Name, metav1.DeleteOptions{})
-			if err != nil {
-				return fmt.Errorf("Error while deleting the Job: %v", err)
-			}
-			deletenbCh := make(chan error)
-			go waitForJobToBeDeleted(created_job, t.JobInformer, deletenbCh)
-			err = <-deletenbCh
-			if err != nil {
-				return err
+			if workers == nil && t.parameterServer == nil {
+				err = t.deleteJobs(ctx, t.jobStub(TrainInKube.Name+"updatemodel"))
+				if err != nil {
+					return err
+				}
 			}
+		}
+		startingMiniBatch = 0
+	}
 
-			startingIndex += endingIndex
-			endingIndex += endingIndex
+	if workers != nil {
+		err = t.stopPersistentWorkers(runCtx, workers)
+		if err != nil {
+			return err
+		}
+	}
+	if t.parameterServer != nil {
+		err = t.exportModel(ctx, TrainInKube, volume, volumeMount, paths)
+		if err != nil {
+			return err
 		}
 	}
-	// After the job finishes execution, do the same thing again from the start.
-	return nil
-}
 
-func waitForJobToFinish(job *batchv1.Job, JobInformer cache.SharedIndexInformer, errorCh chan error) {
-	key, err := cache.MetaNamespaceKeyFunc(job)
+	err = t.updateStatus(ctx, func(TrainInKube *traininkubev1alpha1.TrainInKube) {
+		now := metav1.Now()
+		TrainInKube.Status.Phase = traininkubev1alpha1.PhaseSucceeded
+		TrainInKube.Status.CompletionTime = &now
+		SetCondition(TrainInKube, traininkubev1alpha1.ConditionComplete, metav1.ConditionTrue, "TrainingSucceeded", "All the epochs were trained")
+	})
 	if err != nil {
-		errorCh <- err
+		return fmt.Errorf("Error while recording the end of the run: %v", err)
 	}
+	t.event(corev1.EventTypeNormal, ReasonTrainingSucceeded, "All the epochs were trained")
 
-	for {
-		jobObject, exists, err := JobInformer.GetIndexer().GetByKey(key)
+	if t.parameterServer != nil {
+		err = DeleteParameterServer(ctx, t.KubeClientSet, TrainInKube.Namespace, TrainInKube.Name)
 		if err != nil {
-			errorCh <- err
-			break
-		}
-		if exists {
-			job, ok := jobObject.(*batchv1.Job)
-			if !ok {
-				errorCh <- errors.New("Error while converting the job object to job type")
-				break
-			}
-			if job.Status.Succeeded == 1 {
-				errorCh <- nil
-				break
-			} else if job.Status.Failed == 1 {
-				errorCh <- errors.New("Job failed")
-				break
-			}
+			return err
 		}
+		return t.deleteJobs(ctx, t.jobStub(TrainInKube.Name+"exportmodel"))
 	}
+	return t.deleteJobs(ctx, t.jobStub(TrainInKube.Name+"updatemodel"))
 }
 
-func waitForJobToBeDeleted(job *batchv1.Job, JobInformer cache.SharedIndexInformer, errorCh chan error) {
-	key, err := cache.MetaNamespaceKeyFunc(job)
+// buildModel waits for the job building the model, which is created by the
+// controller, and runs it again when it fails as the retry policy allows. It
+// returns right away when the model was already built.
+func (t *TrainOrchestrator) buildModel(
+	ctx context.Context,
+	TrainInKube *traininkubev1alpha1.TrainInKube,
+	volume corev1.Volume,
+	volumeMount corev1.VolumeMount,
+	paths DataPaths,
+) error {
+	if meta.IsStatusConditionTrue(t.TrainInKube.Status.Conditions, traininkubev1alpha1.ConditionModelBuilt) {
+		return nil
+	}
 
+	start := time.Now()
+	_, err := t.runJobs(ctx, BuildStage(TrainInKube).RetryPolicy, BuildJob(TrainInKube, volume, volumeMount, paths))
 	if err != nil {
-		errorCh <- err
+		t.jobFailedEvent(ReasonBuildFailed, err)
+		return fmt.Errorf("Error while building the model: %v", err)
 	}
+	observeStage(StageBuild, start)
+	t.event(corev1.EventTypeNormal, ReasonModelBuilt, "The model was built by job %s", TrainInKube.Name+"buildmodel")
 
-	for {
-		_, exists, err := JobInformer.GetIndexer().GetByKey(key)
+	err = t.updateStatus(ctx, func(TrainInKube *traininkubev1alpha1.TrainInKube) {
+		TrainInKube.Status.Phase = traininkubev1alpha1.PhaseSplittingData
+		SetCondition(TrainInKube, traininkubev1alpha1.ConditionModelBuilt, metav1.ConditionTrue, "BuildJobSucceeded", "The model was built")
+	})
+	if err != nil {
+		return fmt.Errorf("Error while recording the progress of the run: %v", err)
+	}
+
+	return nil
+}
+
+// splitData runs the job dividing the dataset between the workers. It returns
+// right away when the dataset was already split.
+func (t *TrainOrchestrator) splitData(
+	ctx context.Context,
+	TrainInKube *traininkubev1alpha1.TrainInKube,
+	volume corev1.Volume,
+	volumeMount corev1.VolumeMount,
+	paths DataPaths,
+) error {
+	if meta.IsStatusConditionTrue(t.TrainInKube.Status.Conditions, traininkubev1alpha1.ConditionDataSplit) {
+		return nil
+	}
+
+	envVariables := map[string]string{
+		"DIVISIONS":        strconv.Itoa(NumberOfWorkers(TrainInKube)),
+		"DATASET_LOCATION": paths.Dataset,
+		"SPLIT_LOCATION":   paths.Chunks,
+	}
+	ownerReference := resources.CreateOwnerReference(TrainInKube)
+
+	job := resources.CreateJob(
+		resources.CreateJobWithName(TrainInKube.Name+"splitdata"),
+		resources.CreateJobInNamespace(t.Namespace),
+		resources.CreateJobWithVolume(volume),
+		resources.CreateJobWithVolumeMounts(volumeMount),
+		resources.CreateJobWithEnv(envVariables),
+		resources.CreateJobWithStage(SplitStage(TrainInKube)),
+		resources.CreateJobWithLabels(JobLabels(TrainInKube, StageSplit)),
+		resources.CreateJobWithOwnerReference(ownerReference),
+	)
+
+	// Block the function till the job finishes execution
+	start := time.Now()
+	t.event(corev1.EventTypeNormal, ReasonSplittingData, "Splitting the dataset between %d workers with job %s", NumberOfWorkers(TrainInKube), job.Name)
+	_, err := t.runJobs(ctx, SplitStage(TrainInKube).RetryPolicy, job)
+	if err != nil {
+		t.jobFailedEvent(ReasonSplitFailed, err)
+		return err
+	}
+	observeStage(StageSplit, start)
+	t.event(corev1.EventTypeNormal, ReasonDataSplit, "The dataset was split between the workers")
+
+	err = t.updateStatus(ctx, func(TrainInKube *traininkubev1alpha1.TrainInKube) {
+		TrainInKube.Status.Phase = traininkubev1alpha1.PhaseTraining
+		SetCondition(TrainInKube, traininkubev1alpha1.ConditionDataSplit, metav1.ConditionTrue, "SplitJobSucceeded", "The dataset was split between the workers")
+	})
+	if err != nil {
+		return fmt.Errorf("Error while recording the progress of the run: %v", err)
+	}
+
+	return nil
+}
+
+// trainMiniBatch runs the training jobs of every worker on their share of the
+// minibatch, followed by the job averaging their gradients into the model, or
+// by the parameter server doing so when the run deploys one. The jobs of the
+// minibatch that already exist are waited for instead of created.
+func (t *TrainOrchestrator) trainMiniBatch(
+	ctx context.Context,
+	TrainInKube *traininkubev1alpha1.TrainInKube,
+	epoch int,
+	miniBatch int,
+	volume corev1.Volume,
+	volumeMount corev1.VolumeMount,
+	paths DataPaths,
+) error {
+	workers := NumberOfWorkers(TrainInKube)
+	err := t.recordMiniBatch(ctx, TrainInKube, epoch, miniBatch)
+	if err != nil {
+		return err
+	}
+
+	ownerReference := resources.CreateOwnerReference(TrainInKube)
+
+	// Create a job that averages over the gradients of the workers that
+	// finished, which are all of them unless a straggler policy is set
+	gradients := make([]int, workers)
+	for k := range gradients {
+		gradients[k] = k
+	}
+	aggregateJob := func() *batchv1.Job {
+		envVariables := map[string]string{
+			"MODEL_LOCATION":    paths.Model,
+			"GRADIENT_LOCATION": paths.Gradients,
+			"NUMBER_OF_GRADS":   strconv.Itoa(len(gradients)),
+			"GRADIENT_INDICES":  joinInts(gradients),
+		}
+		return resources.CreateJob(
+			resources.CreateJobWithName(TrainInKube.Name+"updatemodel"),
+			resources.CreateJobInNamespace(t.Namespace),
+			resources.CreateJobWithVolume(volume),
+			resources.CreateJobWithVolumeMounts(volumeMount),
+			resources.CreateJobWithEnv(envVariables),
+			resources.CreateJobWithStage(AggregateStage(TrainInKube)),
+			resources.CreateJobWithLabels(StepLabels(TrainInKube, StageAggregate, epoch, miniBatch)),
+			resources.CreateJobWithOwnerReference(ownerReference),
+		)
+	}
+
+	// The workers of the minibatch are done once its aggregate job exists,
+	// and the whole minibatch once the parameter server applied it
+	step := parameterServerStep(TrainInKube, epoch, miniBatch)
+	aggregating := false
+	if t.parameterServer != nil {
+		applied, err := t.parameterServerApplied(ctx, step)
+		if err != nil || applied {
+			return err
+		}
+	} else {
+		aggregating, err = t.jobExists(aggregateJob())
+		if err != nil {
+			return err
+		}
+	}
+
+	trainWorkers := func() error {
+		start := time.Now()
+		workersJob := WorkersJob(TrainInKube, epoch, miniBatch, volume, volumeMount, paths)
+		backups := make([]*batchv1.Job, workers)
+		for k := range backups {
+			backups[k] = BackupWorkerJob(TrainInKube, epoch, miniBatch, volume, volumeMount, paths, k)
+		}
+
+		// Wait until the workers finish. Only the shards without gradients
+		// are retried, the others keep theirs.
+		var created_jobs []*batchv1.Job
+		created_jobs, gradients, err = t.runWorkers(ctx, TrainInKube.Spec.StragglerPolicy, TrainStage(TrainInKube).RetryPolicy, workersJob, backups)
+		if err != nil {
+			t.jobFailedEvent(ReasonJobFailed, err)
+			return err
+		}
+
+		// Delete all the jobs that were created for the minibatch
+		err = t.deleteJobs(ctx, created_jobs...)
+		if err != nil {
+			return err
+		}
+		observeStage(StageTrain, start)
+		return nil
+	}
+	if !aggregating {
+		err = trainWorkers()
 		if err != nil {
-			errorCh <- err
-			break
+			return err
+		}
+	}
+
+	start := time.Now()
+	if t.parameterServer != nil {
+		err = t.applyGradients(ctx, TrainInKube, step, gradients)
+		// The gradients pushed for the minibatch are lost when the parameter
+		// server restarted in the middle of it, so its workers run again
+		if paramserver.IsConflict(err) && t.parameterServerLostGradients(ctx, step, gradients) {
+			t.Logger.Infof("The parameter server lost the gradients of step %d, running the workers again", step)
+			err = trainWorkers()
+			if err != nil {
+				return err
+			}
+			start = time.Now()
+			err = t.applyGradients(ctx, TrainInKube, step, gradients)
 		}
-		if !exists {
-			errorCh <- nil
-			break
+		if err != nil {
+			t.event(corev1.EventTypeWarning, ReasonAggregationFailed, "%v", err)
+			return err
 		}
+		observeStage(StageAggregate, start)
+		return nil
+	}
+	_, err = t.runJobs(ctx, AggregateStage(TrainInKube).RetryPolicy, aggregateJob())
+	if err != nil {
+		t.jobFailedEvent(ReasonAggregationFailed, err)
+		return err
 	}
+	observeStage(StageAggregate, start)
+	return nil
 }
 
-func resourceExists(obj interface{}, indexer cache.Indexer) (bool, error) {
-	key, err := cache.MetaNamespaceKeyFunc(obj)
+// shardRange returns the range of the samples each worker trains on in the
+// minibatch, within its own shard of the dataset.
+func shardRange(TrainInKube *traininkubev1alpha1.TrainInKube, miniBatch int) (int, int) {
+	shardSize := TrainInKube.Spec.BatchSize / NumberOfWorkers(TrainInKube)
+	startingIndex := miniBatch * shardSize
+	return startingIndex, startingIndex + shardSize
+}
 
+// recordMiniBatch records the minibatch being trained in the status and the
+// metrics of the run.
+func (t *TrainOrchestrator) recordMiniBatch(
+	ctx context.Context,
+	TrainInKube *traininkubev1alpha1.TrainInKube,
+	epoch int,
+	miniBatch int,
+) error {
+	metrics.SetRunSize(TrainInKube.Namespace, TrainInKube.Name, t.numberOfEpochs(), TrainInKube.Spec.NumberOfSamples/TrainInKube.Spec.BatchSize)
+	metrics.SetRunProgress(TrainInKube.Namespace, TrainInKube.Name, epoch+1, miniBatch+1)
+
+	if t.TrainInKube.Status.Epoch == epoch+1 && t.TrainInKube.Status.MiniBatch == miniBatch+1 {
+		return nil
+	}
+	err := t.updateStatus(ctx, func(TrainInKube *traininkubev1alpha1.TrainInKube) {
+		TrainInKube.Status.Epoch = epoch + 1
+		TrainInKube.Status.MiniBatch = miniBatch + 1
+	})
 	if err != nil {
-		return false, fmt.Errorf("error while getting the key for the object: %v", err)
+		return fmt.Errorf("Error while recording the progress of the run: %v", err)
+	}
+	return nil
+}
+
+// SetEpochs changes the number of epochs of the run while it is in progress. The
+// new number is picked up at the end of the current epoch.
+func (t *TrainOrchestrator) SetEpochs(epochs int) {
+	t.epochsLock.Lock()
+	defer t.epochsLock.Unlock()
+
+	t.epochs = epochs
+}
+
+func (t *TrainOrchestrator) numberOfEpochs() int {
+	t.epochsLock.Lock()
+	defer t.epochsLock.Unlock()
+
+	if t.epochs == 0 {
+		return t.TrainInKube.Spec.Epochs
+	}
+	return t.epochs
+}
+
+// joinInts returns the numbers separated by commas.
+func joinInts(numbers []int) string {
+	strs := make([]string, len(numbers))
+	for i, number := range numbers {
+		strs[i] = strconv.Itoa(number)
+	}
+	return strings.Join(strs, ",")
+}
+
+// NumberOfWorkers returns the number of data parallel workers for the TrainInKube,
+// falling back to DefaultWorkers when spec.workers is unset.
+func NumberOfWorkers(TrainInKube *traininkubev1alpha1.TrainInKube) int {
+	if TrainInKube.Spec.Workers == 0 {
+		return DefaultWorkers
 	}
+	return TrainInKube.Spec.Workers
+}
 
-	_, exists, err := indexer.GetByKey(key)
-	return exists, err
+// ValidateWorkers checks that the worker count splits the data evenly: every
+// worker has to get the same, non-empty share of each minibatch, and there has
+// to be at least one full minibatch in the dataset.
+func ValidateWorkers(TrainInKube *traininkubev1alpha1.TrainInKube) error {
+	workers := NumberOfWorkers(TrainInKube)
+	spec := TrainInKube.Spec
+
+	if workers < 0 {
+		return fmt.Errorf("Number of workers cannot be negative, got %d", workers)
+	}
+	if spec.BatchSize <= 0 {
+		return errors.New("Batch size must be greater than 0")
+	}
+	if spec.BatchSize < workers {
+		return fmt.Errorf("Batch size %d is smaller than the number of workers %d", spec.BatchSize, workers)
+	}
+	if spec.BatchSize%workers != 0 {
+		return fmt.Errorf("Batch size %d is not divisible by the number of workers %d", spec.BatchSize, workers)
+	}
+	if spec.NumberOfSamples < spec.BatchSize {
+		return fmt.Errorf("Number of samples %d is smaller than the batch size %d", spec.NumberOfSamples, spec.BatchSize)
+	}
+
+	return nil
 }
@@ -0,0 +1,127 @@
+package train
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/gotway/gotway/pkg/log"
+
+	traininkubev1alpha1 "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/apis/trainink8s/v1alpha1"
+	traininkubefake "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/client/clientset/versioned/fake"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubeinformers "k8s.io/client-go/informers"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+)
+
+const testNamespace = "default"
+
+// errStop is returned by the fake clientset to stop the run at the first job
+// it creates.
+var errStop = errors.New("stop")
+
+// newTestTrainInKube returns a TrainInKube whose model is built and dataset
+// split, with 4 minibatches of 2 samples per worker in every epoch.
+func newTestTrainInKube() *traininkubev1alpha1.TrainInKube {
+	trainInKube := &traininkubev1alpha1.TrainInKube{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "mnist",
+			Namespace: testNamespace,
+		},
+		Spec: traininkubev1alpha1.TrainInKubeSpec{
+			ModelImage:      "model:latest",
+			Epochs:          2,
+			BatchSize:       4,
+			NumberOfSamples: 16,
+			Workers:         2,
+		},
+		Status: traininkubev1alpha1.TrainInKubeStatus{
+			Phase:   traininkubev1alpha1.PhaseTraining,
+			Workers: 2,
+		},
+	}
+	SetCondition(trainInKube, traininkubev1alpha1.ConditionModelBuilt, metav1.ConditionTrue, "BuildJobSucceeded", "")
+	SetCondition(trainInKube, traininkubev1alpha1.ConditionDataSplit, metav1.ConditionTrue, "SplitJobSucceeded", "")
+	return trainInKube
+}
+
+// newTestOrchestrator returns an orchestrator backed by fake clientsets. The
+// jobs it creates are recorded in created and fail to be created, so the run
+// stops at the first one.
+func newTestOrchestrator(t *testing.T, trainInKube *traininkubev1alpha1.TrainInKube, created *[]*batchv1.Job) *TrainOrchestrator {
+	t.Helper()
+
+	configmap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: trainInKube.Name, Namespace: testNamespace},
+	}
+	kubeClientSet := kubefake.NewSimpleClientset(configmap)
+	kubeClientSet.PrependReactor("create", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		job := action.(k8stesting.CreateAction).GetObject().(*batchv1.Job)
+		*created = append(*created, job)
+		return true, nil, errStop
+	})
+
+	factory := kubeinformers.NewSharedInformerFactory(kubeClientSet, time.Minute)
+
+	return &TrainOrchestrator{
+		KubeClientSet:        kubeClientSet,
+		TrainInKubeClientSet: traininkubefake.NewSimpleClientset(trainInKube),
+		TrainInKube:          trainInKube,
+		JobInformer:          factory.Batch().V1().Jobs().Informer(),
+		Recorder:             record.NewFakeRecorder(100),
+		Namespace:            testNamespace,
+		Logger:               log.NewLogger(log.Fields{}, "local", "error", io.Discard),
+	}
+}
+
+func TestOrchestrateResumesAtRecordedStep(t *testing.T) {
+	tests := []struct {
+		name          string
+		epoch         int
+		miniBatch     int
+		wantEpoch     string
+		wantMiniBatch string
+		wantStart     string
+	}{
+		{name: "new run", wantEpoch: "1", wantMiniBatch: "1", wantStart: "0"},
+		{name: "resumed run", epoch: 1, miniBatch: 3, wantEpoch: "1", wantMiniBatch: "3", wantStart: "4"},
+		{name: "resumed in a later epoch", epoch: 2, miniBatch: 1, wantEpoch: "2", wantMiniBatch: "1", wantStart: "0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trainInKube := newTestTrainInKube()
+			trainInKube.Status.Epoch = tt.epoch
+			trainInKube.Status.MiniBatch = tt.miniBatch
+
+			var created []*batchv1.Job
+			orchestrator := newTestOrchestrator(t, trainInKube, &created)
+
+			err := orchestrator.Orchestrate(context.Background(), trainInKube)
+			if err == nil {
+				t.Fatalf("Orchestrate() succeeded, want the run to stop at the first job")
+			}
+			if len(created) != 1 {
+				t.Fatalf("created %d jobs, want 1", len(created))
+			}
+
+			job := created[0]
+			if got := job.Labels[EpochLabel]; got != tt.wantEpoch {
+				t.Errorf("epoch of the first job = %q, want %q", got, tt.wantEpoch)
+			}
+			if got := job.Labels[MiniBatchLabel]; got != tt.wantMiniBatch {
+				t.Errorf("minibatch of the first job = %q, want %q", got, tt.wantMiniBatch)
+			}
+			if got := jobEnv(job, "STARTING_INDEX"); got != tt.wantStart {
+				t.Errorf("STARTING_INDEX of the first job = %q, want %q", got, tt.wantStart)
+			}
+		})
+	}
+}
@@ -0,0 +1,376 @@
+package train
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	traininkubev1alpha1 "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/apis/trainink8s/v1alpha1"
+	"github.com/ChinmayaSharma-hue/TrainInKubes/pkg/paramserver"
+	"github.com/ChinmayaSharma-hue/TrainInKubes/pkg/resources"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ParameterServerPort is the port the parameter server of a run is served on,
+// by its pod and its Service.
+const ParameterServerPort = 8080
+
+// ParameterServerLabel is set on the pods of the parameter server of a
+// TrainInKube, with the name of the TrainInKube as value.
+const ParameterServerLabel = "trainink8s.com/parameter-server"
+
+// DefaultLearningRate is the learning rate of the parameter server when the
+// TrainInKube does not set one.
+const DefaultLearningRate = "0.01"
+
+// How long the parameter server of a run has to become ready, and how often it
+// is checked in the meantime.
+const (
+	parameterServerTimeout    = 5 * time.Minute
+	parameterServerPollPeriod = 2 * time.Second
+)
+
+// UsesParameterServer reports whether the workers of the run exchange their
+// gradients and weights through a parameter server.
+func UsesParameterServer(TrainInKube *traininkubev1alpha1.TrainInKube) bool {
+	return TrainInKube.Spec.ParameterServer != nil
+}
+
+// ParameterServerName returns the name of the Deployment and the Service of the
+// parameter server of the TrainInKube.
+func ParameterServerName(name string) string {
+	return name + "paramserver"
+}
+
+// ParameterServerURL returns the URL of the Service of the parameter server of
+// the TrainInKube, which is reached through the DNS of the cluster.
+func ParameterServerURL(TrainInKube *traininkubev1alpha1.TrainInKube) string {
+	return fmt.Sprintf("http://%s.%s.svc:%d", ParameterServerName(TrainInKube.Name), TrainInKube.Namespace, ParameterServerPort)
+}
+
+// ParameterServerDeployment returns the Deployment running the parameter server
+// of the TrainInKube. It saves the weights on the storage volume of the run, so
+// that they outlive its pod, and never runs more than one replica, which would
+// each keep weights of their own.
+func ParameterServerDeployment(
+	TrainInKube *traininkubev1alpha1.TrainInKube,
+	volume corev1.Volume,
+	volumeMount corev1.VolumeMount,
+	paths DataPaths,
+) *appsv1.Deployment {
+	spec := TrainInKube.Spec.ParameterServer
+	image := spec.Image
+	if image == "" {
+		image = RunImages(TrainInKube).ParameterServer
+	}
+	pullPolicy := spec.ImagePullPolicy
+	if pullPolicy == "" {
+		pullPolicy = TrainInKube.Spec.ModelImagePullPolicy
+	}
+	learningRate := spec.LearningRate
+	if learningRate == "" {
+		learningRate = DefaultLearningRate
+	}
+
+	return resources.CreateDeployment(
+		resources.CreateDeploymentWithName(ParameterServerName(TrainInKube.Name)),
+		resources.CreateDeploymentInNamespace(TrainInKube.Namespace),
+		resources.CreateDeploymentWithImage(image),
+		resources.CreateDeploymentWithImagePullPolicy(pullPolicy),
+		resources.CreateDeploymentWithArgs([]string{
+			"--addr=:" + strconv.Itoa(ParameterServerPort),
+			"--learning-rate=" + learningRate,
+			"--checkpoint=" + paths.Weights,
+			"--run=" + parameterServerRun(TrainInKube),
+		}),
+		resources.CreateDeploymentWithVolume(volume),
+		resources.CreateDeploymentWithVolumeMounts(volumeMount),
+		resources.CreateDeploymentWithPort("http", ParameterServerPort),
+		resources.CreateDeploymentWithHTTPProbes(paramserver.HealthPath, "http"),
+		resources.CreateDeploymentWithResources(spec.Resources),
+		resources.CreateDeploymentWithRecreateStrategy(),
+		resources.CreateDeploymentWithLabels(Labels(TrainInKube)),
+		resources.CreateDeploymentWithSelector(parameterServerSelector(TrainInKube)),
+		resources.CreateDeploymentWithOwnerReference(resources.CreateOwnerReference(TrainInKube)),
+	)
+}
+
+// ParameterServerService returns the Service the workers and the operator reach
+// the parameter server of the TrainInKube through.
+func ParameterServerService(TrainInKube *traininkubev1alpha1.TrainInKube) *corev1.Service {
+	return resources.CreateService(
+		resources.CreateServiceWithName(ParameterServerName(TrainInKube.Name)),
+		resources.CreateServiceInNamespace(TrainInKube.Namespace),
+		resources.CreateServiceWithPort("http", ParameterServerPort),
+		resources.CreateServiceWithLabels(Labels(TrainInKube)),
+		resources.CreateServiceWithSelector(parameterServerSelector(TrainInKube)),
+		resources.CreateServiceWithOwnerReference(resources.CreateOwnerReference(TrainInKube)),
+	)
+}
+
+// parameterServerRun identifies the run of the TrainInKube, which starts over
+// with a new start time when the spec changes, so that its parameter server
+// does not restore the weights of an earlier run.
+func parameterServerRun(TrainInKube *traininkubev1alpha1.TrainInKube) string {
+	run := string(TrainInKube.UID)
+	if TrainInKube.Status.StartTime != nil {
+		run += "-" + strconv.FormatInt(TrainInKube.Status.StartTime.Unix(), 10)
+	}
+	return run
+}
+
+func parameterServerSelector(TrainInKube *traininkubev1alpha1.TrainInKube) map[string]string {
+	return map[string]string{ParameterServerLabel: TrainInKube.Name}
+}
+
+// ExportModelJob returns the job of the aggregate stage that saves the weights
+// of the parameter server into the model at the end of the run.
+func ExportModelJob(
+	TrainInKube *traininkubev1alpha1.TrainInKube,
+	volume corev1.Volume,
+	volumeMount corev1.VolumeMount,
+	paths DataPaths,
+) *batchv1.Job {
+	envVariables := map[string]string{
+		"MODEL_LOCATION":       paths.Model,
+		"PARAMETER_SERVER_URL": ParameterServerURL(TrainInKube),
+	}
+
+	return resources.CreateJob(
+		resources.CreateJobWithName(TrainInKube.Name+"exportmodel"),
+		resources.CreateJobInNamespace(TrainInKube.Namespace),
+		resources.CreateJobWithVolume(volume),
+		resources.CreateJobWithVolumeMounts(volumeMount),
+		resources.CreateJobWithEnv(envVariables),
+		resources.CreateJobWithStage(AggregateStage(TrainInKube)),
+		resources.CreateJobWithLabels(JobLabels(TrainInKube, StageAggregate)),
+		resources.CreateJobWithOwnerReference(resources.CreateOwnerReference(TrainInKube)),
+	)
+}
+
+// parameterServerStep returns the step of the parameter server the minibatch of
+// the epoch is trained at, which is the number of minibatches trained before it.
+func parameterServerStep(TrainInKube *traininkubev1alpha1.TrainInKube, epoch int, miniBatch int) int {
+	return epoch*(TrainInKube.Spec.NumberOfSamples/TrainInKube.Spec.BatchSize) + miniBatch
+}
+
+// startParameterServer creates the Deployment and the Service of the parameter
+// server of the run, or adopts the ones created before the operator restarted,
+// and waits until the parameter server answers.
+func (t *TrainOrchestrator) startParameterServer(
+	ctx context.Context,
+	TrainInKube *traininkubev1alpha1.TrainInKube,
+	volume corev1.Volume,
+	volumeMount corev1.VolumeMount,
+	paths DataPaths,
+) error {
+	deployment := ParameterServerDeployment(TrainInKube, volume, volumeMount, paths)
+	err := t.ensureParameterServerObject(ctx, "Deployment", deployment.Name, func() error {
+		_, err := t.KubeClientSet.AppsV1().Deployments(deployment.Namespace).Create(ctx, deployment, metav1.CreateOptions{})
+		return err
+	}, func() (metav1.Object, error) {
+		return t.KubeClientSet.AppsV1().Deployments(deployment.Namespace).Get(ctx, deployment.Name, metav1.GetOptions{})
+	})
+	if err != nil {
+		return err
+	}
+
+	service := ParameterServerService(TrainInKube)
+	err = t.ensureParameterServerObject(ctx, "Service", service.Name, func() error {
+		_, err := t.KubeClientSet.CoreV1().Services(service.Namespace).Create(ctx, service, metav1.CreateOptions{})
+		return err
+	}, func() (metav1.Object, error) {
+		return t.KubeClientSet.CoreV1().Services(service.Namespace).Get(ctx, service.Name, metav1.GetOptions{})
+	})
+	if err != nil {
+		return err
+	}
+
+	url := ParameterServerURL(TrainInKube)
+	t.parameterServer = paramserver.NewClient(url, &http.Client{Timeout: time.Minute})
+
+	// The Service only sends the requests to the pod once it is ready
+	waitCtx, cancel := context.WithTimeout(ctx, parameterServerTimeout)
+	defer cancel()
+	for {
+		err = t.parameterServer.Healthy(waitCtx)
+		if err == nil {
+			break
+		}
+		select {
+		case <-time.After(parameterServerPollPeriod):
+		case <-waitCtx.Done():
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("The parameter server at %s did not become ready within %s: %v", url, parameterServerTimeout, err)
+		}
+	}
+
+	t.event(corev1.EventTypeNormal, ReasonParameterServerStarted, "The parameter server %s is ready at %s", deployment.Name, url)
+	return nil
+}
+
+// ensureParameterServerObject creates an object of the parameter server, unless
+// it already exists. An object left over from an earlier run of the TrainInKube
+// that is still being deleted is waited for first.
+func (t *TrainOrchestrator) ensureParameterServerObject(
+	ctx context.Context,
+	kind string,
+	name string,
+	create func() error,
+	get func() (metav1.Object, error),
+) error {
+	for {
+		err := create()
+		if err == nil {
+			return nil
+		}
+		if !apierrors.IsAlreadyExists(err) {
+			return fmt.Errorf("Error while creating the %s of the parameter server: %v", kind, err)
+		}
+
+		existing, err := get()
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("Error while getting the %s of the parameter server: %v", kind, err)
+		}
+		if existing.GetDeletionTimestamp() == nil {
+			t.Logger.Infof("The %s %s of the parameter server already exists", kind, name)
+			return nil
+		}
+
+		t.Logger.Infof("Waiting for the %s %s of an earlier run to be deleted", kind, name)
+		select {
+		case <-time.After(parameterServerPollPeriod):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// parameterServerApplied reports whether the parameter server already applied
+// the step, which happens when the operator restarted right after applying it.
+// It fails when the weights of the parameter server are neither at the step nor
+// right after it, for example when its checkpoint was removed.
+func (t *TrainOrchestrator) parameterServerApplied(ctx context.Context, step int) (bool, error) {
+	status, err := t.parameterServer.Status(ctx)
+	if err != nil {
+		return false, fmt.Errorf("Error while getting the status of the parameter server: %v", err)
+	}
+
+	switch {
+	case !status.Initialized && step > 0:
+		return false, fmt.Errorf("The parameter server has no weights at step %d of the run, its checkpoint is missing", step)
+	case status.Version == step:
+		return false, nil
+	case status.Version == step+1:
+		return true, nil
+	default:
+		return false, fmt.Errorf("The weights of the parameter server are at step %d while the run is at step %d", status.Version, step)
+	}
+}
+
+// parameterServerLostGradients reports whether the weights of the parameter
+// server are still at the step while some of its gradients are missing, which
+// happens when it restarted after the workers pushed them.
+func (t *TrainOrchestrator) parameterServerLostGradients(ctx context.Context, step int, gradients []int) bool {
+	status, err := t.parameterServer.Status(ctx)
+	if err != nil || !status.Initialized || status.Version != step {
+		return false
+	}
+	pushed := make(map[int]bool, len(status.Gradients))
+	for _, index := range status.Gradients {
+		pushed[index] = true
+	}
+	for _, index := range gradients {
+		if !pushed[index] {
+			return true
+		}
+	}
+	return false
+}
+
+// applyGradients has the parameter server average the gradients of the step into
+// the weights. The requests that fail are sent again as the retry policy of the
+// aggregate stage allows, while a step the weights are not at fails right away.
+func (t *TrainOrchestrator) applyGradients(
+	ctx context.Context,
+	TrainInKube *traininkubev1alpha1.TrainInKube,
+	step int,
+	gradients []int,
+) error {
+	policy := AggregateStage(TrainInKube).RetryPolicy
+	retries := 0
+	if policy.Retries != nil {
+		retries = int(*policy.Retries)
+	}
+
+	for retry := 0; ; retry++ {
+		err := t.parameterServer.Apply(ctx, step, gradients)
+		if err == nil {
+			return nil
+		}
+		failure := fmt.Errorf("Error while applying step %d on the parameter server: %v", step, err)
+		if paramserver.IsConflict(err) || ctx.Err() != nil || retry >= retries {
+			return failure
+		}
+
+		delay := retryBackoff(policy, retry)
+		t.Logger.Infof("%v, retrying in %s", failure, delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// exportModel runs the job saving the weights of the parameter server into the
+// model.
+func (t *TrainOrchestrator) exportModel(
+	ctx context.Context,
+	TrainInKube *traininkubev1alpha1.TrainInKube,
+	volume corev1.Volume,
+	volumeMount corev1.VolumeMount,
+	paths DataPaths,
+) error {
+	job := ExportModelJob(TrainInKube, volume, volumeMount, paths)
+	_, err := t.runJobs(ctx, AggregateStage(TrainInKube).RetryPolicy, job)
+	if err != nil {
+		t.jobFailedEvent(ReasonAggregationFailed, err)
+		return fmt.Errorf("Error while saving the weights of the parameter server: %v", err)
+	}
+	t.event(corev1.EventTypeNormal, ReasonModelExported, "The weights of the parameter server were saved into the model by job %s", job.Name)
+	return nil
+}
+
+// DeleteParameterServer deletes the Deployment and the Service of the parameter
+// server of the TrainInKube, if any. The Deployment is only removed after its
+// pods, so that the parameter server of a new run never shares the Service with
+// the one of an earlier run.
+func DeleteParameterServer(ctx context.Context, kubeClientSet kubernetes.Interface, namespace string, name string) error {
+	propagation := metav1.DeletePropagationForeground
+	err := kubeClientSet.AppsV1().Deployments(namespace).Delete(ctx, ParameterServerName(name), metav1.DeleteOptions{
+		PropagationPolicy: &propagation,
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("Error while deleting the Deployment of the parameter server: %v", err)
+	}
+
+	err = kubeClientSet.CoreV1().Services(namespace).Delete(ctx, ParameterServerName(name), metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("Error while deleting the Service of the parameter server: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package train
+
+import (
+	"reflect"
+	"testing"
+
+	traininkubev1alpha1 "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/apis/trainink8s/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParameterServerDeployment(t *testing.T) {
+	trainInKube := newTestTrainInKube()
+	trainInKube.UID = "uid"
+	trainInKube.Spec.ParameterServer = &traininkubev1alpha1.ParameterServerSpec{}
+	startTime := metav1.Unix(1700000000, 0)
+	trainInKube.Status.StartTime = &startTime
+	trainInKube.Status.Images = &traininkubev1alpha1.StageImages{ParameterServer: "paramserver:v1"}
+
+	volume, volumeMount, err := StorageVolume(trainInKube)
+	if err != nil {
+		t.Fatalf("StorageVolume() error: %v", err)
+	}
+	paths, err := Paths(trainInKube)
+	if err != nil {
+		t.Fatalf("Paths() error: %v", err)
+	}
+	deployment := ParameterServerDeployment(trainInKube, volume, volumeMount, paths)
+
+	pod := deployment.Spec.Template.Spec
+	container := pod.Containers[0]
+	// The image the run started with is kept when the operator config changes
+	if container.Image != "paramserver:v1" {
+		t.Errorf("image = %q, want the one recorded in the status", container.Image)
+	}
+	wantArgs := []string{
+		"--addr=:8080",
+		"--learning-rate=" + DefaultLearningRate,
+		"--checkpoint=" + paths.Weights,
+		"--run=uid-1700000000",
+	}
+	if !reflect.DeepEqual(container.Args, wantArgs) {
+		t.Errorf("args = %v, want %v", container.Args, wantArgs)
+	}
+	if len(pod.Volumes) != 1 || pod.Volumes[0].Name != volume.Name {
+		t.Errorf("volumes = %v, want the storage volume of the run", pod.Volumes)
+	}
+	if len(container.VolumeMounts) != 1 || container.VolumeMounts[0] != volumeMount {
+		t.Errorf("volume mounts = %v, want %v", container.VolumeMounts, volumeMount)
+	}
+}
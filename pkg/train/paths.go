@@ -0,0 +1,86 @@
+package train
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	traininkubev1alpha1 "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/apis/trainink8s/v1alpha1"
+)
+
+// Locations used for the spec fields that are left empty, relative to the
+// root of the storage volume.
+const (
+	DefaultPreprocessedDataLocation = "PreprocessedData"
+	DefaultSplitDatasetLocation     = "Chunks"
+	DefaultModelsLocation           = ""
+)
+
+// DataPaths are the paths the jobs of a run read and write, as seen from
+// inside the containers. The spec locations are relative to the root of the
+// storage volume, which is mounted at DataMountPath:
+//
+//	<preprocessedDataLocation>/        dataset read by the split job
+//	<splitDatasetLocation>/            one x_train_<k>.npy, y_train_<k>.npy pair per worker
+//	<modelsLocation>/model.h5          model built by the build job, updated every minibatch
+//	<modelsLocation>/Gradients/        gradients of the workers for the current minibatch
+//	<modelsLocation>/weights.json      weights kept by the parameter server, when the run deploys one
+type DataPaths struct {
+	Dataset   string
+	Chunks    string
+	Models    string
+	Model     string
+	Gradients string
+	Weights   string
+}
+
+// Paths returns the data paths of the TrainInKube. Locations that would leave
+// the storage volume are rejected.
+func Paths(TrainInKube *traininkubev1alpha1.TrainInKube) (DataPaths, error) {
+	dataset, err := volumePath(TrainInKube.Spec.PreprocessedDataLocation, DefaultPreprocessedDataLocation)
+	if err != nil {
+		return DataPaths{}, fmt.Errorf("Invalid preprocessed data location: %v", err)
+	}
+	chunks, err := volumePath(TrainInKube.Spec.SplitDatasetLocation, DefaultSplitDatasetLocation)
+	if err != nil {
+		return DataPaths{}, fmt.Errorf("Invalid split dataset location: %v", err)
+	}
+	models, err := volumePath(TrainInKube.Spec.ModelsLocation, DefaultModelsLocation)
+	if err != nil {
+		return DataPaths{}, fmt.Errorf("Invalid models location: %v", err)
+	}
+
+	return DataPaths{
+		Dataset:   dataset,
+		Chunks:    chunks,
+		Models:    models,
+		Model:     path.Join(models, "model.h5"),
+		Gradients: path.Join(models, "Gradients"),
+		Weights:   path.Join(models, "weights.json"),
+	}, nil
+}
+
+// volumePath resolves a spec location against the mount path of the storage
+// volume. Leading slashes are ignored, so "/Chunks" and "Chunks" are the same.
+func volumePath(location string, defaultLocation string) (string, error) {
+	if location == "" {
+		location = defaultLocation
+	}
+
+	err := ValidateLocation(location)
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(DataMountPath, location), nil
+}
+
+// ValidateLocation checks that a spec location stays inside the storage volume.
+func ValidateLocation(location string) error {
+	for _, element := range strings.Split(location, "/") {
+		if element == ".." {
+			return fmt.Errorf("%q must not contain \"..\"", location)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,290 @@
+package train
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	traininkubev1alpha1 "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/apis/trainink8s/v1alpha1"
+	"github.com/ChinmayaSharma-hue/TrainInKubes/pkg/coordinator"
+	"github.com/ChinmayaSharma-hue/TrainInKubes/pkg/resources"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// aggregatingWorker is the persistent worker that averages the gradients into
+// the model after every minibatch.
+const aggregatingWorker = 0
+
+// IsPersistent reports whether the workers of the run are started once for the
+// whole run.
+func IsPersistent(TrainInKube *traininkubev1alpha1.TrainInKube) bool {
+	return TrainInKube.Spec.WorkerMode == traininkubev1alpha1.WorkerModePersistent
+}
+
+// coordinatorTokenEnv holds the token the persistent workers authenticate with
+// to the coordinator.
+const coordinatorTokenEnv = "COORDINATOR_TOKEN"
+
+// PersistentWorkersJob returns the Indexed Job running the persistent workers of
+// the run, one pod per worker. Each pod trains on the shard of its completion
+// index, and asks the coordinator at COORDINATOR_URL for its steps until it is
+// told to stop, authenticating with the token.
+func PersistentWorkersJob(
+	TrainInKube *traininkubev1alpha1.TrainInKube,
+	volume corev1.Volume,
+	volumeMount corev1.VolumeMount,
+	paths DataPaths,
+	coordinatorURL string,
+	token string,
+) *batchv1.Job {
+	workers := NumberOfWorkers(TrainInKube)
+	envVariables := map[string]string{
+		"MODEL_LOCATION":        paths.Model,
+		"GRADIENT_LOCATION":     paths.Gradients,
+		"SPLIT_LOCATION":        paths.Chunks,
+		"NUMBER_OF_WORKERS":     strconv.Itoa(workers),
+		"COORDINATOR_URL":       coordinatorURL,
+		coordinatorTokenEnv:     token,
+		"TRAININKUBE_NAMESPACE": TrainInKube.Namespace,
+		"TRAININKUBE_NAME":      TrainInKube.Name,
+	}
+
+	// The deadline and the backoff limit of the stage are meant for the jobs
+	// of a single minibatch, while these workers run for the whole run
+	stage := TrainStage(TrainInKube)
+	stage.RetryPolicy.ActiveDeadlineSeconds = nil
+	stage.RetryPolicy.BackoffLimit = nil
+
+	return resources.CreateJob(
+		resources.CreateJobWithName(TrainInKube.Name+"workers"),
+		resources.CreateJobInNamespace(TrainInKube.Namespace),
+		resources.CreateJobWithVolume(volume),
+		resources.CreateJobWithVolumeMounts(volumeMount),
+		resources.CreateJobWithEnv(envVariables),
+		resources.CreateJobWithStage(stage),
+		resources.CreateJobWithIndexedCompletions(int32(workers)),
+		resources.CreateJobWithLabels(JobLabels(TrainInKube, StageTrain)),
+		resources.CreateJobWithOwnerReference(resources.CreateOwnerReference(TrainInKube)),
+	)
+}
+
+// persistentWorkers are the workers of a run started once for the whole run.
+type persistentWorkers struct {
+	run *coordinator.Run
+	job *batchv1.Job
+	// stopping is set once the workers are told to stop, after which their
+	// job is expected to finish.
+	stopping atomic.Bool
+}
+
+// startPersistentWorkers creates the job of the persistent workers, or adopts
+// the one started before the operator restarted, and registers the run with
+// the coordinator. The returned context is cancelled when the job finishes
+// before the workers are told to stop, with the reason as its cause.
+func (t *TrainOrchestrator) startPersistentWorkers(
+	ctx context.Context,
+	TrainInKube *traininkubev1alpha1.TrainInKube,
+	volume corev1.Volume,
+	volumeMount corev1.VolumeMount,
+	paths DataPaths,
+) (*persistentWorkers, context.Context, context.CancelCauseFunc, error) {
+	if t.Coordinator == nil {
+		return nil, nil, nil, errors.New("Persistent workers need the coordinator, which is not served by the operator")
+	}
+
+	token, err := newCoordinatorToken()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	job, err := t.ensureJob(ctx, PersistentWorkersJob(TrainInKube, volume, volumeMount, paths, t.CoordinatorURL, token))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// The workers started before the operator restarted keep the token of
+	// their job
+	workers := &persistentWorkers{
+		run: t.Coordinator.Register(TrainInKube.Namespace, TrainInKube.Name, NumberOfWorkers(TrainInKube), jobEnv(job, coordinatorTokenEnv)),
+		job: job,
+	}
+	t.event(corev1.EventTypeNormal, ReasonWorkersStarted, "Started %d persistent workers with job %s", workers.run.Workers(), job.Name)
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	go func() {
+		err := t.JobTracker.WaitForJobToFinish(ctx, job)
+		if ctx.Err() != nil || workers.stopping.Load() {
+			return
+		}
+		if err == nil {
+			err = fmt.Errorf("Job %s of the persistent workers finished before the end of the run", job.Name)
+		}
+		cancel(err)
+	}()
+
+	return workers, ctx, cancel, nil
+}
+
+// trainMiniBatchPersistent has every persistent worker train on its share of
+// the minibatch, and once all of them are done, has the first one average the
+// gradients into the model.
+func (t *TrainOrchestrator) trainMiniBatchPersistent(
+	ctx context.Context,
+	workers *persistentWorkers,
+	TrainInKube *traininkubev1alpha1.TrainInKube,
+	epoch int,
+	miniBatch int,
+) error {
+	startingIndex, endingIndex := shardRange(TrainInKube, miniBatch)
+	err := t.recordMiniBatch(ctx, TrainInKube, epoch, miniBatch)
+	if err != nil {
+		return err
+	}
+
+	gradients := make([]int, workers.run.Workers())
+	for k := range gradients {
+		gradients[k] = k
+	}
+
+	start := time.Now()
+	err = t.runStep(ctx, workers, TrainStage(TrainInKube).RetryPolicy, coordinator.Step{
+		ID:            stepID(epoch, miniBatch, coordinator.ActionTrain),
+		Action:        coordinator.ActionTrain,
+		Epoch:         epoch + 1,
+		MiniBatch:     miniBatch + 1,
+		StartingIndex: startingIndex,
+		EndingIndex:   endingIndex,
+	})
+	if err != nil {
+		t.event(corev1.EventTypeWarning, ReasonJobFailed, "%v", err)
+		return err
+	}
+	observeStage(StageTrain, start)
+
+	start = time.Now()
+	err = t.runStep(ctx, workers, AggregateStage(TrainInKube).RetryPolicy, coordinator.Step{
+		ID:        stepID(epoch, miniBatch, coordinator.ActionAggregate),
+		Action:    coordinator.ActionAggregate,
+		Epoch:     epoch + 1,
+		MiniBatch: miniBatch + 1,
+		Gradients: gradients,
+	}, aggregatingWorker)
+	if err != nil {
+		t.event(corev1.EventTypeWarning, ReasonAggregationFailed, "%v", err)
+		return err
+	}
+	observeStage(StageAggregate, start)
+	return nil
+}
+
+// stopPersistentWorkers tells the persistent workers to exit, waits for their
+// job to succeed and deletes it.
+func (t *TrainOrchestrator) stopPersistentWorkers(ctx context.Context, workers *persistentWorkers) error {
+	workers.stopping.Store(true)
+
+	_, err := workers.run.Do(ctx, coordinator.Step{ID: "stop", Action: coordinator.ActionStop})
+	if err != nil {
+		return causeOf(ctx, err)
+	}
+	err = t.JobTracker.WaitForJobToFinish(ctx, workers.job)
+	if err != nil {
+		return err
+	}
+	return t.deleteJobs(ctx, workers.job)
+}
+
+// runStep assigns the step to the given persistent workers, or all of them, and
+// waits until they all acknowledged it. The workers that failed the step are
+// given it again as allowed by the retry policy.
+func (t *TrainOrchestrator) runStep(
+	ctx context.Context,
+	workers *persistentWorkers,
+	policy traininkubev1alpha1.RetryPolicy,
+	step coordinator.Step,
+	indices ...int,
+) error {
+	retries := 0
+	if policy.Retries != nil {
+		retries = int(*policy.Retries)
+	}
+
+	for retry := 0; ; retry++ {
+		step.Attempt = retry
+		failed, err := workers.run.Do(ctx, step, indices...)
+		if err != nil {
+			return causeOf(ctx, err)
+		}
+		if len(failed) == 0 {
+			return nil
+		}
+
+		indices = make([]int, 0, len(failed))
+		for worker := range failed {
+			indices = append(indices, worker)
+		}
+		sort.Ints(indices)
+		failure := fmt.Errorf("Step %s failed on workers %v: %s", step.ID, indices, failed[indices[0]])
+
+		if retry >= retries {
+			if retries == 0 {
+				return failure
+			}
+			return fmt.Errorf("%v, giving up after %d retries", failure, retries)
+		}
+
+		delay := retryBackoff(policy, retry)
+		t.Logger.Infof("%v, retrying in %s", failure, delay)
+		t.event(corev1.EventTypeWarning, ReasonRetryingJobs, "Running step %s again on workers %v in %s, retry %d of %d: %s",
+			step.ID, indices, delay, retry+1, retries, failed[indices[0]])
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return causeOf(ctx, ctx.Err())
+		}
+	}
+}
+
+// newCoordinatorToken returns a random token for the persistent workers of a
+// run.
+func newCoordinatorToken() (string, error) {
+	token := make([]byte, 32)
+	_, err := rand.Read(token)
+	if err != nil {
+		return "", fmt.Errorf("Error while generating the token of the persistent workers: %v", err)
+	}
+	return hex.EncodeToString(token), nil
+}
+
+// jobEnv returns the value of the variable in the containers of the job.
+func jobEnv(job *batchv1.Job, name string) string {
+	for _, container := range job.Spec.Template.Spec.Containers {
+		for _, env := range container.Env {
+			if env.Name == name {
+				return env.Value
+			}
+		}
+	}
+	return ""
+}
+
+// stepID names the step of a minibatch, counting from 1 like the status.
+func stepID(epoch int, miniBatch int, action string) string {
+	return fmt.Sprintf("epoch-%d-minibatch-%d-%s", epoch+1, miniBatch+1, action)
+}
+
+// causeOf returns the reason the context was cancelled in place of the error,
+// when there is one.
+func causeOf(ctx context.Context, err error) error {
+	if cause := context.Cause(ctx); cause != nil && !errors.Is(cause, context.Canceled) {
+		return cause
+	}
+	return err
+}
@@ -0,0 +1,44 @@
+package train
+
+import (
+	"testing"
+
+	traininkubev1alpha1 "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/apis/trainink8s/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestPersistentWorkersJob(t *testing.T) {
+	trainInKube := newTestTrainInKube()
+	trainInKube.Spec.WorkerMode = traininkubev1alpha1.WorkerModePersistent
+	backoffLimit := int32(2)
+	deadline := int64(600)
+	trainInKube.Spec.Stages.Train.RetryPolicy = traininkubev1alpha1.RetryPolicy{
+		BackoffLimit:          &backoffLimit,
+		ActiveDeadlineSeconds: &deadline,
+		FatalExitCodes:        []int32{3},
+	}
+
+	paths, err := Paths(trainInKube)
+	if err != nil {
+		t.Fatalf("Paths() error: %v", err)
+	}
+	job := PersistentWorkersJob(trainInKube, corev1.Volume{}, corev1.VolumeMount{}, paths, "http://coordinator:8082", "secret")
+
+	// The limits of the stage are meant for the jobs of a single minibatch
+	if job.Spec.BackoffLimit != nil {
+		t.Errorf("BackoffLimit = %d, want it unset", *job.Spec.BackoffLimit)
+	}
+	if job.Spec.ActiveDeadlineSeconds != nil {
+		t.Errorf("ActiveDeadlineSeconds = %d, want it unset", *job.Spec.ActiveDeadlineSeconds)
+	}
+	if job.Spec.PodFailurePolicy == nil {
+		t.Errorf("the fatal exit codes of the stage were dropped")
+	}
+	if job.Spec.Completions == nil || *job.Spec.Completions != 2 {
+		t.Errorf("Completions = %v, want one per worker", job.Spec.Completions)
+	}
+	if got := jobEnv(job, coordinatorTokenEnv); got != "secret" {
+		t.Errorf("%s = %q, want the token of the run", coordinatorTokenEnv, got)
+	}
+}
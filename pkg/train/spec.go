@@ -0,0 +1,100 @@
+package train
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+
+	traininkubev1alpha1 "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/apis/trainink8s/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+)
+
+// TrainInKubeLabel is set on every resource created for a TrainInKube, with the
+// name of the TrainInKube as value.
+const TrainInKubeLabel = "trainink8s.com/traininkube"
+
+// EpochLabel and MiniBatchLabel are set on the jobs training a minibatch, with
+// the epoch and the minibatch they train, counting from 1.
+const (
+	EpochLabel     = "trainink8s.com/epoch"
+	MiniBatchLabel = "trainink8s.com/minibatch"
+)
+
+// StageLabel is set on every job, with the stage of the run the job belongs to.
+const StageLabel = "trainink8s.com/stage"
+
+// AttemptLabel is set on every job, with the number of times the job was run
+// again for the same step, counting from 0.
+const AttemptLabel = "trainink8s.com/attempt"
+
+// Stages of a run, as set in the StageLabel of its jobs.
+const (
+	StageBuild     = "build"
+	StageSplit     = "split"
+	StageTrain     = "train"
+	StageAggregate = "aggregate"
+)
+
+// SpecHashAnnotation is set on the ConfigMap of a run, with the hash of the spec
+// the run was started with.
+const SpecHashAnnotation = "trainink8s.com/spec-hash"
+
+// Labels returns the labels set on the resources created for the TrainInKube.
+func Labels(TrainInKube *traininkubev1alpha1.TrainInKube) map[string]string {
+	return map[string]string{
+		TrainInKubeLabel: TrainInKube.Name,
+	}
+}
+
+// JobLabels returns the labels set on the jobs of the stage.
+func JobLabels(TrainInKube *traininkubev1alpha1.TrainInKube, stage string) map[string]string {
+	labels := Labels(TrainInKube)
+	labels[StageLabel] = stage
+	return labels
+}
+
+// StepLabels returns the labels set on the jobs of the stage training the
+// minibatch of the epoch, counting from 0.
+func StepLabels(TrainInKube *traininkubev1alpha1.TrainInKube, stage string, epoch int, miniBatch int) map[string]string {
+	labels := JobLabels(TrainInKube, stage)
+	labels[EpochLabel] = strconv.Itoa(epoch + 1)
+	labels[MiniBatchLabel] = strconv.Itoa(miniBatch + 1)
+	return labels
+}
+
+// OnlyEpochsChanged reports whether the specs of the TrainInKubes differ in
+// nothing but the number of epochs, the only change applied to a run in progress.
+func OnlyEpochsChanged(old *traininkubev1alpha1.TrainInKube, new *traininkubev1alpha1.TrainInKube) bool {
+	oldSpec := old.Spec.DeepCopy()
+	newSpec := new.Spec.DeepCopy()
+	oldSpec.Epochs = 0
+	newSpec.Epochs = 0
+	return apiequality.Semantic.DeepEqual(oldSpec, newSpec)
+}
+
+// SpecHash hashes the spec of the TrainInKube, leaving out the number of epochs.
+// Changing only the number of epochs keeps the hash.
+func SpecHash(TrainInKube *traininkubev1alpha1.TrainInKube) (string, error) {
+	spec := TrainInKube.Spec.DeepCopy()
+	spec.Epochs = 0
+
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return "", fmt.Errorf("Error while encoding the spec: %v", err)
+	}
+
+	hash := fnv.New32a()
+	_, _ = hash.Write(data)
+	return fmt.Sprintf("%08x", hash.Sum32()), nil
+}
+
+// JobStage returns the stage of the job, from its StageLabel. Jobs created
+// before the label was introduced have the unknown stage.
+func JobStage(job *batchv1.Job) string {
+	if stage, ok := job.Labels[StageLabel]; ok {
+		return stage
+	}
+	return "unknown"
+}
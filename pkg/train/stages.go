@@ -0,0 +1,177 @@
+package train
+
+import (
+	"sync"
+
+	traininkubev1alpha1 "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/apis/trainink8s/v1alpha1"
+	"github.com/ChinmayaSharma-hue/TrainInKubes/pkg/resources"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Images used for the stages that the TrainInKube does not configure, unless
+// the operator is configured with other ones.
+const (
+	DefaultBuildImage           = "buildjob:latest"
+	DefaultSplitImage           = "splitjob:latest"
+	DefaultTrainImage           = "trainjob:latest"
+	DefaultAggregateImage       = "modelupdatejob:latest"
+	DefaultParameterServerImage = "parameterserver:latest"
+)
+
+// DefaultWorkerRetries is the number of times the failed workers of a minibatch
+// are run again when the train stage does not set its retries.
+const DefaultWorkerRetries int32 = 3
+
+// Images are the images of the stages that the TrainInKube does not configure.
+type Images struct {
+	Build     string `json:"build,omitempty"`
+	Split     string `json:"split,omitempty"`
+	Train     string `json:"train,omitempty"`
+	Aggregate string `json:"aggregate,omitempty"`
+	// ParameterServer is the image of the parameter server of the runs that
+	// deploy one without setting its image.
+	ParameterServer string `json:"parameterServer,omitempty"`
+}
+
+var (
+	defaultImages     = BuiltinImages()
+	defaultImagesLock sync.RWMutex
+)
+
+// BuiltinImages returns the images used when the operator is not configured
+// with other ones.
+func BuiltinImages() Images {
+	return Images{
+		Build:           DefaultBuildImage,
+		Split:           DefaultSplitImage,
+		Train:           DefaultTrainImage,
+		Aggregate:       DefaultAggregateImage,
+		ParameterServer: DefaultParameterServerImage,
+	}
+}
+
+// DefaultImages returns the images currently used for the stages that the
+// TrainInKube does not configure.
+func DefaultImages() Images {
+	defaultImagesLock.RLock()
+	defer defaultImagesLock.RUnlock()
+
+	return defaultImages
+}
+
+// SetDefaultImages changes the images used for the stages that the TrainInKube
+// does not configure. Empty images keep their builtin value. Only the runs
+// started afterwards use the new images, as the runs in progress keep the
+// images recorded in their status.
+func SetDefaultImages(images Images) {
+	builtin := BuiltinImages()
+	if images.Build == "" {
+		images.Build = builtin.Build
+	}
+	if images.Split == "" {
+		images.Split = builtin.Split
+	}
+	if images.Train == "" {
+		images.Train = builtin.Train
+	}
+	if images.Aggregate == "" {
+		images.Aggregate = builtin.Aggregate
+	}
+	if images.ParameterServer == "" {
+		images.ParameterServer = builtin.ParameterServer
+	}
+
+	defaultImagesLock.Lock()
+	defer defaultImagesLock.Unlock()
+
+	defaultImages = images
+}
+
+// StatusImages returns the images to record in the status of a run.
+func StatusImages(images Images) *traininkubev1alpha1.StageImages {
+	return (*traininkubev1alpha1.StageImages)(&images)
+}
+
+// RunImages returns the images recorded in the status of the TrainInKube when
+// its run started, or the current default images when none were recorded.
+func RunImages(TrainInKube *traininkubev1alpha1.TrainInKube) Images {
+	if TrainInKube.Status.Images == nil {
+		return DefaultImages()
+	}
+	return Images(*TrainInKube.Status.Images)
+}
+
+// BuildStage returns the container settings of the job that builds the model.
+// spec.modelImage is used when the build stage does not set an image.
+func BuildStage(TrainInKube *traininkubev1alpha1.TrainInKube) traininkubev1alpha1.StageSpec {
+	image := RunImages(TrainInKube).Build
+	if TrainInKube.Spec.ModelImage != "" {
+		image = TrainInKube.Spec.ModelImage
+	}
+	return stageWithDefaults(TrainInKube, TrainInKube.Spec.Stages.Build, image)
+}
+
+// BuildJob returns the job that builds the model of the TrainInKube, in the
+// namespace of the TrainInKube.
+func BuildJob(
+	TrainInKube *traininkubev1alpha1.TrainInKube,
+	volume corev1.Volume,
+	volumeMount corev1.VolumeMount,
+	paths DataPaths,
+) *batchv1.Job {
+	envVariables := map[string]string{
+		"MODEL_STORAGE_LOCATION": paths.Models,
+	}
+
+	return resources.CreateJob(
+		resources.CreateJobWithName(TrainInKube.Name+"buildmodel"),
+		resources.CreateJobInNamespace(TrainInKube.Namespace),
+		resources.CreateJobWithVolume(volume),
+		resources.CreateJobWithVolumeMounts(volumeMount),
+		resources.CreateJobWithEnv(envVariables),
+		resources.CreateJobWithStage(BuildStage(TrainInKube)),
+		resources.CreateJobWithLabels(JobLabels(TrainInKube, StageBuild)),
+		resources.CreateJobWithOwnerReference(resources.CreateOwnerReference(TrainInKube)),
+	)
+}
+
+// SplitStage returns the container settings of the job that splits the dataset.
+func SplitStage(TrainInKube *traininkubev1alpha1.TrainInKube) traininkubev1alpha1.StageSpec {
+	return stageWithDefaults(TrainInKube, TrainInKube.Spec.Stages.Split, RunImages(TrainInKube).Split)
+}
+
+// TrainStage returns the container settings of the worker jobs. Failed workers
+// are retried DefaultWorkerRetries times unless the stage sets its retries.
+func TrainStage(TrainInKube *traininkubev1alpha1.TrainInKube) traininkubev1alpha1.StageSpec {
+	stage := stageWithDefaults(TrainInKube, TrainInKube.Spec.Stages.Train, RunImages(TrainInKube).Train)
+	if stage.RetryPolicy.Retries == nil {
+		retries := DefaultWorkerRetries
+		stage.RetryPolicy.Retries = &retries
+	}
+	return stage
+}
+
+// AggregateStage returns the container settings of the job that averages the
+// gradients and updates the model.
+func AggregateStage(TrainInKube *traininkubev1alpha1.TrainInKube) traininkubev1alpha1.StageSpec {
+	return stageWithDefaults(TrainInKube, TrainInKube.Spec.Stages.Aggregate, RunImages(TrainInKube).Aggregate)
+}
+
+// stageWithDefaults fills the image of the stage with the given default, and its
+// pull policy with spec.modelImagePullPolicy.
+func stageWithDefaults(
+	TrainInKube *traininkubev1alpha1.TrainInKube,
+	stage traininkubev1alpha1.StageSpec,
+	image string,
+) traininkubev1alpha1.StageSpec {
+	stage = *stage.DeepCopy()
+	if stage.Image == "" {
+		stage.Image = image
+	}
+	if stage.ImagePullPolicy == "" {
+		stage.ImagePullPolicy = TrainInKube.Spec.ModelImagePullPolicy
+	}
+	return stage
+}
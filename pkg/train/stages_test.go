@@ -0,0 +1,31 @@
+package train
+
+import (
+	"testing"
+)
+
+func TestStagesKeepRecordedImages(t *testing.T) {
+	t.Cleanup(func() { SetDefaultImages(Images{}) })
+
+	trainInKube := newTestTrainInKube()
+	trainInKube.Spec.ModelImage = ""
+	trainInKube.Status.Images = StatusImages(DefaultImages())
+
+	// A reload of the config only applies to the runs started afterwards
+	SetDefaultImages(Images{Train: "trainjob:v2", Aggregate: "modelupdatejob:v2"})
+
+	if got := TrainStage(trainInKube).Image; got != DefaultTrainImage {
+		t.Errorf("image of the train stage of the run in progress = %q, want %q", got, DefaultTrainImage)
+	}
+	if got := AggregateStage(trainInKube).Image; got != DefaultAggregateImage {
+		t.Errorf("image of the aggregate stage of the run in progress = %q, want %q", got, DefaultAggregateImage)
+	}
+
+	trainInKube.Status.Images = nil
+	if got := TrainStage(trainInKube).Image; got != "trainjob:v2" {
+		t.Errorf("image of the train stage of a new run = %q, want %q", got, "trainjob:v2")
+	}
+	if got := SplitStage(trainInKube).Image; got != DefaultSplitImage {
+		t.Errorf("image of the split stage of a new run = %q, want %q", got, DefaultSplitImage)
+	}
+}
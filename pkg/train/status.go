@@ -0,0 +1,69 @@
+package train
+
+import (
+	"context"
+
+	traininkubev1alpha1 "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/apis/trainink8s/v1alpha1"
+	traininkubev1alpha1clientset "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/client/clientset/versioned"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+// UpdateStatus applies update to the latest version of the TrainInKube and
+// writes its status subresource, retrying on conflicts.
+func UpdateStatus(
+	ctx context.Context,
+	clientSet traininkubev1alpha1clientset.Interface,
+	TrainInKube *traininkubev1alpha1.TrainInKube,
+	update func(*traininkubev1alpha1.TrainInKube),
+) (*traininkubev1alpha1.TrainInKube, error) {
+	client := clientSet.FooV1alpha1().TrainInKubes(TrainInKube.Namespace)
+
+	var updated *traininkubev1alpha1.TrainInKube
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		latest, err := client.Get(ctx, TrainInKube.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		update(latest)
+
+		updated, err = client.UpdateStatus(ctx, latest, metav1.UpdateOptions{})
+		return err
+	})
+
+	return updated, err
+}
+
+// SetCondition adds or updates a condition in the status of the TrainInKube.
+func SetCondition(
+	TrainInKube *traininkubev1alpha1.TrainInKube,
+	conditionType string,
+	status metav1.ConditionStatus,
+	reason string,
+	message string,
+) {
+	meta.SetStatusCondition(&TrainInKube.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: TrainInKube.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// IsFinished reports whether the run reached a terminal phase.
+func IsFinished(TrainInKube *traininkubev1alpha1.TrainInKube) bool {
+	return TrainInKube.Status.Phase == traininkubev1alpha1.PhaseSucceeded ||
+		TrainInKube.Status.Phase == traininkubev1alpha1.PhaseFailed
+}
+
+func (t *TrainOrchestrator) updateStatus(ctx context.Context, update func(*traininkubev1alpha1.TrainInKube)) error {
+	updated, err := UpdateStatus(ctx, t.TrainInKubeClientSet, t.TrainInKube, update)
+	if err != nil {
+		return err
+	}
+	t.TrainInKube = updated
+	return nil
+}
@@ -0,0 +1,30 @@
+package train
+
+import (
+	"fmt"
+
+	traininkubev1alpha1 "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/apis/trainink8s/v1alpha1"
+	"github.com/ChinmayaSharma-hue/TrainInKubes/pkg/resources"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// DataMountPath is where the storage of a run is mounted in every job.
+const DataMountPath = "/data"
+
+// StorageVolume returns the volume shared by the jobs of the TrainInKube and
+// its mount. Runs that do not configure storage use a HostPath volume at /data.
+func StorageVolume(TrainInKube *traininkubev1alpha1.TrainInKube) (corev1.Volume, corev1.VolumeMount, error) {
+	name := TrainInKube.Name + "volume"
+
+	storage := TrainInKube.Spec.Storage
+	if storage == (traininkubev1alpha1.StorageSpec{}) {
+		storage.HostPath = &corev1.HostPathVolumeSource{Path: DataMountPath}
+	}
+
+	volume, err := resources.CreateStorageVolume(name, storage)
+	if err != nil {
+		return corev1.Volume{}, corev1.VolumeMount{}, fmt.Errorf("Invalid storage for %s: %v", TrainInKube.Name, err)
+	}
+
+	return volume, resources.CreateVolumeMount(name, DataMountPath), nil
+}
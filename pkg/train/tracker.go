@@ -0,0 +1,279 @@
+package train
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ChinmayaSharma-hue/TrainInKubes/pkg/metrics"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// JobTracker tells waiters when jobs finish or are deleted. It is fed by the
+// event handlers of the job informer, so waiting for a job costs nothing until
+// the job changes.
+type JobTracker struct {
+	indexer cache.Indexer
+
+	waiters map[string][]*jobWaiter
+	lock    sync.Mutex
+}
+
+// jobWaiter is a caller blocked on a job, waiting for the job to finish, to be
+// deleted, or to change in any way.
+type jobWaiter struct {
+	kind waitKind
+	done chan error
+}
+
+type waitKind int
+
+const (
+	waitForFinish waitKind = iota
+	waitForDeletion
+	waitForChange
+)
+
+// NewJobTracker registers the tracker on the job informer. The informer has to
+// be started separately.
+func NewJobTracker(jobInformer cache.SharedIndexInformer) *JobTracker {
+	tracker := &JobTracker{
+		indexer: jobInformer.GetIndexer(),
+		waiters: make(map[string][]*jobWaiter),
+	}
+
+	jobInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    tracker.jobChanged,
+		UpdateFunc: tracker.jobUpdated,
+		DeleteFunc: tracker.jobDeleted,
+	})
+
+	return tracker
+}
+
+// WaitForJobToFinish blocks until the job succeeds, fails, or is deleted, or
+// until the context is done. Deadlines are set through the context.
+func (t *JobTracker) WaitForJobToFinish(ctx context.Context, job *batchv1.Job) error {
+	return t.wait(ctx, job, waitForFinish)
+}
+
+// WaitForJobToBeDeleted blocks until the job is gone from the informer, or until
+// the context is done.
+func (t *JobTracker) WaitForJobToBeDeleted(ctx context.Context, job *batchv1.Job) error {
+	return t.wait(ctx, job, waitForDeletion)
+}
+
+// WaitForJobToChange blocks until the job in the informer differs from the
+// given version of it, and returns the new version. A job the informer has not
+// seen yet is waited for. It fails when the job is deleted, or when the context
+// is done.
+func (t *JobTracker) WaitForJobToChange(ctx context.Context, job *batchv1.Job) (*batchv1.Job, error) {
+	key, err := cache.MetaNamespaceKeyFunc(job)
+	if err != nil {
+		return nil, fmt.Errorf("error while getting the key for the object: %v", err)
+	}
+
+	for {
+		obj, exists, err := t.indexer.GetByKey(key)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			current, ok := obj.(*batchv1.Job)
+			if !ok {
+				return nil, errors.New("Error while converting the job object to job type")
+			}
+			if current.ResourceVersion != job.ResourceVersion {
+				return current, nil
+			}
+		}
+
+		err = t.wait(ctx, job, waitForChange)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (t *JobTracker) wait(ctx context.Context, job *batchv1.Job, kind waitKind) error {
+	key, err := cache.MetaNamespaceKeyFunc(job)
+	if err != nil {
+		return fmt.Errorf("error while getting the key for the object: %v", err)
+	}
+
+	waiter := &jobWaiter{
+		kind: kind,
+		done: make(chan error, 1),
+	}
+
+	// The waiter is registered before looking at the job, so that a change
+	// between the two is not missed
+	t.lock.Lock()
+	t.waiters[key] = append(t.waiters[key], waiter)
+	t.lock.Unlock()
+	defer t.removeWaiter(key, waiter)
+
+	obj, exists, err := t.indexer.GetByKey(key)
+	if err != nil {
+		return err
+	}
+	switch {
+	case !exists && kind == waitForDeletion:
+		return nil
+	case exists && kind != waitForDeletion:
+		current, ok := obj.(*batchv1.Job)
+		if !ok {
+			return errors.New("Error while converting the job object to job type")
+		}
+		if kind == waitForChange && current.ResourceVersion != job.ResourceVersion {
+			return nil
+		}
+		if finished, err := jobResult(current); finished && kind == waitForFinish {
+			return err
+		}
+	}
+
+	select {
+	case err := <-waiter.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *JobTracker) removeWaiter(key string, waiter *jobWaiter) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	waiters := t.waiters[key]
+	for i, w := range waiters {
+		if w == waiter {
+			waiters = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+	if len(waiters) == 0 {
+		delete(t.waiters, key)
+	} else {
+		t.waiters[key] = waiters
+	}
+}
+
+func (t *JobTracker) jobChanged(obj interface{}) {
+	job, ok := obj.(*batchv1.Job)
+	if !ok {
+		return
+	}
+
+	key, keyErr := cache.MetaNamespaceKeyFunc(job)
+	if keyErr != nil {
+		return
+	}
+	t.notify(key, waitForChange, nil)
+
+	finished, err := jobResult(job)
+	if !finished {
+		return
+	}
+	t.notify(key, waitForFinish, err)
+}
+
+// jobUpdated records the metrics of the jobs that just finished, before
+// notifying their waiters. Jobs seen finished for the first time when the
+// informer lists them are not counted again.
+func (t *JobTracker) jobUpdated(oldObj interface{}, newObj interface{}) {
+	oldJob, ok := oldObj.(*batchv1.Job)
+	newJob, newOk := newObj.(*batchv1.Job)
+	if ok && newOk {
+		wasFinished, _ := jobResult(oldJob)
+		finished, err := jobResult(newJob)
+		if finished && !wasFinished {
+			observeJob(newJob, err)
+		}
+	}
+
+	t.jobChanged(newObj)
+}
+
+func (t *JobTracker) jobDeleted(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return
+	}
+
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	if job, ok := obj.(*batchv1.Job); ok {
+		metrics.JobsDeleted.WithLabelValues(JobStage(job)).Inc()
+	}
+
+	_, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return
+	}
+
+	deleted := &JobFailedError{Job: name, Message: "the job was deleted before finishing"}
+	t.notify(key, waitForDeletion, nil)
+	t.notify(key, waitForFinish, deleted)
+	t.notify(key, waitForChange, deleted)
+}
+
+// notify hands the result to the waiters of the key waiting for the same kind
+// of change.
+func (t *JobTracker) notify(key string, kind waitKind, result error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, waiter := range t.waiters[key] {
+		if waiter.kind != kind {
+			continue
+		}
+		select {
+		case waiter.done <- result:
+		default:
+		}
+	}
+}
+
+// observeJob records the duration and the result of the finished job.
+func observeJob(job *batchv1.Job, err error) {
+	stage := JobStage(job)
+	result := "succeeded"
+	end := job.Status.CompletionTime
+	if err != nil {
+		result = "failed"
+		metrics.JobsFailed.WithLabelValues(stage).Inc()
+		for _, condition := range job.Status.Conditions {
+			if condition.Type == batchv1.JobFailed {
+				end = &condition.LastTransitionTime
+			}
+		}
+	}
+
+	if job.Status.StartTime == nil || end == nil {
+		return
+	}
+	duration := end.Sub(job.Status.StartTime.Time)
+	metrics.JobDuration.WithLabelValues(stage, result).Observe(duration.Seconds())
+}
+
+// jobResult reports whether the job finished, and the error it failed with.
+func jobResult(job *batchv1.Job) (bool, error) {
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case batchv1.JobComplete:
+			return true, nil
+		case batchv1.JobFailed:
+			return true, &JobFailedError{Job: job.Name, Reason: condition.Reason, Message: condition.Message}
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,277 @@
+package train
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	fcache "k8s.io/client-go/tools/cache/testing"
+)
+
+// testTimeout bounds every wait, so that a lost wakeup fails the test instead
+// of hanging it.
+const testTimeout = 5 * time.Second
+
+// newTestTracker returns a tracker fed by a running informer over a fake
+// source, which the test changes to drive the tracker.
+func newTestTracker(t *testing.T) (*JobTracker, *fcache.FakeControllerSource) {
+	t.Helper()
+
+	source := fcache.NewFakeControllerSource()
+	informer := cache.NewSharedIndexInformer(source, &batchv1.Job{}, 0, cache.Indexers{})
+	tracker := NewJobTracker(informer)
+
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	go informer.Run(stopCh)
+	if !cache.WaitForCacheSync(stopCh, informer.HasSynced) {
+		t.Fatalf("Failed to wait for the informer to sync")
+	}
+
+	return tracker, source
+}
+
+func newJob(name string) *batchv1.Job {
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: testNamespace,
+		},
+	}
+}
+
+// finished returns a copy of the job with the condition set.
+func finished(job *batchv1.Job, conditionType batchv1.JobConditionType) *batchv1.Job {
+	job = job.DeepCopy()
+	job.Status.Conditions = append(job.Status.Conditions, batchv1.JobCondition{
+		Type:    conditionType,
+		Status:  corev1.ConditionTrue,
+		Message: "BackoffLimitExceeded",
+	})
+	return job
+}
+
+// waitAsync runs the wait in the background and returns the channel its result
+// is sent on.
+func waitAsync(wait func(context.Context, *batchv1.Job) error, job *batchv1.Job) chan error {
+	result := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+		defer cancel()
+		result <- wait(ctx, job)
+	}()
+	return result
+}
+
+// eventually waits for the condition to hold, such as the informer seeing a
+// change made to the source.
+func eventually(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(testTimeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("The condition did not hold in %v", testTimeout)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// registered reports whether a waiter is registered for the job.
+func registered(tracker *JobTracker, job *batchv1.Job) func() bool {
+	return func() bool {
+		tracker.lock.Lock()
+		defer tracker.lock.Unlock()
+		return len(tracker.waiters[testNamespace+"/"+job.Name]) > 0
+	}
+}
+
+func TestWaitForJobToFinish(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition batchv1.JobConditionType
+		wantErr   bool
+	}{
+		{name: "complete", condition: batchv1.JobComplete},
+		{name: "failed", condition: batchv1.JobFailed, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker, source := newTestTracker(t)
+			job := newJob("train")
+			source.Add(job.DeepCopy())
+
+			result := waitAsync(tracker.WaitForJobToFinish, job)
+			eventually(t, registered(tracker, job))
+			source.Modify(finished(job, tt.condition))
+
+			if err := <-result; (err != nil) != tt.wantErr {
+				t.Errorf("WaitForJobToFinish() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWaitForJobToFinishAlreadyFinished(t *testing.T) {
+	tracker, source := newTestTracker(t)
+	job := newJob("train")
+	source.Add(finished(job, batchv1.JobComplete))
+	eventually(t, func() bool {
+		_, exists, _ := tracker.indexer.GetByKey(testNamespace + "/train")
+		return exists
+	})
+
+	// No event is left to wake the waiter, so the result comes from the cache
+	if err := <-waitAsync(tracker.WaitForJobToFinish, job); err != nil {
+		t.Errorf("WaitForJobToFinish() error = %v, want nil", err)
+	}
+}
+
+// TestWaitForJobToFinishNoLostWakeups races the waiters against the jobs
+// finishing, so that some jobs finish while their waiter is being registered.
+func TestWaitForJobToFinishNoLostWakeups(t *testing.T) {
+	tracker, source := newTestTracker(t)
+
+	results := make([]chan error, 100)
+	for i := range results {
+		job := newJob("train" + strconv.Itoa(i))
+		source.Add(job.DeepCopy())
+
+		results[i] = waitAsync(tracker.WaitForJobToFinish, job)
+		go source.Modify(finished(job, batchv1.JobComplete))
+	}
+
+	for i, result := range results {
+		if err := <-result; err != nil {
+			t.Errorf("WaitForJobToFinish(train%d) error = %v, want nil", i, err)
+		}
+	}
+}
+
+func TestWaitForJobToFinishDeleted(t *testing.T) {
+	tracker, source := newTestTracker(t)
+	job := newJob("train")
+	source.Add(job.DeepCopy())
+
+	result := waitAsync(tracker.WaitForJobToFinish, job)
+	eventually(t, registered(tracker, job))
+	source.Delete(job.DeepCopy())
+
+	if err := <-result; err == nil {
+		t.Errorf("WaitForJobToFinish() succeeded for a job deleted before finishing")
+	}
+}
+
+func TestWaitForJobToFinishContextDone(t *testing.T) {
+	tracker, source := newTestTracker(t)
+	job := newJob("train")
+	source.Add(job.DeepCopy())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := tracker.WaitForJobToFinish(ctx, job); err != context.DeadlineExceeded {
+		t.Errorf("WaitForJobToFinish() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if registered(tracker, job)() {
+		t.Errorf("the waiter was not removed")
+	}
+}
+
+func TestWaitForJobToBeDeleted(t *testing.T) {
+	t.Run("never created", func(t *testing.T) {
+		tracker, _ := newTestTracker(t)
+		if err := <-waitAsync(tracker.WaitForJobToBeDeleted, newJob("train")); err != nil {
+			t.Errorf("WaitForJobToBeDeleted() error = %v, want nil", err)
+		}
+	})
+
+	t.Run("deleted while waiting", func(t *testing.T) {
+		tracker, source := newTestTracker(t)
+		job := newJob("train")
+		source.Add(job.DeepCopy())
+		eventually(t, func() bool {
+			_, exists, _ := tracker.indexer.GetByKey(testNamespace + "/train")
+			return exists
+		})
+
+		result := waitAsync(tracker.WaitForJobToBeDeleted, job)
+		eventually(t, registered(tracker, job))
+		source.Delete(job.DeepCopy())
+
+		if err := <-result; err != nil {
+			t.Errorf("WaitForJobToBeDeleted() error = %v, want nil", err)
+		}
+	})
+
+	// The delete races the registration of the waiter
+	t.Run("delete racing the waiter", func(t *testing.T) {
+		tracker, source := newTestTracker(t)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 100; i++ {
+			job := newJob("train" + strconv.Itoa(i))
+			source.Add(job.DeepCopy())
+
+			wg.Add(1)
+			result := waitAsync(tracker.WaitForJobToBeDeleted, job)
+			go func() {
+				defer wg.Done()
+				source.Delete(job.DeepCopy())
+			}()
+			if err := <-result; err != nil {
+				t.Errorf("WaitForJobToBeDeleted(%s) error = %v, want nil", job.Name, err)
+			}
+		}
+		wg.Wait()
+	})
+}
+
+func TestWaitForJobToChange(t *testing.T) {
+	tracker, source := newTestTracker(t)
+	job := newJob("train")
+	source.Add(job.DeepCopy())
+
+	var seen *batchv1.Job
+	eventually(t, func() bool {
+		obj, exists, _ := tracker.indexer.GetByKey(testNamespace + "/train")
+		if exists {
+			seen = obj.(*batchv1.Job)
+		}
+		return exists
+	})
+
+	changeAsync := func(job *batchv1.Job) chan error {
+		return waitAsync(func(ctx context.Context, job *batchv1.Job) error {
+			changed, err := tracker.WaitForJobToChange(ctx, job)
+			if err == nil {
+				seen = changed
+			}
+			return err
+		}, job)
+	}
+
+	result := changeAsync(seen)
+	eventually(t, registered(tracker, job))
+	modified := job.DeepCopy()
+	modified.Status.CompletedIndexes = "0-1"
+	source.Modify(modified)
+
+	if err := <-result; err != nil {
+		t.Fatalf("WaitForJobToChange() error: %v", err)
+	}
+	if seen.Status.CompletedIndexes != "0-1" {
+		t.Errorf("completed indexes = %q, want %q", seen.Status.CompletedIndexes, "0-1")
+	}
+
+	result = changeAsync(seen)
+	eventually(t, registered(tracker, job))
+	source.Delete(seen.DeepCopy())
+	if err := <-result; err == nil {
+		t.Errorf("WaitForJobToChange() succeeded for a job deleted while waiting")
+	}
+}
@@ -0,0 +1,610 @@
+package train
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	traininkubev1alpha1 "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/apis/trainink8s/v1alpha1"
+	"github.com/ChinmayaSharma-hue/TrainInKubes/pkg/metrics"
+	"github.com/ChinmayaSharma-hue/TrainInKubes/pkg/resources"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// DefaultBackupPercentile is the percentile of the workers that have to finish
+// before backup workers are started, when the backup policy does not set one.
+const DefaultBackupPercentile int32 = 75
+
+// BackupGradient returns the index the backup copy of a worker writes its
+// gradients under, so that the two copies never write the same file.
+func BackupGradient(workers int, worker int) int {
+	return workers + worker
+}
+
+// WorkersJob returns the Indexed Job training a minibatch, with one pod per
+// worker. Each pod trains on the shard of its completion index, given in the
+// JOB_COMPLETION_INDEX variable, and writes the gradients under that index.
+func WorkersJob(
+	TrainInKube *traininkubev1alpha1.TrainInKube,
+	epoch int,
+	miniBatch int,
+	volume corev1.Volume,
+	volumeMount corev1.VolumeMount,
+	paths DataPaths,
+) *batchv1.Job {
+	return workerJob(TrainInKube, epoch, miniBatch, volume, volumeMount, paths,
+		TrainInKube.Name+"traimodel",
+		resources.CreateJobWithIndexedCompletions(int32(NumberOfWorkers(TrainInKube))),
+	)
+}
+
+// BackupWorkerJob returns the job training the shard of the given worker as a
+// backup. It runs a single pod, with JOB_COMPLETION_INDEX set to the worker it
+// stands in for, and GRADIENT_INDEX set to the index of its gradients.
+func BackupWorkerJob(
+	TrainInKube *traininkubev1alpha1.TrainInKube,
+	epoch int,
+	miniBatch int,
+	volume corev1.Volume,
+	volumeMount corev1.VolumeMount,
+	paths DataPaths,
+	worker int,
+) *batchv1.Job {
+	return workerJob(TrainInKube, epoch, miniBatch, volume, volumeMount, paths,
+		TrainInKube.Name+"traimodel"+strconv.Itoa(worker)+"backup",
+		resources.CreateJobWithEnv(map[string]string{
+			"JOB_COMPLETION_INDEX": strconv.Itoa(worker),
+			"GRADIENT_INDEX":       strconv.Itoa(BackupGradient(NumberOfWorkers(TrainInKube), worker)),
+		}),
+	)
+}
+
+func workerJob(
+	TrainInKube *traininkubev1alpha1.TrainInKube,
+	epoch int,
+	miniBatch int,
+	volume corev1.Volume,
+	volumeMount corev1.VolumeMount,
+	paths DataPaths,
+	name string,
+	option resources.CreateJobOption,
+) *batchv1.Job {
+	startingIndex, endingIndex := shardRange(TrainInKube, miniBatch)
+	envVariables := map[string]string{
+		"MODEL_LOCATION":    paths.Model,
+		"GRADIENT_LOCATION": paths.Gradients,
+		"SPLIT_LOCATION":    paths.Chunks,
+		"STARTING_INDEX":    strconv.Itoa(startingIndex),
+		"ENDING_INDEX":      strconv.Itoa(endingIndex),
+	}
+	if UsesParameterServer(TrainInKube) {
+		envVariables["PARAMETER_SERVER_URL"] = ParameterServerURL(TrainInKube)
+		envVariables["PARAMETER_SERVER_STEP"] = strconv.Itoa(parameterServerStep(TrainInKube, epoch, miniBatch))
+	}
+
+	return resources.CreateJob(
+		resources.CreateJobWithName(name),
+		resources.CreateJobInNamespace(TrainInKube.Namespace),
+		resources.CreateJobWithVolume(volume),
+		resources.CreateJobWithVolumeMounts(volumeMount),
+		resources.CreateJobWithEnv(envVariables),
+		option,
+		resources.CreateJobWithStage(TrainStage(TrainInKube)),
+		resources.CreateJobWithLabels(StepLabels(TrainInKube, StageTrain, epoch, miniBatch)),
+		resources.CreateJobWithOwnerReference(resources.CreateOwnerReference(TrainInKube)),
+	)
+}
+
+// workerShard keeps track of the shard of a worker during a minibatch.
+type workerShard struct {
+	finished bool
+	gradient int
+	// skipped is set when the shard was already finished when the current
+	// job of the workers was created.
+	skipped bool
+
+	backup        *batchv1.Job
+	backupRunning bool
+}
+
+// workersUpdate is a new version of the job of the workers of a retry, or the
+// error that stopped the watch on it.
+type workersUpdate struct {
+	retry int
+	job   *batchv1.Job
+	err   error
+}
+
+type backupResult struct {
+	shard int
+	err   error
+}
+
+// minibatchWorkers is the state of the workers of a minibatch, while
+// runWorkers waits for enough of them to finish.
+type minibatchWorkers struct {
+	t           *TrainOrchestrator
+	ctx         context.Context
+	retryPolicy traininkubev1alpha1.RetryPolicy
+	retries     int
+	// required is the number of workers that have to finish
+	required int
+	// backupRank is the number of workers that have to finish before the
+	// others count as slow, or 0 without backups
+	backupRank int
+
+	template *batchv1.Job
+	backups  []*batchv1.Job
+	shards   []workerShard
+	finished int
+
+	// current is the job of the workers of the latest retry
+	current *batchv1.Job
+	running bool
+	retry   int
+
+	durations []time.Duration
+	// threshold is the time after which a worker counts as slow, once known
+	threshold time.Duration
+
+	updates  chan workersUpdate
+	results  chan backupResult
+	restarts chan struct{}
+}
+
+// runWorkers creates the Indexed Job of the workers of a minibatch, and follows
+// its completed indexes until enough shards have their gradients. That is all
+// of them, unless the straggler policy of the run sets MinWorkers. With the
+// Backup policy, a backup job is started for the shards still running after
+// the percentile of the policy finished, and whichever copy finishes first
+// is kept.
+//
+// Failed pods are retried by the job itself, within its backoff limit. When the
+// job fails as a whole, it is run again as allowed by the retry policy of the
+// stage, with the shards that already have their gradients listed in the
+// COMPLETED_INDEXES variable, so that their pods exit right away.
+//
+// It returns all the jobs it created, which are left for the caller to delete,
+// along with the sorted indices of the gradients written by the workers that
+// finished.
+func (t *TrainOrchestrator) runWorkers(
+	ctx context.Context,
+	policy *traininkubev1alpha1.StragglerPolicy,
+	retryPolicy traininkubev1alpha1.RetryPolicy,
+	workers *batchv1.Job,
+	backups []*batchv1.Job,
+) ([]*batchv1.Job, []int, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w := t.newMinibatchWorkers(ctx, policy, retryPolicy, workers, backups)
+	if err := w.startAll(); err != nil {
+		return w.createdJobs(), nil, err
+	}
+
+	for w.finished < w.required {
+		wake, err := w.startBackups()
+		if err != nil {
+			return w.createdJobs(), nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-wake:
+		case <-w.restarts:
+			err = w.restart()
+		case result := <-w.results:
+			err = w.handleBackupResult(result)
+		case update := <-w.updates:
+			err = w.handleUpdate(update)
+		}
+		if err != nil {
+			return w.createdJobs(), nil, err
+		}
+	}
+
+	gradients, err := w.stopStragglers()
+	return w.createdJobs(), gradients, err
+}
+
+func (t *TrainOrchestrator) newMinibatchWorkers(
+	ctx context.Context,
+	policy *traininkubev1alpha1.StragglerPolicy,
+	retryPolicy traininkubev1alpha1.RetryPolicy,
+	workers *batchv1.Job,
+	backups []*batchv1.Job,
+) *minibatchWorkers {
+	n := len(backups)
+	w := &minibatchWorkers{
+		t:           t,
+		ctx:         ctx,
+		retryPolicy: retryPolicy,
+		required:    n,
+		template:    workers,
+		backups:     backups,
+		shards:      make([]workerShard, n),
+		threshold:   -1,
+		updates:     make(chan workersUpdate),
+		results:     make(chan backupResult),
+		restarts:    make(chan struct{}),
+	}
+
+	if retryPolicy.Retries != nil {
+		w.retries = int(*retryPolicy.Retries)
+	}
+	if policy != nil && policy.MinWorkers != nil && *policy.MinWorkers > 0 && int(*policy.MinWorkers) < n {
+		w.required = int(*policy.MinWorkers)
+	}
+	if policy != nil && policy.Backup != nil {
+		percentile := policy.Backup.Percentile
+		if percentile == 0 {
+			percentile = DefaultBackupPercentile
+		}
+		w.backupRank = (int(percentile)*n + 99) / 100
+		if w.backupRank > n-1 {
+			w.backupRank = n - 1
+		}
+	}
+	return w
+}
+
+// startAll starts the job of the workers, along with the backups started
+// before the operator restarted.
+func (w *minibatchWorkers) startAll() error {
+	if err := w.startWorkers(); err != nil {
+		return err
+	}
+	if w.backupRank == 0 {
+		return nil
+	}
+	for k, backup := range w.backups {
+		exists, err := w.t.jobExists(backup)
+		if err != nil {
+			return err
+		}
+		if exists {
+			if err := w.startBackup(k); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// startWorkers creates the job of the workers for the current retry, or adopts
+// it when it exists, and follows its changes in the background.
+func (w *minibatchWorkers) startWorkers() error {
+	var completed []int
+	for k := range w.shards {
+		w.shards[k].skipped = w.shards[k].finished
+		if w.shards[k].finished {
+			completed = append(completed, k)
+		}
+	}
+	job := withAttempt(w.template, w.retry)
+	if len(completed) > 0 {
+		job = withEnv(job, "COMPLETED_INDEXES", formatIndexes(completed))
+	}
+
+	created, err := w.t.ensureJob(w.ctx, job)
+	if err != nil {
+		return err
+	}
+	// Jobs adopted after a restart may come from a later retry
+	if attempt := jobAttempt(created); attempt > w.retry {
+		w.retry = attempt
+	}
+	w.current = created
+	w.running = true
+
+	go w.watchWorkers(w.retry, created)
+	return nil
+}
+
+// watchWorkers sends every version of the job of the workers, until it
+// finished.
+func (w *minibatchWorkers) watchWorkers(retry int, job *batchv1.Job) {
+	for {
+		select {
+		case w.updates <- workersUpdate{retry: retry, job: job}:
+		case <-w.ctx.Done():
+			return
+		}
+		if done, _ := jobResult(job); done {
+			return
+		}
+		next, err := w.t.JobTracker.WaitForJobToChange(w.ctx, job)
+		if err != nil {
+			select {
+			case w.updates <- workersUpdate{retry: retry, err: err}:
+			case <-w.ctx.Done():
+			}
+			return
+		}
+		job = next
+	}
+}
+
+// startBackup creates the backup job of the shard, or adopts it when it
+// exists, and waits for it in the background.
+func (w *minibatchWorkers) startBackup(k int) error {
+	created, err := w.t.ensureJob(w.ctx, w.backups[k])
+	if err != nil {
+		return err
+	}
+	w.shards[k].backup = created
+	w.shards[k].backupRunning = true
+
+	go func() {
+		err := w.t.JobTracker.WaitForJobToFinish(w.ctx, created)
+		select {
+		case w.results <- backupResult{shard: k, err: err}:
+		case <-w.ctx.Done():
+		}
+	}()
+	return nil
+}
+
+// startBackups starts a backup of the shards running for longer than the
+// slowest of the shards within the percentile took. It returns a channel that
+// fires when they become slow, if they are not yet.
+func (w *minibatchWorkers) startBackups() (<-chan time.Time, error) {
+	if w.threshold < 0 || !w.running {
+		return nil, nil
+	}
+	if remaining := w.threshold - time.Since(w.current.CreationTimestamp.Time); remaining > 0 {
+		return time.After(remaining), nil
+	}
+
+	for k := range w.shards {
+		if w.shards[k].finished || w.shards[k].backup != nil {
+			continue
+		}
+		if err := w.startBackup(k); err != nil {
+			return nil, err
+		}
+		metrics.StragglerWorkers.WithLabelValues("backup").Inc()
+		w.t.event(corev1.EventTypeNormal, ReasonBackupWorker, "Worker %d of job %s is slower than %s, started job %s as a backup",
+			k, w.current.Name, w.threshold.Round(time.Second), w.shards[k].backup.Name)
+	}
+	return nil, nil
+}
+
+// finish records the gradients of the shard, from whichever copy of its worker
+// finished first.
+func (w *minibatchWorkers) finish(k int, gradient int) {
+	w.shards[k].finished = true
+	w.shards[k].gradient = gradient
+	w.finished++
+}
+
+// handleBackupResult records that the backup of a shard finished. A backup that
+// failed is not retried, the shard is left to the job of the workers.
+func (w *minibatchWorkers) handleBackupResult(result backupResult) error {
+	shard := &w.shards[result.shard]
+	shard.backupRunning = false
+	if shard.finished {
+		return nil
+	}
+	if result.err == nil {
+		w.t.Logger.Infof("Backup job %s finished before worker %d of job %s", shard.backup.Name, result.shard, w.current.Name)
+		w.finish(result.shard, BackupGradient(len(w.shards), result.shard))
+		return nil
+	}
+
+	var jobErr *JobFailedError
+	if !errors.As(result.err, &jobErr) {
+		return result.err
+	}
+	w.t.Logger.Infof("Backup job %s failed, waiting for worker %d of job %s: %v", shard.backup.Name, result.shard, w.current.Name, jobErr)
+	return nil
+}
+
+// handleUpdate records the shards newly completed by the job of the workers,
+// and retries the job once it failed.
+func (w *minibatchWorkers) handleUpdate(update workersUpdate) error {
+	// Updates of the jobs of earlier retries are left over
+	if update.retry != w.retry || !w.running {
+		return nil
+	}
+
+	jobErr := &JobFailedError{}
+	if update.err != nil {
+		if !errors.As(update.err, &jobErr) {
+			return update.err
+		}
+		w.running = false
+		return w.fail(jobErr)
+	}
+
+	completed, err := parseIndexes(update.job.Status.CompletedIndexes, len(w.shards))
+	if err != nil {
+		return fmt.Errorf("Error while reading the completed indexes of the Job %s: %v", update.job.Name, err)
+	}
+	for _, k := range completed {
+		if w.shards[k].finished {
+			continue
+		}
+		w.finish(k, k)
+		if !w.shards[k].skipped {
+			w.durations = append(w.durations, time.Since(update.job.CreationTimestamp.Time))
+		}
+	}
+	// The slowest of the shards within the percentile sets when the others
+	// count as slow
+	if w.threshold < 0 && w.backupRank > 0 && len(w.durations) >= w.backupRank {
+		sort.Slice(w.durations, func(i, j int) bool { return w.durations[i] < w.durations[j] })
+		w.threshold = w.durations[w.backupRank-1]
+	}
+
+	done, failure := jobResult(update.job)
+	if !done {
+		return nil
+	}
+	w.running = false
+	if failure == nil {
+		return nil
+	}
+	if !errors.As(failure, &jobErr) {
+		return failure
+	}
+	return w.fail(jobErr)
+}
+
+// fail runs the job of the workers again after its backoff, for the shards
+// that do not have their gradients yet. Nothing is retried once enough shards
+// have them.
+func (w *minibatchWorkers) fail(jobErr *JobFailedError) error {
+	if w.finished >= w.required {
+		return nil
+	}
+	if jobErr.Fatal() || w.retry >= w.retries {
+		if !jobErr.Fatal() {
+			jobErr = jobErr.givingUp(w.retries)
+		}
+		return jobErr
+	}
+
+	n := len(w.shards)
+	delay := retryBackoff(w.retryPolicy, w.retry)
+	w.t.Logger.Infof("Job %s failed with %d of %d workers finished, retrying the others in %s: %v", w.current.Name, w.finished, n, delay, jobErr)
+	w.t.event(corev1.EventTypeWarning, ReasonRetryingJobs, "Running the %d unfinished workers of job %s again in %s, retry %d of %d: %v",
+		n-w.finished, w.current.Name, delay, w.retry+1, w.retries, jobErr)
+
+	go func() {
+		select {
+		case <-time.After(delay):
+		case <-w.ctx.Done():
+			return
+		}
+		select {
+		case w.restarts <- struct{}{}:
+		case <-w.ctx.Done():
+		}
+	}()
+	return nil
+}
+
+// restart runs the job of the workers again, once its backoff is over.
+func (w *minibatchWorkers) restart() error {
+	err := w.t.deleteJobs(w.ctx, w.current)
+	if err != nil {
+		return err
+	}
+	w.retry++
+	return w.startWorkers()
+}
+
+// stopStragglers stops the workers still running, which are not needed
+// anymore, right away so that they free their nodes. It returns the sorted
+// indices of the gradients of the workers that finished.
+func (w *minibatchWorkers) stopStragglers() ([]int, error) {
+	var stopped []int
+	var gradients []int
+	for k := range w.shards {
+		shard := &w.shards[k]
+		if shard.finished {
+			gradients = append(gradients, shard.gradient)
+		} else {
+			stopped = append(stopped, k)
+		}
+		if shard.backupRunning {
+			if err := w.t.deleteJob(w.ctx, shard.backup); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if w.running {
+		if err := w.t.deleteJob(w.ctx, w.current); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(stopped) > 0 {
+		metrics.StragglerWorkers.WithLabelValues("stopped").Add(float64(len(stopped)))
+		w.t.event(corev1.EventTypeNormal, ReasonStragglersStopped, "%d of %d workers finished, stopped the workers %v of job %s",
+			w.finished, len(w.shards), stopped, w.current.Name)
+	}
+	sort.Ints(gradients)
+	return gradients, nil
+}
+
+// createdJobs returns the job of the workers and the backup jobs created.
+func (w *minibatchWorkers) createdJobs() []*batchv1.Job {
+	var jobs []*batchv1.Job
+	if w.current != nil {
+		jobs = append(jobs, w.current)
+	}
+	for _, shard := range w.shards {
+		if shard.backup != nil {
+			jobs = append(jobs, shard.backup)
+		}
+	}
+	return jobs
+}
+
+// withEnv returns a copy of the job with the variable set in its container.
+func withEnv(job *batchv1.Job, name string, value string) *batchv1.Job {
+	job = job.DeepCopy()
+	containers := job.Spec.Template.Spec.Containers
+	for i := range containers {
+		containers[i].Env = append(containers[i].Env, corev1.EnvVar{Name: name, Value: value})
+	}
+	return job
+}
+
+// parseIndexes reads the completed indexes of an Indexed Job, written as a
+// comma separated list of indexes and ranges such as "1,3-5,7".
+func parseIndexes(value string, completions int) ([]int, error) {
+	var indexes []int
+	if value == "" {
+		return indexes, nil
+	}
+	for _, part := range strings.Split(value, ",") {
+		first, last, isRange := strings.Cut(part, "-")
+		from, err := strconv.Atoi(first)
+		if err != nil {
+			return nil, err
+		}
+		to := from
+		if isRange {
+			to, err = strconv.Atoi(last)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if from < 0 || to < from || to >= completions {
+			return nil, fmt.Errorf("index out of range in %q", value)
+		}
+		for i := from; i <= to; i++ {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes, nil
+}
+
+// formatIndexes writes the sorted indexes like the completed indexes of an
+// Indexed Job.
+func formatIndexes(indexes []int) string {
+	var parts []string
+	for i := 0; i < len(indexes); {
+		j := i
+		for j+1 < len(indexes) && indexes[j+1] == indexes[j]+1 {
+			j++
+		}
+		if i == j {
+			parts = append(parts, strconv.Itoa(indexes[i]))
+		} else {
+			parts = append(parts, strconv.Itoa(indexes[i])+"-"+strconv.Itoa(indexes[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,263 @@
+package train
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	traininkubev1alpha1 "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/apis/trainink8s/v1alpha1"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// deletedJobs returns the sorted names of the jobs deleted through the fake
+// clientset of the orchestrator.
+func deletedJobs(orchestrator *TrainOrchestrator) []string {
+	var names []string
+	for _, action := range orchestrator.KubeClientSet.(*kubefake.Clientset).Actions() {
+		if action.GetVerb() == "delete" && action.GetResource().Resource == "jobs" {
+			names = append(names, action.(k8stesting.DeleteAction).GetName())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestRunWorkers(t *testing.T) {
+	tests := []struct {
+		name    string
+		workers int
+		policy  *traininkubev1alpha1.StragglerPolicy
+		// outcomes of the workers and backups by name, the others complete
+		outcomes map[string]batchv1.JobCondition
+		// completed indexes of the job of the workers by attempt, all of
+		// them when unset
+		completedIndexes []string
+		wantGradients    []int
+		wantStopped      []string
+		wantCreated      int
+		wantErr          bool
+	}{
+		{
+			name:          "all workers",
+			workers:       3,
+			wantGradients: []int{0, 1, 2},
+			wantCreated:   1,
+		},
+		{
+			name:             "k of n",
+			workers:          3,
+			policy:           &traininkubev1alpha1.StragglerPolicy{MinWorkers: int32Ptr(2)},
+			outcomes:         map[string]batchv1.JobCondition{"mnisttraimodel": {}},
+			completedIndexes: []string{"0,1"},
+			wantGradients:    []int{0, 1},
+			wantStopped:      []string{"mnisttraimodel"},
+			wantCreated:      1,
+		},
+		{
+			name:             "k of n going on after the job failed",
+			workers:          3,
+			policy:           &traininkubev1alpha1.StragglerPolicy{MinWorkers: int32Ptr(2)},
+			outcomes:         map[string]batchv1.JobCondition{"mnisttraimodel": failed("BackoffLimitExceeded")},
+			completedIndexes: []string{"0,2"},
+			wantGradients:    []int{0, 2},
+			wantCreated:      1,
+		},
+		{
+			name:             "fatal failure",
+			workers:          3,
+			policy:           &traininkubev1alpha1.StragglerPolicy{MinWorkers: int32Ptr(2)},
+			outcomes:         map[string]batchv1.JobCondition{"mnisttraimodel": failed(podFailurePolicyReason)},
+			completedIndexes: []string{"0"},
+			wantErr:          true,
+		},
+		{
+			name:    "backup",
+			workers: 4,
+			policy: &traininkubev1alpha1.StragglerPolicy{
+				Backup: &traininkubev1alpha1.BackupWorkersPolicy{Percentile: 50},
+			},
+			outcomes:         map[string]batchv1.JobCondition{"mnisttraimodel": {}},
+			completedIndexes: []string{"0-1"},
+			wantGradients:    []int{0, 1, BackupGradient(4, 2), BackupGradient(4, 3)},
+			wantStopped:      []string{"mnisttraimodel"},
+			wantCreated:      1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outcomes := &jobOutcomes{
+				created: make(map[string]int),
+				outcome: func(name string, attempt int) batchv1.JobCondition {
+					if condition, ok := tt.outcomes[name]; ok {
+						return condition
+					}
+					return complete()
+				},
+				completedIndexes: func(name string, attempt int) string {
+					if name != "mnisttraimodel" {
+						return ""
+					}
+					if attempt <= len(tt.completedIndexes) {
+						return tt.completedIndexes[attempt-1]
+					}
+					return formatIndexes(allIndexes(tt.workers))
+				},
+			}
+			orchestrator := newRunningOrchestrator(t, outcomes)
+			workers, backups := newWorkerJobs(tt.workers)
+			retryPolicy := traininkubev1alpha1.RetryPolicy{
+				Retries: int32Ptr(0),
+				Backoff: &metav1.Duration{Duration: time.Millisecond},
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+			defer cancel()
+			_, gradients, err := orchestrator.runWorkers(ctx, tt.policy, retryPolicy, workers, backups)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("runWorkers() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if !reflect.DeepEqual(gradients, tt.wantGradients) {
+				t.Errorf("gradients = %v, want %v", gradients, tt.wantGradients)
+			}
+			if got := deletedJobs(orchestrator); !reflect.DeepEqual(got, tt.wantStopped) {
+				t.Errorf("stopped jobs = %v, want %v", got, tt.wantStopped)
+			}
+			if got := outcomes.count(workers.Name); got != tt.wantCreated {
+				t.Errorf("%s was created %d times, want %d", workers.Name, got, tt.wantCreated)
+			}
+		})
+	}
+}
+
+// TestRunWorkersRetriesUnfinishedShards fails the job of the workers once, with
+// the first shard done, and checks that the retry skips it.
+func TestRunWorkersRetriesUnfinishedShards(t *testing.T) {
+	outcomes := &jobOutcomes{
+		created: make(map[string]int),
+		outcome: func(name string, attempt int) batchv1.JobCondition {
+			if attempt == 1 {
+				return failed("BackoffLimitExceeded")
+			}
+			return complete()
+		},
+		completedIndexes: func(name string, attempt int) string {
+			if attempt == 1 {
+				return "0"
+			}
+			return "0-2"
+		},
+	}
+	orchestrator := newRunningOrchestrator(t, outcomes)
+	workers, backups := newWorkerJobs(3)
+	retryPolicy := traininkubev1alpha1.RetryPolicy{
+		Retries: int32Ptr(1),
+		Backoff: &metav1.Duration{Duration: time.Millisecond},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	_, gradients, err := orchestrator.runWorkers(ctx, nil, retryPolicy, workers, backups)
+	if err != nil {
+		t.Fatalf("runWorkers() error: %v", err)
+	}
+	if want := []int{0, 1, 2}; !reflect.DeepEqual(gradients, want) {
+		t.Errorf("gradients = %v, want %v", gradients, want)
+	}
+
+	created := outcomes.createdJobs()
+	if len(created) != 2 {
+		t.Fatalf("created %d jobs, want 2", len(created))
+	}
+	if got := jobEnv(created[0], "COMPLETED_INDEXES"); got != "" {
+		t.Errorf("COMPLETED_INDEXES of the first job = %q, want none", got)
+	}
+	if got := jobEnv(created[1], "COMPLETED_INDEXES"); got != "0" {
+		t.Errorf("COMPLETED_INDEXES of the retry = %q, want %q", got, "0")
+	}
+	if got := created[1].Labels[AttemptLabel]; got != "1" {
+		t.Errorf("attempt of the retry = %q, want %q", got, "1")
+	}
+}
+
+func TestParseIndexes(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []int
+		wantErr bool
+	}{
+		{value: "", want: nil},
+		{value: "3", want: []int{3}},
+		{value: "0-2,5", want: []int{0, 1, 2, 5}},
+		{value: "1,3-5,7", want: []int{1, 3, 4, 5, 7}},
+		{value: "8", wantErr: true},
+		{value: "6-8", wantErr: true},
+		{value: "3-1", wantErr: true},
+		{value: "-1", wantErr: true},
+		{value: "one", wantErr: true},
+		{value: "1-", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseIndexes(tt.value, 8)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseIndexes(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseIndexes(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatIndexes(t *testing.T) {
+	tests := []struct {
+		indexes []int
+		want    string
+	}{
+		{indexes: nil, want: ""},
+		{indexes: []int{3}, want: "3"},
+		{indexes: []int{0, 1, 2, 5}, want: "0-2,5"},
+		{indexes: []int{1, 3, 4, 5, 7}, want: "1,3-5,7"},
+	}
+	for _, tt := range tests {
+		got := formatIndexes(tt.indexes)
+		if got != tt.want {
+			t.Errorf("formatIndexes(%v) = %q, want %q", tt.indexes, got, tt.want)
+		}
+		if parsed, err := parseIndexes(got, 8); err != nil || len(parsed) != len(tt.indexes) {
+			t.Errorf("parseIndexes(%q) = %v, %v, want %v", got, parsed, err, tt.indexes)
+		}
+	}
+}
+
+// newWorkerJobs returns the job of the given number of workers, with a
+// container to set the variables of its retries on, and their backups.
+func newWorkerJobs(n int) (*batchv1.Job, []*batchv1.Job) {
+	workers := newJob("mnisttraimodel")
+	workers.Spec.Template.Spec.Containers = []corev1.Container{{Name: "worker"}}
+	backups := make([]*batchv1.Job, n)
+	for k := range backups {
+		backups[k] = newJob(workers.Name + strconv.Itoa(k) + "backup")
+	}
+	return workers, backups
+}
+
+func allIndexes(n int) []int {
+	indexes := make([]int, n)
+	for i := range indexes {
+		indexes[i] = i
+	}
+	return indexes
+}
@@ -0,0 +1,106 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	traininkubev1alpha1 "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/apis/trainink8s/v1alpha1"
+	traininkubev1beta1 "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/apis/trainink8s/v1beta1"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// serveConvert handles the ConversionReviews sent by the API server to convert
+// TrainInKubes between v1alpha1 and the v1beta1 storage version.
+func (s *Server) serveConvert(w http.ResponseWriter, r *http.Request) {
+	body, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+
+	review := apiextensionsv1.ConversionReview{}
+	err := json.Unmarshal(body, &review)
+	if err != nil || review.Request == nil {
+		http.Error(w, "the request is not a ConversionReview", http.StatusBadRequest)
+		return
+	}
+
+	review.Response = s.convert(review.Request)
+	review.Request = nil
+
+	s.writeJSON(w, &review)
+}
+
+func (s *Server) convert(request *apiextensionsv1.ConversionRequest) *apiextensionsv1.ConversionResponse {
+	response := &apiextensionsv1.ConversionResponse{
+		UID:              request.UID,
+		ConvertedObjects: make([]runtime.RawExtension, 0, len(request.Objects)),
+	}
+
+	for _, object := range request.Objects {
+		converted, err := ConvertTrainInKube(object.Raw, request.DesiredAPIVersion)
+		if err != nil {
+			s.logger.Errorf("Error while converting a TrainInKube to %s: %v", request.DesiredAPIVersion, err)
+			response.ConvertedObjects = nil
+			response.Result = metav1.Status{
+				Status:  metav1.StatusFailure,
+				Message: err.Error(),
+			}
+			return response
+		}
+		response.ConvertedObjects = append(response.ConvertedObjects, runtime.RawExtension{Raw: converted})
+	}
+
+	response.Result = metav1.Status{Status: metav1.StatusSuccess}
+	return response
+}
+
+// ConvertTrainInKube converts a TrainInKube encoded as JSON to the desired API
+// version. Conversions go through v1beta1, which holds every field of v1alpha1,
+// so objects round-trip without losing data.
+func ConvertTrainInKube(raw []byte, desiredAPIVersion string) ([]byte, error) {
+	typeMeta := metav1.TypeMeta{}
+	err := json.Unmarshal(raw, &typeMeta)
+	if err != nil {
+		return nil, fmt.Errorf("error while decoding the object: %v", err)
+	}
+	if typeMeta.Kind != "TrainInKube" {
+		return nil, fmt.Errorf("unsupported kind %q", typeMeta.Kind)
+	}
+	if typeMeta.APIVersion == desiredAPIVersion {
+		return raw, nil
+	}
+
+	hub := &traininkubev1beta1.TrainInKube{}
+	switch typeMeta.APIVersion {
+	case traininkubev1alpha1.SchemeGroupVersion.String():
+		trainInKube := &traininkubev1alpha1.TrainInKube{}
+		err = json.Unmarshal(raw, trainInKube)
+		trainInKube.ConvertTo(hub)
+	case traininkubev1beta1.SchemeGroupVersion.String():
+		err = json.Unmarshal(raw, hub)
+	default:
+		return nil, fmt.Errorf("unsupported API version %q", typeMeta.APIVersion)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error while decoding the %s TrainInKube: %v", typeMeta.APIVersion, err)
+	}
+
+	var converted interface{}
+	switch desiredAPIVersion {
+	case traininkubev1alpha1.SchemeGroupVersion.String():
+		trainInKube := &traininkubev1alpha1.TrainInKube{}
+		trainInKube.ConvertFrom(hub)
+		converted = trainInKube
+	case traininkubev1beta1.SchemeGroupVersion.String():
+		hub.APIVersion = desiredAPIVersion
+		converted = hub
+	default:
+		return nil, fmt.Errorf("unsupported API version %q", desiredAPIVersion)
+	}
+
+	return json.Marshal(converted)
+}
@@ -0,0 +1,169 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+
+	traininkubev1alpha1 "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/apis/trainink8s/v1alpha1"
+	"github.com/ChinmayaSharma-hue/TrainInKubes/pkg/train"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// AppliedDefaultsAnnotation records the fields set by the defaulting webhook,
+// as a JSON object from field path to the value that was applied.
+const AppliedDefaultsAnnotation = "trainink8s.com/applied-defaults"
+
+// Defaults are the values the defaulting webhook fills in for the fields a
+// TrainInKube leaves empty on creation.
+type Defaults struct {
+	Workers         int
+	ImagePullPolicy string
+
+	BuildImage     string
+	SplitImage     string
+	TrainImage     string
+	AggregateImage string
+
+	// ParameterServerImage is applied to the parameter server of the runs that
+	// deploy one.
+	ParameterServerImage string
+
+	Storage                  traininkubev1alpha1.StorageSpec
+	PreprocessedDataLocation string
+	SplitDatasetLocation     string
+
+	// Resources are applied to the stages that do not set any resources.
+	Resources corev1.ResourceRequirements
+
+	// WorkerRetries is the number of times the failed workers of a
+	// minibatch are run again.
+	WorkerRetries int32
+}
+
+// NewDefaults returns the defaults the operator uses when it is not configured
+// otherwise, which match what the orchestrator falls back to, including the
+// stage images the operator is currently configured with.
+func NewDefaults() Defaults {
+	images := train.DefaultImages()
+	return Defaults{
+		Workers:              train.DefaultWorkers,
+		ImagePullPolicy:      string(corev1.PullIfNotPresent),
+		BuildImage:           images.Build,
+		SplitImage:           images.Split,
+		TrainImage:           images.Train,
+		AggregateImage:       images.Aggregate,
+		ParameterServerImage: images.ParameterServer,
+		Storage: traininkubev1alpha1.StorageSpec{
+			HostPath: &corev1.HostPathVolumeSource{Path: train.DataMountPath},
+		},
+		PreprocessedDataLocation: train.DefaultPreprocessedDataLocation,
+		SplitDatasetLocation:     train.DefaultSplitDatasetLocation,
+		WorkerRetries:            train.DefaultWorkerRetries,
+	}
+}
+
+// SetDefaults fills the empty fields of the TrainInKube spec and returns the
+// values that were applied, keyed by field path.
+func (d Defaults) SetDefaults(TrainInKube *traininkubev1alpha1.TrainInKube) map[string]interface{} {
+	applied := map[string]interface{}{}
+	spec := &TrainInKube.Spec
+
+	if spec.Workers == 0 && d.Workers > 0 {
+		spec.Workers = d.Workers
+		applied["spec.workers"] = d.Workers
+	}
+	if spec.ModelImagePullPolicy == "" && d.ImagePullPolicy != "" {
+		spec.ModelImagePullPolicy = d.ImagePullPolicy
+		applied["spec.modelImagePullPolicy"] = d.ImagePullPolicy
+	}
+
+	buildImage := d.BuildImage
+	if spec.ModelImage != "" {
+		buildImage = spec.ModelImage
+	}
+	for _, stage := range []struct {
+		name  string
+		spec  *traininkubev1alpha1.StageSpec
+		image string
+	}{
+		{"build", &spec.Stages.Build, buildImage},
+		{"split", &spec.Stages.Split, d.SplitImage},
+		{"train", &spec.Stages.Train, d.TrainImage},
+		{"aggregate", &spec.Stages.Aggregate, d.AggregateImage},
+	} {
+		path := "spec.stages." + stage.name
+		if stage.spec.Image == "" && stage.image != "" {
+			stage.spec.Image = stage.image
+			applied[path+".image"] = stage.image
+		}
+		if stage.spec.ImagePullPolicy == "" && spec.ModelImagePullPolicy != "" {
+			stage.spec.ImagePullPolicy = spec.ModelImagePullPolicy
+			applied[path+".imagePullPolicy"] = spec.ModelImagePullPolicy
+		}
+		if isEmptyResources(stage.spec.Resources) && !isEmptyResources(d.Resources) {
+			stage.spec.Resources = *d.Resources.DeepCopy()
+			applied[path+".resources"] = d.Resources
+		}
+	}
+
+	if spec.Stages.Train.RetryPolicy.Retries == nil {
+		retries := d.WorkerRetries
+		spec.Stages.Train.RetryPolicy.Retries = &retries
+		applied["spec.stages.train.retryPolicy.retries"] = retries
+	}
+
+	if policy := spec.StragglerPolicy; policy != nil && policy.Backup != nil && policy.Backup.Percentile == 0 {
+		policy.Backup.Percentile = train.DefaultBackupPercentile
+		applied["spec.stragglerPolicy.backup.percentile"] = train.DefaultBackupPercentile
+	}
+
+	if server := spec.ParameterServer; server != nil {
+		if server.Image == "" && d.ParameterServerImage != "" {
+			server.Image = d.ParameterServerImage
+			applied["spec.parameterServer.image"] = d.ParameterServerImage
+		}
+		if server.ImagePullPolicy == "" && spec.ModelImagePullPolicy != "" {
+			server.ImagePullPolicy = spec.ModelImagePullPolicy
+			applied["spec.parameterServer.imagePullPolicy"] = spec.ModelImagePullPolicy
+		}
+		if server.LearningRate == "" {
+			server.LearningRate = train.DefaultLearningRate
+			applied["spec.parameterServer.learningRate"] = train.DefaultLearningRate
+		}
+	}
+
+	if spec.Storage == (traininkubev1alpha1.StorageSpec{}) && d.Storage != (traininkubev1alpha1.StorageSpec{}) {
+		spec.Storage = *d.Storage.DeepCopy()
+		applied["spec.storage"] = d.Storage
+	}
+	if spec.PreprocessedDataLocation == "" && d.PreprocessedDataLocation != "" {
+		spec.PreprocessedDataLocation = d.PreprocessedDataLocation
+		applied["spec.preprocessedDatasetLocation"] = d.PreprocessedDataLocation
+	}
+	if spec.SplitDatasetLocation == "" && d.SplitDatasetLocation != "" {
+		spec.SplitDatasetLocation = d.SplitDatasetLocation
+		applied["spec.splitDatasetLocation"] = d.SplitDatasetLocation
+	}
+
+	return applied
+}
+
+// annotateDefaults records the applied defaults in the annotations of the
+// TrainInKube.
+func annotateDefaults(TrainInKube *traininkubev1alpha1.TrainInKube, applied map[string]interface{}) error {
+	value, err := json.Marshal(applied)
+	if err != nil {
+		return fmt.Errorf("error while encoding the applied defaults: %v", err)
+	}
+
+	if TrainInKube.Annotations == nil {
+		TrainInKube.Annotations = map[string]string{}
+	}
+	TrainInKube.Annotations[AppliedDefaultsAnnotation] = string(value)
+	return nil
+}
+
+func isEmptyResources(resources corev1.ResourceRequirements) bool {
+	return len(resources.Requests) == 0 && len(resources.Limits) == 0
+}
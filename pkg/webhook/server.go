@@ -0,0 +1,250 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	traininkubev1alpha1 "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/apis/trainink8s/v1alpha1"
+	"github.com/gotway/gotway/pkg/log"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// Paths the webhooks for TrainInKubes are served on.
+const (
+	ValidatePath = "/validate-trainink8s-com-v1alpha1-traininkube"
+	DefaultPath  = "/mutate-trainink8s-com-v1alpha1-traininkube"
+	ConvertPath  = "/convert"
+)
+
+// Server serves the admission webhooks of the operator over HTTPS.
+type Server struct {
+	addr     string
+	certFile string
+	keyFile  string
+
+	defaults     Defaults
+	defaultsLock sync.RWMutex
+
+	logger log.Logger
+}
+
+// jsonPatchOperation is an operation of the JSON patch returned by the
+// defaulting webhook.
+type jsonPatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+func New(addr string, certFile string, keyFile string, defaults Defaults, logger log.Logger) *Server {
+	return &Server{
+		addr:     addr,
+		certFile: certFile,
+		keyFile:  keyFile,
+		defaults: defaults,
+		logger:   logger,
+	}
+}
+
+// UpdateDefaults replaces the defaults applied to the TrainInKubes created from
+// now on.
+func (s *Server) UpdateDefaults(defaults Defaults) {
+	s.defaultsLock.Lock()
+	defer s.defaultsLock.Unlock()
+
+	s.defaults = defaults
+}
+
+// Handler returns the handler serving all the webhooks, so that it can also be
+// mounted on a test server.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(ValidatePath, s.serveValidate)
+	mux.HandleFunc(DefaultPath, s.serveDefault)
+	mux.HandleFunc(ConvertPath, s.serveConvert)
+	return mux
+}
+
+// Run serves the webhooks until the context is cancelled.
+func (s *Server) Run(ctx context.Context) error {
+	server := &http.Server{
+		Addr:              s.addr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			s.logger.Errorf("Error while shutting down the webhook server: %v", err)
+		}
+	}()
+
+	s.logger.Infof("Starting the webhook server on %s", s.addr)
+	err := server.ListenAndServeTLS(s.certFile, s.keyFile)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) serveValidate(w http.ResponseWriter, r *http.Request) {
+	s.serve(w, r, s.validate)
+}
+
+func (s *Server) serveDefault(w http.ResponseWriter, r *http.Request) {
+	s.serve(w, r, s.setDefaults)
+}
+
+// serve decodes the AdmissionReview of the request, and writes back the
+// response of the admit function for it.
+func (s *Server) serve(
+	w http.ResponseWriter,
+	r *http.Request,
+	admit func(*admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse,
+) {
+	body, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+
+	review := admissionv1.AdmissionReview{}
+	err := json.Unmarshal(body, &review)
+	if err != nil || review.Request == nil {
+		http.Error(w, "the request is not an AdmissionReview", http.StatusBadRequest)
+		return
+	}
+
+	response := admit(review.Request)
+	response.UID = review.Request.UID
+	review.Response = response
+	review.Request = nil
+
+	s.writeJSON(w, &review)
+}
+
+// readBody reads the body of a webhook request, and writes back an error when
+// the request is not a JSON POST.
+func readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return nil, false
+	}
+	if contentType := r.Header.Get("Content-Type"); contentType != "application/json" {
+		http.Error(w, fmt.Sprintf("unsupported content type %q", contentType), http.StatusUnsupportedMediaType)
+		return nil, false
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error while reading the request: %v", err), http.StatusBadRequest)
+		return nil, false
+	}
+	return body, true
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		s.logger.Errorf("Error while writing the webhook response: %v", err)
+	}
+}
+
+func (s *Server) validate(request *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	trainInKube := &traininkubev1alpha1.TrainInKube{}
+	err := json.Unmarshal(request.Object.Raw, trainInKube)
+	if err != nil {
+		return errorResponse(http.StatusBadRequest, fmt.Errorf("error while decoding the TrainInKube: %v", err))
+	}
+
+	var errs field.ErrorList
+	switch request.Operation {
+	case admissionv1.Create:
+		errs = ValidateTrainInKube(trainInKube)
+	case admissionv1.Update:
+		old := &traininkubev1alpha1.TrainInKube{}
+		err := json.Unmarshal(request.OldObject.Raw, old)
+		if err != nil {
+			return errorResponse(http.StatusBadRequest, fmt.Errorf("error while decoding the old TrainInKube: %v", err))
+		}
+		errs = ValidateTrainInKubeUpdate(old, trainInKube)
+	}
+
+	if len(errs) > 0 {
+		s.logger.Infof("Rejecting TrainInKube %s/%s: %v", request.Namespace, request.Name, errs.ToAggregate())
+		invalid := apierrors.NewInvalid(traininkubev1alpha1.Kind("TrainInKube"), trainInKube.Name, errs)
+		return &admissionv1.AdmissionResponse{
+			Allowed: false,
+			Result:  &invalid.ErrStatus,
+		}
+	}
+
+	return &admissionv1.AdmissionResponse{Allowed: true}
+}
+
+// setDefaults fills in the empty fields of new TrainInKubes, and records the
+// values it applied in an annotation.
+func (s *Server) setDefaults(request *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	if request.Operation != admissionv1.Create {
+		return &admissionv1.AdmissionResponse{Allowed: true}
+	}
+
+	trainInKube := &traininkubev1alpha1.TrainInKube{}
+	err := json.Unmarshal(request.Object.Raw, trainInKube)
+	if err != nil {
+		return errorResponse(http.StatusBadRequest, fmt.Errorf("error while decoding the TrainInKube: %v", err))
+	}
+
+	s.defaultsLock.RLock()
+	defaults := s.defaults
+	s.defaultsLock.RUnlock()
+
+	applied := defaults.SetDefaults(trainInKube)
+	if len(applied) == 0 {
+		return &admissionv1.AdmissionResponse{Allowed: true}
+	}
+
+	err = annotateDefaults(trainInKube, applied)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, err)
+	}
+
+	patch, err := json.Marshal([]jsonPatchOperation{
+		{Op: "add", Path: "/spec", Value: trainInKube.Spec},
+		{Op: "add", Path: "/metadata/annotations", Value: trainInKube.Annotations},
+	})
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Errorf("error while encoding the patch: %v", err))
+	}
+
+	patchType := admissionv1.PatchTypeJSONPatch
+	return &admissionv1.AdmissionResponse{
+		Allowed:   true,
+		Patch:     patch,
+		PatchType: &patchType,
+	}
+}
+
+func errorResponse(code int32, err error) *admissionv1.AdmissionResponse {
+	return &admissionv1.AdmissionResponse{
+		Allowed: false,
+		Result: &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Code:    code,
+			Message: err.Error(),
+		},
+	}
+}
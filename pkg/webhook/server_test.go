@@ -0,0 +1,355 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	traininkubev1alpha1 "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/apis/trainink8s/v1alpha1"
+	traininkubev1beta1 "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/apis/trainink8s/v1beta1"
+	"github.com/gotway/gotway/pkg/log"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// validTrainInKube is a v1alpha1 TrainInKube the validating webhook accepts.
+const validTrainInKube = `{
+	"apiVersion": "trainink8s.com/v1alpha1",
+	"kind": "TrainInKube",
+	"metadata": {"name": "example", "namespace": "default"},
+	"spec": {
+		"modelImage": "buildjob:latest",
+		"modelImagePullPolicy": "IfNotPresent",
+		"epochs": 2,
+		"batchSize": 12,
+		"numberOfSamples": 120,
+		"workers": 6,
+		"preprocessedDatasetLocation": "PreprocessedData",
+		"splitDatasetLocation": "Chunks",
+		"modelsLocation": "models",
+		"storage": {"persistentVolumeClaim": {"claimName": "training-data"}}
+	}
+}`
+
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	logger := log.NewLogger(log.Fields{}, "local", "error", io.Discard)
+	srv := New("", "", "", NewDefaults(), logger)
+	ts := httptest.NewTLSServer(srv.Handler())
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// fixture decodes the TrainInKube fixture, and applies the change to it.
+func fixture(t *testing.T, change func(*traininkubev1alpha1.TrainInKube)) *traininkubev1alpha1.TrainInKube {
+	t.Helper()
+	trainInKube := &traininkubev1alpha1.TrainInKube{}
+	if err := json.Unmarshal([]byte(validTrainInKube), trainInKube); err != nil {
+		t.Fatalf("Error while decoding the fixture: %v", err)
+	}
+	if change != nil {
+		change(trainInKube)
+	}
+	return trainInKube
+}
+
+func rawObject(t *testing.T, trainInKube *traininkubev1alpha1.TrainInKube) runtime.RawExtension {
+	t.Helper()
+	raw, err := json.Marshal(trainInKube)
+	if err != nil {
+		t.Fatalf("Error while encoding the TrainInKube: %v", err)
+	}
+	return runtime.RawExtension{Raw: raw}
+}
+
+// post sends the body as JSON to the path of the test server, and decodes the
+// response into out.
+func post(t *testing.T, ts *httptest.Server, path string, body interface{}, out interface{}) {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("Error while encoding the request: %v", err)
+	}
+	resp, err := ts.Client().Post(ts.URL+path, "application/json", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Error while sending the request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		t.Fatalf("Got status %d: %s", resp.StatusCode, msg)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		t.Fatalf("Error while decoding the response: %v", err)
+	}
+}
+
+// admit sends an AdmissionReview for the operation to the webhook on the path,
+// and returns its response.
+func admit(
+	t *testing.T,
+	ts *httptest.Server,
+	path string,
+	operation admissionv1.Operation,
+	old *traininkubev1alpha1.TrainInKube,
+	new *traininkubev1alpha1.TrainInKube,
+) *admissionv1.AdmissionResponse {
+	t.Helper()
+	request := &admissionv1.AdmissionRequest{
+		UID:       types.UID("test-uid"),
+		Operation: operation,
+		Name:      new.Name,
+		Namespace: new.Namespace,
+		Object:    rawObject(t, new),
+	}
+	if old != nil {
+		request.OldObject = rawObject(t, old)
+	}
+	review := admissionv1.AdmissionReview{Request: request}
+	review.APIVersion = "admission.k8s.io/v1"
+	review.Kind = "AdmissionReview"
+
+	response := admissionv1.AdmissionReview{}
+	post(t, ts, path, &review, &response)
+	if response.Response == nil {
+		t.Fatalf("The AdmissionReview has no response")
+	}
+	if response.Response.UID != request.UID {
+		t.Errorf("Got UID %q, want %q", response.Response.UID, request.UID)
+	}
+	return response.Response
+}
+
+func TestValidateCreate(t *testing.T) {
+	ts := newTestServer(t)
+
+	response := admit(t, ts, ValidatePath, admissionv1.Create, nil, fixture(t, nil))
+	if !response.Allowed {
+		t.Fatalf("The valid TrainInKube was denied: %v", response.Result)
+	}
+
+	tests := []struct {
+		name   string
+		change func(*traininkubev1alpha1.TrainInKube)
+		field  string
+	}{
+		{
+			name:   "negative number of workers",
+			change: func(tik *traininkubev1alpha1.TrainInKube) { tik.Spec.Workers = -1 },
+			field:  "spec.workers",
+		},
+		{
+			name:   "batch size of 0",
+			change: func(tik *traininkubev1alpha1.TrainInKube) { tik.Spec.BatchSize = 0 },
+			field:  "spec.batchSize",
+		},
+		{
+			name:   "batch size not divisible by the workers",
+			change: func(tik *traininkubev1alpha1.TrainInKube) { tik.Spec.BatchSize = 10 },
+			field:  "spec.batchSize",
+		},
+		{
+			name:   "fewer samples than the batch size",
+			change: func(tik *traininkubev1alpha1.TrainInKube) { tik.Spec.NumberOfSamples = 6 },
+			field:  "spec.numberOfSamples",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := admit(t, ts, ValidatePath, admissionv1.Create, nil, fixture(t, tt.change))
+			if response.Allowed {
+				t.Fatalf("The invalid TrainInKube was allowed")
+			}
+			if !hasCause(response, tt.field) {
+				t.Errorf("Got %v, want a cause for %s", response.Result, tt.field)
+			}
+		})
+	}
+}
+
+func TestValidateUpdate(t *testing.T) {
+	ts := newTestServer(t)
+	inFlight := func(tik *traininkubev1alpha1.TrainInKube) {
+		tik.Status.Phase = traininkubev1alpha1.PhaseTraining
+		tik.Status.Epoch = 1
+	}
+	old := fixture(t, inFlight)
+
+	changed := fixture(t, func(tik *traininkubev1alpha1.TrainInKube) {
+		inFlight(tik)
+		tik.Spec.BatchSize = 24
+	})
+	response := admit(t, ts, ValidatePath, admissionv1.Update, old, changed)
+	if response.Allowed {
+		t.Fatalf("The change of the batch size of a run in progress was allowed")
+	}
+	if !hasCause(response, "spec") || !strings.Contains(response.Result.Message, "only spec.epochs can be changed") {
+		t.Errorf("Got %v, want only spec.epochs to be changeable", response.Result)
+	}
+
+	moreEpochs := fixture(t, func(tik *traininkubev1alpha1.TrainInKube) {
+		inFlight(tik)
+		tik.Spec.Epochs = 5
+	})
+	response = admit(t, ts, ValidatePath, admissionv1.Update, old, moreEpochs)
+	if !response.Allowed {
+		t.Fatalf("The change of the epochs of a run in progress was denied: %v", response.Result)
+	}
+}
+
+func TestDefault(t *testing.T) {
+	ts := newTestServer(t)
+	trainInKube := fixture(t, func(tik *traininkubev1alpha1.TrainInKube) {
+		tik.Spec = traininkubev1alpha1.TrainInKubeSpec{
+			Epochs:          2,
+			BatchSize:       12,
+			NumberOfSamples: 120,
+		}
+	})
+
+	response := admit(t, ts, DefaultPath, admissionv1.Create, nil, trainInKube)
+	if !response.Allowed {
+		t.Fatalf("The TrainInKube was denied: %v", response.Result)
+	}
+	if response.PatchType == nil || *response.PatchType != admissionv1.PatchTypeJSONPatch {
+		t.Fatalf("Got patch type %v, want %s", response.PatchType, admissionv1.PatchTypeJSONPatch)
+	}
+
+	var patch []struct {
+		Op    string          `json:"op"`
+		Path  string          `json:"path"`
+		Value json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(response.Patch, &patch); err != nil {
+		t.Fatalf("Error while decoding the patch: %v", err)
+	}
+	values := map[string]json.RawMessage{}
+	for _, operation := range patch {
+		if operation.Op != "add" {
+			t.Errorf("Got operation %q on %s, want add", operation.Op, operation.Path)
+		}
+		values[operation.Path] = operation.Value
+	}
+
+	spec := traininkubev1alpha1.TrainInKubeSpec{}
+	if err := json.Unmarshal(values["/spec"], &spec); err != nil {
+		t.Fatalf("Error while decoding the patched spec: %v", err)
+	}
+	defaults := NewDefaults()
+	if spec.Workers != defaults.Workers {
+		t.Errorf("Got %d workers, want %d", spec.Workers, defaults.Workers)
+	}
+	if spec.ModelImagePullPolicy != defaults.ImagePullPolicy {
+		t.Errorf("Got pull policy %q, want %q", spec.ModelImagePullPolicy, defaults.ImagePullPolicy)
+	}
+	if spec.Stages.Train.Image != defaults.TrainImage {
+		t.Errorf("Got train image %q, want %q", spec.Stages.Train.Image, defaults.TrainImage)
+	}
+	if spec.Epochs != 2 || spec.BatchSize != 12 || spec.NumberOfSamples != 120 {
+		t.Errorf("The patch changed the fields set by the TrainInKube: %+v", spec)
+	}
+
+	annotations := map[string]string{}
+	if err := json.Unmarshal(values["/metadata/annotations"], &annotations); err != nil {
+		t.Fatalf("Error while decoding the patched annotations: %v", err)
+	}
+	applied := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(annotations[AppliedDefaultsAnnotation]), &applied); err != nil {
+		t.Fatalf("Error while decoding the %s annotation: %v", AppliedDefaultsAnnotation, err)
+	}
+	for _, path := range []string{"spec.workers", "spec.modelImagePullPolicy", "spec.stages.train.image", "spec.storage"} {
+		if _, ok := applied[path]; !ok {
+			t.Errorf("The %s annotation does not list %s: %v", AppliedDefaultsAnnotation, path, applied)
+		}
+	}
+	if applied["spec.workers"] != float64(defaults.Workers) {
+		t.Errorf("Got %v applied to spec.workers, want %d", applied["spec.workers"], defaults.Workers)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	ts := newTestServer(t)
+	original := fixture(t, func(tik *traininkubev1alpha1.TrainInKube) {
+		tik.Status.Phase = traininkubev1alpha1.PhaseTraining
+		tik.Status.Epoch = 1
+		tik.Status.MiniBatch = 3
+	})
+
+	v1beta1 := convert(t, ts, rawObject(t, original), traininkubev1beta1.SchemeGroupVersion.String())
+	converted := &traininkubev1beta1.TrainInKube{}
+	if err := json.Unmarshal(v1beta1.Raw, converted); err != nil {
+		t.Fatalf("Error while decoding the v1beta1 TrainInKube: %v", err)
+	}
+	if converted.APIVersion != traininkubev1beta1.SchemeGroupVersion.String() {
+		t.Errorf("Got API version %q, want %q", converted.APIVersion, traininkubev1beta1.SchemeGroupVersion)
+	}
+	if converted.Spec.Model.Image != original.Spec.ModelImage ||
+		converted.Spec.Data.SplitDatasetLocation != original.Spec.SplitDatasetLocation ||
+		int(converted.Spec.Workers) != original.Spec.Workers {
+		t.Errorf("The v1beta1 spec does not match the v1alpha1 one: %+v", converted.Spec)
+	}
+
+	v1alpha1 := convert(t, ts, v1beta1, traininkubev1alpha1.SchemeGroupVersion.String())
+	roundTripped := &traininkubev1alpha1.TrainInKube{}
+	if err := json.Unmarshal(v1alpha1.Raw, roundTripped); err != nil {
+		t.Fatalf("Error while decoding the v1alpha1 TrainInKube: %v", err)
+	}
+	if roundTripped.APIVersion != traininkubev1alpha1.SchemeGroupVersion.String() {
+		t.Errorf("Got API version %q, want %q", roundTripped.APIVersion, traininkubev1alpha1.SchemeGroupVersion)
+	}
+	if !apiequality.Semantic.DeepEqual(roundTripped.Spec, original.Spec) {
+		t.Errorf("The spec changed in the round trip:\ngot  %+v\nwant %+v", roundTripped.Spec, original.Spec)
+	}
+	if !apiequality.Semantic.DeepEqual(roundTripped.Status, original.Status) {
+		t.Errorf("The status changed in the round trip:\ngot  %+v\nwant %+v", roundTripped.Status, original.Status)
+	}
+}
+
+// convert sends a ConversionReview for the object to the conversion webhook, and
+// returns the converted object.
+func convert(t *testing.T, ts *httptest.Server, object runtime.RawExtension, desiredAPIVersion string) runtime.RawExtension {
+	t.Helper()
+	review := apiextensionsv1.ConversionReview{
+		Request: &apiextensionsv1.ConversionRequest{
+			UID:               types.UID("test-uid"),
+			DesiredAPIVersion: desiredAPIVersion,
+			Objects:           []runtime.RawExtension{object},
+		},
+	}
+	review.APIVersion = "apiextensions.k8s.io/v1"
+	review.Kind = "ConversionReview"
+
+	response := apiextensionsv1.ConversionReview{}
+	post(t, ts, ConvertPath, &review, &response)
+	if response.Response == nil {
+		t.Fatalf("The ConversionReview has no response")
+	}
+	if response.Response.Result.Status != "Success" {
+		t.Fatalf("The conversion to %s failed: %s", desiredAPIVersion, response.Response.Result.Message)
+	}
+	if len(response.Response.ConvertedObjects) != 1 {
+		t.Fatalf("Got %d converted objects, want 1", len(response.Response.ConvertedObjects))
+	}
+	return response.Response.ConvertedObjects[0]
+}
+
+// hasCause reports whether the response denies the field.
+func hasCause(response *admissionv1.AdmissionResponse, field string) bool {
+	if response.Result == nil || response.Result.Details == nil {
+		return false
+	}
+	for _, cause := range response.Result.Details.Causes {
+		if cause.Field == field {
+			return true
+		}
+	}
+	return false
+}
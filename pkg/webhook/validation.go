@@ -0,0 +1,300 @@
+package webhook
+
+import (
+	"strconv"
+
+	traininkubev1alpha1 "github.com/ChinmayaSharma-hue/TrainInKubes/pkg/apis/trainink8s/v1alpha1"
+	"github.com/ChinmayaSharma-hue/TrainInKubes/pkg/train"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+var supportedWorkerModes = []string{
+	traininkubev1alpha1.WorkerModeJobs,
+	traininkubev1alpha1.WorkerModePersistent,
+}
+
+var supportedPullPolicies = []string{
+	string(corev1.PullAlways),
+	string(corev1.PullIfNotPresent),
+	string(corev1.PullNever),
+}
+
+// ValidateTrainInKube checks the spec of a TrainInKube before the run starts,
+// so that bad specs are rejected up front instead of failing in the middle of
+// the run or training on uneven shards.
+func ValidateTrainInKube(TrainInKube *traininkubev1alpha1.TrainInKube) field.ErrorList {
+	allErrs := field.ErrorList{}
+	spec := TrainInKube.Spec
+	specPath := field.NewPath("spec")
+
+	if spec.Epochs <= 0 {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("epochs"), spec.Epochs, "must be greater than 0"))
+	}
+	if spec.Workers < 0 {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("workers"), spec.Workers, "must be greater than or equal to 0"))
+	}
+	if spec.BatchSize <= 0 {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("batchSize"), spec.BatchSize, "must be greater than 0"))
+	} else if spec.Workers >= 0 {
+		workers := train.NumberOfWorkers(TrainInKube)
+		if spec.BatchSize < workers {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("batchSize"), spec.BatchSize,
+				"must be at least the number of workers"))
+		} else if spec.BatchSize%workers != 0 {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("batchSize"), spec.BatchSize,
+				"must be divisible by the number of workers"))
+		}
+		if spec.NumberOfSamples < spec.BatchSize {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("numberOfSamples"), spec.NumberOfSamples,
+				"must be at least the batch size"))
+		}
+	}
+
+	allErrs = append(allErrs, validatePullPolicy(spec.ModelImagePullPolicy, specPath.Child("modelImagePullPolicy"))...)
+	allErrs = append(allErrs, validateLocations(spec, specPath)...)
+	allErrs = append(allErrs, validateStorage(spec.Storage, specPath.Child("storage"))...)
+	allErrs = append(allErrs, validateStragglerPolicy(spec.StragglerPolicy, train.NumberOfWorkers(TrainInKube), specPath.Child("stragglerPolicy"))...)
+	allErrs = append(allErrs, validateWorkerMode(spec, specPath)...)
+	allErrs = append(allErrs, validateParameterServer(TrainInKube, specPath.Child("parameterServer"))...)
+
+	stagesPath := specPath.Child("stages")
+	for _, stage := range []struct {
+		name string
+		spec traininkubev1alpha1.StageSpec
+	}{
+		{"build", spec.Stages.Build},
+		{"split", spec.Stages.Split},
+		{"train", spec.Stages.Train},
+		{"aggregate", spec.Stages.Aggregate},
+	} {
+		allErrs = append(allErrs, validatePullPolicy(stage.spec.ImagePullPolicy, stagesPath.Child(stage.name, "imagePullPolicy"))...)
+		allErrs = append(allErrs, validateRetryPolicy(stage.spec.RetryPolicy, stagesPath.Child(stage.name, "retryPolicy"))...)
+	}
+
+	return allErrs
+}
+
+// ValidateTrainInKubeUpdate checks an update of a TrainInKube. Once a run has
+// started, only the number of epochs can change, and it cannot go below the
+// epoch being trained.
+func ValidateTrainInKubeUpdate(old *traininkubev1alpha1.TrainInKube, new *traininkubev1alpha1.TrainInKube) field.ErrorList {
+	allErrs := ValidateTrainInKube(new)
+
+	if !isInFlight(old) {
+		return allErrs
+	}
+
+	specPath := field.NewPath("spec")
+
+	if !train.OnlyEpochsChanged(old, new) {
+		allErrs = append(allErrs, field.Forbidden(specPath,
+			"only spec.epochs can be changed while the run is in progress"))
+	}
+
+	if new.Spec.Epochs < old.Status.Epoch {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("epochs"), new.Spec.Epochs,
+			"cannot be less than the epoch being trained"))
+	}
+
+	return allErrs
+}
+
+// isInFlight reports whether the operator started working on the run and has
+// not finished it yet.
+func isInFlight(TrainInKube *traininkubev1alpha1.TrainInKube) bool {
+	return TrainInKube.Status.Phase != "" && !train.IsFinished(TrainInKube)
+}
+
+func validatePullPolicy(policy string, fldPath *field.Path) field.ErrorList {
+	if policy == "" {
+		return nil
+	}
+	for _, supported := range supportedPullPolicies {
+		if policy == supported {
+			return nil
+		}
+	}
+	return field.ErrorList{field.NotSupported(fldPath, policy, supportedPullPolicies)}
+}
+
+// maxExitCodes is the number of exit codes a pod failure policy rule accepts.
+const maxExitCodes = 255
+
+func validateRetryPolicy(policy traininkubev1alpha1.RetryPolicy, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if policy.Retries != nil && *policy.Retries < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("retries"), *policy.Retries, "must be greater than or equal to 0"))
+	}
+	if policy.Backoff != nil && policy.Backoff.Duration < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("backoff"), policy.Backoff.Duration.String(), "must be greater than or equal to 0"))
+	}
+	if policy.BackoffLimit != nil && *policy.BackoffLimit < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("backoffLimit"), *policy.BackoffLimit, "must be greater than or equal to 0"))
+	}
+	if policy.ActiveDeadlineSeconds != nil && *policy.ActiveDeadlineSeconds <= 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("activeDeadlineSeconds"), *policy.ActiveDeadlineSeconds, "must be greater than 0"))
+	}
+
+	for _, codes := range []struct {
+		name   string
+		values []int32
+	}{
+		{"retriableExitCodes", policy.RetriableExitCodes},
+		{"fatalExitCodes", policy.FatalExitCodes},
+	} {
+		codesPath := fldPath.Child(codes.name)
+		if len(codes.values) > maxExitCodes {
+			allErrs = append(allErrs, field.TooMany(codesPath, len(codes.values), maxExitCodes))
+		}
+		for i, code := range codes.values {
+			if code < 1 || code > 255 {
+				allErrs = append(allErrs, field.Invalid(codesPath.Index(i), code, "must be between 1 and 255"))
+			}
+		}
+	}
+	retriable := map[int32]bool{}
+	for _, code := range policy.RetriableExitCodes {
+		retriable[code] = true
+	}
+	for i, code := range policy.FatalExitCodes {
+		if retriable[code] {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("fatalExitCodes").Index(i), code, "cannot also be retriable"))
+		}
+	}
+
+	return allErrs
+}
+
+func validateWorkerMode(spec traininkubev1alpha1.TrainInKubeSpec, specPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	switch spec.WorkerMode {
+	case "", traininkubev1alpha1.WorkerModeJobs:
+	case traininkubev1alpha1.WorkerModePersistent:
+		if spec.StragglerPolicy != nil {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("stragglerPolicy"),
+				"is not supported with persistent workers"))
+		}
+		if spec.ParameterServer != nil {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("parameterServer"),
+				"is not supported with persistent workers"))
+		}
+	default:
+		allErrs = append(allErrs, field.NotSupported(specPath.Child("workerMode"), spec.WorkerMode, supportedWorkerModes))
+	}
+
+	return allErrs
+}
+
+func validateStragglerPolicy(policy *traininkubev1alpha1.StragglerPolicy, workers int, fldPath *field.Path) field.ErrorList {
+	if policy == nil {
+		return nil
+	}
+	allErrs := field.ErrorList{}
+
+	if policy.MinWorkers == nil && policy.Backup == nil {
+		allErrs = append(allErrs, field.Required(fldPath, "must set one of minWorkers or backup"))
+	}
+	if policy.MinWorkers != nil && policy.Backup != nil {
+		allErrs = append(allErrs, field.Forbidden(fldPath, "may not set both minWorkers and backup"))
+	}
+	if policy.MinWorkers != nil && (*policy.MinWorkers < 1 || int(*policy.MinWorkers) > workers) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("minWorkers"), *policy.MinWorkers,
+			"must be between 1 and the number of workers"))
+	}
+	if policy.Backup != nil && (policy.Backup.Percentile < 0 || policy.Backup.Percentile > 99) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("backup", "percentile"), policy.Backup.Percentile,
+			"must be between 1 and 99, or 0 for the default of 75"))
+	}
+
+	return allErrs
+}
+
+func validateParameterServer(TrainInKube *traininkubev1alpha1.TrainInKube, fldPath *field.Path) field.ErrorList {
+	spec := TrainInKube.Spec.ParameterServer
+	if spec == nil {
+		return nil
+	}
+	allErrs := field.ErrorList{}
+
+	// The Service of the parameter server is named after the TrainInKube
+	name := train.ParameterServerName(TrainInKube.Name)
+	for _, msg := range validation.IsDNS1035Label(name) {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("metadata", "name"), TrainInKube.Name,
+			"must make a valid Service name for the parameter server: "+msg))
+	}
+
+	allErrs = append(allErrs, validatePullPolicy(spec.ImagePullPolicy, fldPath.Child("imagePullPolicy"))...)
+	if spec.LearningRate != "" {
+		learningRate, err := strconv.ParseFloat(spec.LearningRate, 64)
+		if err != nil || learningRate <= 0 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("learningRate"), spec.LearningRate,
+				"must be a number greater than 0"))
+		}
+	}
+
+	return allErrs
+}
+
+func validateLocations(spec traininkubev1alpha1.TrainInKubeSpec, specPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	for _, location := range []struct {
+		name  string
+		value string
+	}{
+		{"preprocessedDatasetLocation", spec.PreprocessedDataLocation},
+		{"splitDatasetLocation", spec.SplitDatasetLocation},
+		{"modelsLocation", spec.ModelsLocation},
+	} {
+		if err := train.ValidateLocation(location.value); err != nil {
+			allErrs = append(allErrs, field.Invalid(specPath.Child(location.name), location.value,
+				"must be a path inside the storage volume without \"..\""))
+		}
+	}
+
+	return allErrs
+}
+
+func validateStorage(storage traininkubev1alpha1.StorageSpec, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	sources := 0
+
+	if storage.HostPath != nil {
+		sources++
+		if storage.HostPath.Path == "" {
+			allErrs = append(allErrs, field.Required(fldPath.Child("hostPath", "path"), ""))
+		}
+	}
+	if storage.PersistentVolumeClaim != nil {
+		sources++
+		if storage.PersistentVolumeClaim.ClaimName == "" {
+			allErrs = append(allErrs, field.Required(fldPath.Child("persistentVolumeClaim", "claimName"), ""))
+		}
+	}
+	if storage.NFS != nil {
+		sources++
+		if storage.NFS.Server == "" {
+			allErrs = append(allErrs, field.Required(fldPath.Child("nfs", "server"), ""))
+		}
+		if storage.NFS.Path == "" {
+			allErrs = append(allErrs, field.Required(fldPath.Child("nfs", "path"), ""))
+		}
+	}
+	if storage.CSI != nil {
+		sources++
+		if storage.CSI.Driver == "" {
+			allErrs = append(allErrs, field.Required(fldPath.Child("csi", "driver"), ""))
+		}
+	}
+
+	if sources > 1 {
+		allErrs = append(allErrs, field.Forbidden(fldPath, "may not specify more than 1 storage source"))
+	}
+
+	return allErrs
+}